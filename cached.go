@@ -0,0 +1,295 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Cached implements FileSystem caching contents of files read from a remote FileSystem on a Local one.
+// ReadFile and Reader are served from the cache until the cached copy expires, operations changing files
+// invalidate the cache, other operations are passed to the remote FileSystem.
+// Cache failures never fail the operations, the remote FileSystem is used instead.
+// The implementation is not concurrent-safe: a file changed while it is read may be cached stale until it expires
+type Cached struct {
+	FileSystem // remote
+
+	cache    *Local
+	cacheDir string
+	ttl      time.Duration // zero means no expiration
+}
+
+// NewCached returns a new FileSystem caching files read from remote in cacheDir of the cache FileSystem.
+// Cached copies expire in ttl, zero ttl means they never expire
+func NewCached(remote FileSystem, cache *Local, cacheDir string, ttl time.Duration) FileSystem {
+	return &Cached{FileSystem: remote, cache: cache, cacheDir: cacheDir, ttl: ttl}
+}
+
+// cacheName returns the name of the cached copy of the file by name
+func (c *Cached) cacheName(name string) string {
+	return filepath.Join(c.cacheDir, filepath.FromSlash(path.Clean("/"+filepath.ToSlash(name))))
+}
+
+// cached returns the name of the cached copy of the file by name if it exists and is not expired
+func (c *Cached) cached(ctx context.Context, name string) (cacheName string, ok bool) {
+	cacheName = c.cacheName(name)
+	fi, err := c.cache.Stat(ctx, cacheName)
+	if err != nil || fi.IsDir() {
+		return cacheName, false
+	}
+	return cacheName, c.ttl <= 0 || time.Since(fi.ModTime()) < c.ttl
+}
+
+// tempName returns a name to write a copy to before it is moved to the cacheName
+func (c *Cached) tempName(cacheName string) string {
+	return cacheName + "." + newInstanceID() + ".tmp"
+}
+
+// store puts a copy of the file contents into the cache
+func (c *Cached) store(ctx context.Context, cacheName string, b []byte) {
+	if err := c.cache.MakePathAll(ctx, filepath.Dir(cacheName)); err != nil {
+		return
+	}
+	tempName := c.tempName(cacheName)
+	if err := c.cache.WriteFile(ctx, tempName, b); err != nil {
+		_ = c.cache.Remove(ctx, tempName)
+		return
+	}
+	if err := c.cache.Rename(ctx, tempName, cacheName); err != nil {
+		_ = c.cache.Remove(ctx, tempName)
+	}
+}
+
+// invalidate removes cached copies of files by names, for directories all the cached copies inside them
+func (c *Cached) invalidate(ctx context.Context, names ...string) {
+	for _, name := range names {
+		_ = c.cache.RemoveAll(ctx, c.cacheName(name))
+	}
+}
+
+// ReadFile reads the file by name from the cache or from the remote FileSystem caching it
+func (c *Cached) ReadFile(ctx context.Context, name string) (b []byte, err error) {
+	cacheName, ok := c.cached(ctx, name)
+	if ok {
+		if b, err = c.cache.ReadFile(ctx, cacheName); err == nil {
+			return
+		}
+	}
+	if b, err = c.FileSystem.ReadFile(ctx, name); err != nil {
+		return
+	}
+	c.store(ctx, cacheName, b)
+	return
+}
+
+// Reader returns reader of the file by name from the cache or from the remote FileSystem.
+// In the latter case the file is cached once it is read entirely
+func (c *Cached) Reader(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	cacheName, ok := c.cached(ctx, name)
+	if ok {
+		var f File
+		if f, err = c.cache.Open(ctx, cacheName); err == nil {
+			return f, nil
+		}
+	}
+	if r, err = c.FileSystem.Reader(ctx, name); err != nil {
+		return
+	}
+	if err := c.cache.MakePathAll(ctx, filepath.Dir(cacheName)); err != nil {
+		return r, nil
+	}
+	tempName := c.tempName(cacheName)
+	temp, err := c.cache.Create(ctx, tempName)
+	if err != nil {
+		return r, nil
+	}
+	return &cachingReader{ReadCloser: r, c: c, ctx: ctx, temp: temp, tempName: tempName, cacheName: cacheName}, nil
+}
+
+// WriteFile makes Cached to implement FileSystem
+func (c *Cached) WriteFile(ctx context.Context, name string, b []byte) error {
+	defer c.invalidate(ctx, name)
+	return c.FileSystem.WriteFile(ctx, name, b)
+}
+
+// WriteFileInfo makes Cached to implement FileSystem
+func (c *Cached) WriteFileInfo(ctx context.Context, name string, b []byte) (FileInfo, error) {
+	defer c.invalidate(ctx, name)
+	return c.FileSystem.WriteFileInfo(ctx, name, b)
+}
+
+// WriteFiles makes Cached to implement FileSystem
+func (c *Cached) WriteFiles(ctx context.Context, files []FileNameData) error {
+	for _, file := range files {
+		defer c.invalidate(ctx, file.Name)
+	}
+	return c.FileSystem.WriteFiles(ctx, files)
+}
+
+// WriteFilesResult makes Cached to implement FilesResultWriter
+func (c *Cached) WriteFilesResult(ctx context.Context, files []FileNameData) ([]FileNameError, error) {
+	for _, file := range files {
+		defer c.invalidate(ctx, file.Name)
+	}
+	return writeFilesResultOf(ctx, c.FileSystem, files)
+}
+
+// WriteFilesFrom makes Cached to implement FilesFromWriter
+func (c *Cached) WriteFilesFrom(ctx context.Context, files []FileNameReader) error {
+	for _, file := range files {
+		defer c.invalidate(ctx, file.Name)
+	}
+	return writeFilesFromOf(ctx, c.FileSystem, files)
+}
+
+// Create makes Cached to implement FileSystem. The cache is invalidated on closing the returned File
+func (c *Cached) Create(ctx context.Context, name string) (File, error) {
+	return c.invalidatingFile(ctx, name, c.FileSystem.Create)
+}
+
+// CreateExcl makes Cached to implement ExclusiveCreator. The cache is invalidated on closing the returned File
+func (c *Cached) CreateExcl(ctx context.Context, name string) (File, error) {
+	return c.invalidatingFile(ctx, name, func(ctx context.Context, name string) (File, error) {
+		return createExclOf(ctx, c.FileSystem, name)
+	})
+}
+
+// OpenW makes Cached to implement FileSystem. The cache is invalidated on closing the returned File
+func (c *Cached) OpenW(ctx context.Context, name string) (File, error) {
+	return c.invalidatingFile(ctx, name, c.FileSystem.OpenW)
+}
+
+// OpenFile makes Cached to implement FileSystem.
+// If the file is opened for writing, the cache is invalidated on closing the returned File
+func (c *Cached) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC) == 0 {
+		return c.FileSystem.OpenFile(ctx, name, flag, perm)
+	}
+	return c.invalidatingFile(ctx, name, func(ctx context.Context, name string) (File, error) {
+		return c.FileSystem.OpenFile(ctx, name, flag, perm)
+	})
+}
+
+// invalidatingFile opens the file by name for writing with open, the cache is invalidated on closing it
+func (c *Cached) invalidatingFile(ctx context.Context, name string,
+	open func(context.Context, string) (File, error)) (File, error) {
+	f, err := open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, name)
+	return invalidatingFile{File: f, invalidate: func() { c.invalidate(ctx, name) }}, nil
+}
+
+// Remove makes Cached to implement FileSystem
+func (c *Cached) Remove(ctx context.Context, name string) error {
+	defer c.invalidate(ctx, name)
+	return c.FileSystem.Remove(ctx, name)
+}
+
+// RemoveFiles makes Cached to implement FileSystem
+func (c *Cached) RemoveFiles(ctx context.Context, names []string) error {
+	defer c.invalidate(ctx, names...)
+	return c.FileSystem.RemoveFiles(ctx, names)
+}
+
+// RemoveAll makes Cached to implement FileSystem
+func (c *Cached) RemoveAll(ctx context.Context, name string) error {
+	defer c.invalidate(ctx, name)
+	return c.FileSystem.RemoveAll(ctx, name)
+}
+
+// Rename makes Cached to implement FileSystem
+func (c *Cached) Rename(ctx context.Context, from, to string) error {
+	defer c.invalidate(ctx, from, to)
+	return c.FileSystem.Rename(ctx, from, to)
+}
+
+// RenameNoOverwrite makes Cached to implement NoOverwriteRenamer
+func (c *Cached) RenameNoOverwrite(ctx context.Context, from, to string) error {
+	defer c.invalidate(ctx, from, to)
+	return renameNoOverwriteOf(ctx, c.FileSystem, from, to)
+}
+
+// Swap makes Cached to implement FileSystem
+func (c *Cached) Swap(ctx context.Context, a, b string) error {
+	defer c.invalidate(ctx, a, b)
+	return c.FileSystem.Swap(ctx, a, b)
+}
+
+// ReadFileLimited makes Cached to implement LimitedFileReader, the file is read from the remote FileSystem
+func (c *Cached) ReadFileLimited(ctx context.Context, name string, maxBytes int64) ([]byte, error) {
+	return readFileLimitedOf(ctx, c.FileSystem, name, maxBytes)
+}
+
+// FreeSpace makes Cached to implement FreeSpacer
+func (c *Cached) FreeSpace(ctx context.Context, name string) (uint64, error) {
+	return freeSpaceOf(ctx, c.FileSystem, name)
+}
+
+// WalkDirWithStats makes Cached to implement StatsWalker
+func (c *Cached) WalkDirWithStats(ctx context.Context, name string, walkDirFunc WalkDirFunc) (WalkStats, error) {
+	return walkDirWithStatsOf(ctx, c.FileSystem, name, walkDirFunc)
+}
+
+// Ping makes Cached to implement Pinger
+func (c *Cached) Ping(ctx context.Context) error { return pingOf(ctx, c.FileSystem) }
+
+// Chown makes Cached to implement Chowner
+func (c *Cached) Chown(ctx context.Context, name string, uid, gid int) error {
+	return chownOf(ctx, c.FileSystem, name, uid, gid)
+}
+
+// cachingReader reads a remote file writing a copy of it to a temporary file,
+// which is moved to the cache on closing if the remote file was read entirely
+type cachingReader struct {
+	io.ReadCloser // remote
+	c             *Cached
+	ctx           context.Context
+	temp          File
+	tempName      string
+	cacheName     string
+	failed        bool // writing a copy failed
+	complete      bool // the remote file is read entirely
+}
+
+// Read makes cachingReader to implement io.Reader
+func (r *cachingReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if n > 0 && !r.failed {
+		if _, errWrite := r.temp.Write(p[:n]); errWrite != nil {
+			r.failed = true
+		}
+	}
+	if err == io.EOF {
+		r.complete = true
+	}
+	return
+}
+
+// Close makes cachingReader to implement io.Closer
+func (r *cachingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if errTemp := r.temp.Close(); errTemp == nil && !r.failed && r.complete {
+		if r.c.cache.Rename(r.ctx, r.tempName, r.cacheName) == nil {
+			return err
+		}
+	}
+	_ = r.c.cache.Remove(r.ctx, r.tempName)
+	return err
+}
+
+// invalidatingFile is a File invalidating the cache on closing
+type invalidatingFile struct {
+	File
+	invalidate func()
+}
+
+// Close makes invalidatingFile to implement File
+func (f invalidatingFile) Close() error {
+	defer f.invalidate()
+	return f.File.Close()
+}
@@ -2,7 +2,10 @@ package filesystem
 
 import (
 	"context"
+	"runtime"
+	"strings"
 	"sync"
+	"time"
 )
 
 type (
@@ -11,6 +14,9 @@ type (
 
 	// cbFunc is callback func type
 	cbFunc func(context.Context) error
+
+	// cbResultFunc is callback func type receiving the operation name, it's resulting error and duration
+	cbResultFunc func(ctx context.Context, op string, err error, dur time.Duration) error
 )
 
 // callbacks
@@ -18,6 +24,7 @@ var (
 	cbMu              sync.Mutex
 	beforeOperationCB cbCtxFunc
 	afterOperationCB  cbFunc
+	afterOperationCB2 cbResultFunc
 )
 
 // BeforeOperationCB returns callback that will be invoked before each operation
@@ -48,24 +55,99 @@ func SetAfterOperationCB(f cbFunc) {
 	afterOperationCB = f
 }
 
+// AfterOperationCB2 returns callback that will be invoked after each operation with it's result
+func AfterOperationCB2() cbResultFunc {
+	cbMu.Lock()
+	defer cbMu.Unlock()
+	return afterOperationCB2
+}
+
+// SetAfterOperationCB2 sets callback that will be invoked after each operation with it's result.
+// It is invoked after the callback set by SetAfterOperationCB
+func SetAfterOperationCB2(f cbResultFunc) {
+	cbMu.Lock()
+	defer cbMu.Unlock()
+	afterOperationCB2 = f
+}
+
+// operationCtxKey is a context key marking that the operation is in progress.
+// The value is true for operations nested into another one, false for the top-level one
+type operationCtxKey struct{}
+
+// operationInfoCtxKey is a context key of operationInfo of the top-level operation
+type operationInfoCtxKey struct{}
+
+// operationInfo describes the top-level operation in progress
+type operationInfo struct {
+	op    string
+	start time.Time
+}
+
+// operationName returns the name of the function calling the callback invoker, like "S3.ReadFile"
+func operationName() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return ""
+	}
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return ""
+	}
+	name := f.Name()[strings.LastIndex(f.Name(), "/")+1:] // package path is trimmed
+	name = name[strings.Index(name, ".")+1:]              // package name is trimmed
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
+
+// isNestedOperation returns whether ctx belongs to an operation nested into another one
+func isNestedOperation(ctx context.Context) bool {
+	nested, _ := ctx.Value(operationCtxKey{}).(bool)
+	return nested
+}
+
+// withoutOperationMark returns ctx which is not marked as belonging to any operation,
+// so callbacks will be invoked for operations with it. Used for operations deferred by the caller
+func withoutOperationMark(ctx context.Context) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	return context.WithValue(ctx, operationCtxKey{}, nil)
+}
+
+// invokeBeforeOperationCB invokes the callback for the top-level operation only,
+// operations called within it are marked as nested
 func invokeBeforeOperationCB(ctx context.Context) (context.Context, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	cb := BeforeOperationCB()
-	if cb == nil {
+	if nested, inOperation := ctx.Value(operationCtxKey{}).(bool); inOperation {
+		if !nested {
+			ctx = context.WithValue(ctx, operationCtxKey{}, true)
+		}
 		return ctx, nil
 	}
-	return cb(ctx)
+	if cb := BeforeOperationCB(); cb != nil {
+		var err error
+		if ctx, err = cb(ctx); err != nil || ctx == nil {
+			return ctx, err
+		}
+	}
+	ctx = context.WithValue(ctx, operationInfoCtxKey{}, operationInfo{op: operationName(), start: time.Now()})
+	return context.WithValue(ctx, operationCtxKey{}, false), nil
 }
 
-func invokeAfterOperationCB(ctx context.Context) error {
-	if ctx == nil {
+// invokeAfterOperationCB invokes the callbacks for the top-level operation only, err is the operation result
+func invokeAfterOperationCB(ctx context.Context, err error) (errcb error) {
+	if ctx == nil || isNestedOperation(ctx) {
 		return nil
 	}
-	cb := AfterOperationCB()
-	if cb == nil {
-		return nil
+	if cb := AfterOperationCB(); cb != nil {
+		errcb = cb(ctx)
+	}
+	if cb := AfterOperationCB2(); cb != nil {
+		info, _ := ctx.Value(operationInfoCtxKey{}).(operationInfo)
+		if errcb2 := cb(ctx, info.op, err, time.Since(info.start)); errcb == nil {
+			errcb = errcb2
+		}
 	}
-	return cb(ctx)
+	return
 }
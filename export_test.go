@@ -0,0 +1,31 @@
+package filesystem
+
+import (
+	"os"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SetOSRename replaces the function used by Local to rename files, nil restores os.Rename
+func SetOSRename(f func(string, string) error) {
+	if f == nil {
+		f = os.Rename
+	}
+	osRename = f
+}
+
+// SetFileSync replaces the function used by Local to sync files, nil restores (*os.File).Sync
+func SetFileSync(f func(*os.File) error) {
+	if f == nil {
+		f = (*os.File).Sync
+	}
+	fileSync = f
+}
+
+// SetMaxSingleCopySize sets the max size of an object copied by a single request, larger objects are copied by parts
+func SetMaxSingleCopySize(s *S3, size int64) { s.maxSingleCopySize = size }
+
+// PutObjectOptions returns options the S3 FileSystem puts an object with
+func PutObjectOptions(s *S3, contentType string, opts WriteOptions) minio.PutObjectOptions {
+	return s.putObjectOptions(contentType, opts)
+}
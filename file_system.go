@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"io/fs"
+	"os"
+	"time"
 )
 
 // File abstracts a file
@@ -33,6 +35,27 @@ func (fsi FilesInfo) FullNames() []string {
 type FileInfo interface {
 	fs.FileInfo
 	FullName() string
+	FS() FileSystem
+}
+
+// ContentTyper is implemented by FileInfo which is able to provide a content type
+type ContentTyper interface {
+	ContentType() string
+}
+
+// ETager is implemented by FileInfo which is able to provide an entity tag
+type ETager interface {
+	ETag() string
+}
+
+// StorageClasser is implemented by FileInfo which is able to provide a storage class
+type StorageClasser interface {
+	StorageClass() string
+}
+
+// MetadataProvider is implemented by FileInfo which is able to provide user metadata
+type MetadataProvider interface {
+	UserMetadata() map[string]string
 }
 
 // DirEntry abstracts directory walkDirEntry
@@ -44,19 +67,40 @@ type DirEntry interface {
 // WalkDirFunc is a wrapper around fs.WalkDirFunc
 type WalkDirFunc func(string, DirEntry, error) error
 
+// WalkFilesFunc is a function called for each file or directory visited by WalkFiles.
+// FileInfo may be nil if an error occurred before the information was obtained
+type WalkFilesFunc func(FileInfo, error) error
+
 // FileNameData represents file name and data
 type FileNameData struct {
 	Name string
 	Data []byte
 }
 
+// FileNameError represents file name and the error occurred with the file
+type FileNameError struct {
+	Name string
+	Err  error
+}
+
+// FileNameReader represents file name and a reader of its data
+type FileNameReader struct {
+	Name   string
+	Reader io.Reader
+	Size   int64 // may be -1 if unknown
+}
+
 // FileSystem abstracts a file system
 type FileSystem interface {
 	Create(context.Context, string) (File, error)
 	Open(context.Context, string) (File, error)
 	OpenW(context.Context, string) (File, error)
+	OpenFile(context.Context, string, int, os.FileMode) (File, error)
 	ReadFile(context.Context, string) ([]byte, error)
+	ReadFileInto(context.Context, string, []byte) (int, error)
+	Head(context.Context, string, int64) ([]byte, error)
 	WriteFile(context.Context, string, []byte) error
+	WriteFileInfo(context.Context, string, []byte) (FileInfo, error)
 	WriteFiles(context.Context, []FileNameData) error
 	Reader(context.Context, string) (io.ReadCloser, error)
 	Exists(context.Context, string) (bool, error)
@@ -67,8 +111,61 @@ type FileSystem interface {
 	IsNotExist(error) bool
 	IsEmptyPath(context.Context, string) (bool, error)
 	PreparePath(context.Context, string) (string, error)
+	Rel(string, string) (string, error)
+	SameName(string, string) bool
+	CountObjects(context.Context, string) (int64, error)
 	Rename(context.Context, string, string) error
+	Swap(context.Context, string, string) error
 	Stat(context.Context, string) (FileInfo, error)
+	SetModTime(context.Context, string, time.Time) error
 	ReadDir(context.Context, string) (FilesInfo, error)
+	Siblings(context.Context, string) (FilesInfo, error)
 	WalkDir(context.Context, string, WalkDirFunc) error
+	WalkFiles(context.Context, string, WalkFilesFunc) error
+	WalkDirWithOptions(context.Context, string, WalkDirFunc, WalkDirOptions) error
+}
+
+// NoOverwriteRenamer is implemented by FileSystem which is able to rename a file failing if the destination exists
+type NoOverwriteRenamer interface {
+	RenameNoOverwrite(context.Context, string, string) error
+}
+
+// FilesFromWriter is implemented by FileSystem which is able to write files streaming them from readers
+type FilesFromWriter interface {
+	WriteFilesFrom(context.Context, []FileNameReader) error
+}
+
+// Chowner is implemented by FileSystem which is able to change the owner of a file
+type Chowner interface {
+	Chown(context.Context, string, int, int) error
+}
+
+// Pinger is implemented by FileSystem which is able to check its availability
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// StatsWalker is implemented by FileSystem which is able to walk the directory tree returning its totals
+type StatsWalker interface {
+	WalkDirWithStats(context.Context, string, WalkDirFunc) (WalkStats, error)
+}
+
+// FreeSpacer is implemented by FileSystem which is able to report its available space
+type FreeSpacer interface {
+	FreeSpace(context.Context, string) (uint64, error)
+}
+
+// LimitedFileReader is implemented by FileSystem which is able to read a file failing if it is too large
+type LimitedFileReader interface {
+	ReadFileLimited(context.Context, string, int64) ([]byte, error)
+}
+
+// FilesResultWriter is implemented by FileSystem which is able to write files reporting each failed one
+type FilesResultWriter interface {
+	WriteFilesResult(context.Context, []FileNameData) ([]FileNameError, error)
+}
+
+// ExclusiveCreator is implemented by FileSystem which is able to create a file failing if it already exists
+type ExclusiveCreator interface {
+	CreateExcl(context.Context, string) (File, error)
 }
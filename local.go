@@ -1,43 +1,97 @@
 package filesystem
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mtfelian/utils"
 )
 
+// osRename renames files, it is a variable to allow simulating errors in tests
+var osRename = os.Rename
+
+// fileSync commits the file contents to stable storage, it is a variable to allow counting calls in tests
+var fileSync = (*os.File).Sync
+
 // Local implements FileSystem. The implementation is not concurrent-safe
-type Local struct{}
+type Local struct {
+	syncOnWrite         bool
+	preservePermissions bool
+}
 
 // NewLocal returns a pointer to a new Local object
 func NewLocal() FileSystem { return &Local{} }
 
-// Open file in the FileSystem
+// NewLocalWithOptions returns a pointer to a new Local object with the given options
+func NewLocalWithOptions(opts LocalOptions) FileSystem {
+	return &Local{syncOnWrite: opts.SyncOnWrite, preservePermissions: opts.PreservePermissions}
+}
+
+// writeHandle wraps the file opened for writing to be synced on closing if syncOnWrite is set
+func (l *Local) writeHandle(f *os.File) File {
+	if !l.syncOnWrite {
+		return f
+	}
+	return syncOnCloseFile{File: f}
+}
+
+// writeFile writes data to the file with the given name like os.WriteFile does,
+// syncing the file before closing if syncOnWrite is set
+func (l *Local) writeFile(name string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return l.writeHandle(f).Close()
+}
+
+// Open file in the FileSystem. ErrIsADirectory is returned if name is a directory
 func (l *Local) Open(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	return os.Open(name)
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return
+	}
+	var fi os.FileInfo
+	if fi, err = file.Stat(); err == nil && fi.IsDir() {
+		err = ErrIsADirectory
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
 }
 
-// Create file in the FileSystem
+// Create file in the FileSystem. ErrIsADirectory is returned if name is a directory
 func (l *Local) Create(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -45,16 +99,42 @@ func (l *Local) Create(ctx context.Context, name string) (f File, err error) {
 	if err = os.MkdirAll(filepath.Dir(name), 0777); err != nil {
 		return
 	}
-	return os.Create(name)
+	var file *os.File
+	if file, err = os.Create(name); err != nil {
+		return nil, isADirectoryError(name, err)
+	}
+	return l.writeHandle(file), nil
 }
 
-// OpenW opens file in the FileSystem for writing
+// CreateExcl creates file like Create does, but returns an error satisfying errors.Is(err, fs.ErrExist)
+// if the file already exists
+func (l *Local) CreateExcl(ctx context.Context, name string) (f File, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if err = os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return
+	}
+	var file *os.File
+	if file, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666); err != nil {
+		return nil, isADirectoryError(name, err)
+	}
+	return l.writeHandle(file), nil
+}
+
+// OpenW opens file in the FileSystem for writing. The file is created if it does not exist, but not truncated
 func (l *Local) OpenW(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -62,7 +142,41 @@ func (l *Local) OpenW(ctx context.Context, name string) (f File, err error) {
 	if err = os.MkdirAll(filepath.Dir(name), 0777); err != nil {
 		return
 	}
-	return os.OpenFile(name, os.O_WRONLY, 0666)
+	var file *os.File
+	if file, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666); err != nil {
+		return nil, isADirectoryError(name, err)
+	}
+	return l.writeHandle(file), nil
+}
+
+// isADirectoryError returns ErrIsADirectory if opening the file by name failed with err because it is a directory,
+// otherwise err is returned
+func isADirectoryError(name string, err error) error {
+	if fi, errStat := os.Stat(name); errStat == nil && fi.IsDir() {
+		return ErrIsADirectory
+	}
+	return err
+}
+
+// OpenFile opens file in the FileSystem with the given flags (os.O_*) and permissions
+func (l *Local) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (f File, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	var file *os.File
+	if file, err = os.OpenFile(name, flag, perm); err != nil {
+		return
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, nil
+	}
+	return l.writeHandle(file), nil
 }
 
 // ReadFile by name
@@ -71,7 +185,7 @@ func (l *Local) ReadFile(ctx context.Context, name string) (b []byte, err error)
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -79,13 +193,89 @@ func (l *Local) ReadFile(ctx context.Context, name string) (b []byte, err error)
 	return os.ReadFile(name)
 }
 
+// ReadFileLimited reads file by name like ReadFile does, but returns ErrObjectTooLarge
+// if the file is larger than maxBytes
+func (l *Local) ReadFileLimited(ctx context.Context, name string, maxBytes int64) (b []byte, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	var fi os.FileInfo
+	if fi, err = f.Stat(); err != nil {
+		return
+	}
+	if fi.Mode().IsRegular() && fi.Size() > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	return io.ReadAll(&maxSizeReader{r: f, remaining: maxBytes}) // in case the file grows while reading
+}
+
+// ReadFileInto reads file by name into buf and returns the amount of bytes read.
+// If the file is larger than buf, nothing is read and the error wrapping io.ErrShortBuffer is returned
+func (l *Local) ReadFileInto(ctx context.Context, name string, buf []byte) (n int, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	var fi os.FileInfo
+	if fi, err = f.Stat(); err != nil {
+		return
+	}
+	if fi.Size() > int64(len(buf)) {
+		return 0, fmt.Errorf("%w: file size is %d", io.ErrShortBuffer, fi.Size())
+	}
+	return io.ReadFull(f, buf[:fi.Size()])
+}
+
+// Head reads at most n first bytes of the file by name. If the file is shorter than n bytes, it is read entirely
+func (l *Local) Head(ctx context.Context, name string, n int64) (b []byte, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if n < 0 {
+		n = 0
+	}
+	return io.ReadAll(io.LimitReader(f, n))
+}
+
 // WriteFile by name
 func (l *Local) WriteFile(ctx context.Context, name string, data []byte) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -93,7 +283,24 @@ func (l *Local) WriteFile(ctx context.Context, name string, data []byte) (err er
 	if err = os.MkdirAll(filepath.Dir(name), 0777); err != nil {
 		return
 	}
-	return os.WriteFile(name, data, 0644)
+	return l.writeFile(name, bytes.NewReader(data), 0644)
+}
+
+// WriteFileInfo writes file like WriteFile does and returns information of the written file
+func (l *Local) WriteFileInfo(ctx context.Context, name string, data []byte) (fi FileInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if err = l.WriteFile(ctx, name, data); err != nil {
+		return
+	}
+	return l.Stat(ctx, name)
 }
 
 // WriteFiles by the data given
@@ -102,7 +309,49 @@ func (l *Local) WriteFiles(ctx context.Context, f []FileNameData) (err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	for _, el := range f {
+		if err = os.MkdirAll(filepath.Dir(el.Name), 0777); err != nil {
+			return
+		}
+		if err = l.writeFile(el.Name, bytes.NewReader(el.Data), 0644); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteFilesResult writes files like WriteFiles does, but the files which failed to be written
+// are reported with their errors while the rest are written
+func (l *Local) WriteFilesResult(ctx context.Context, f []FileNameData) (failed []FileNameError, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	for _, el := range f {
+		if err := l.WriteFile(ctx, el.Name, el.Data); err != nil {
+			failed = append(failed, FileNameError{Name: el.Name, Err: err})
+		}
+	}
+	return
+}
+
+// WriteFilesFrom writes files by the data read from the given readers
+func (l *Local) WriteFilesFrom(ctx context.Context, f []FileNameReader) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -111,7 +360,7 @@ func (l *Local) WriteFiles(ctx context.Context, f []FileNameData) (err error) {
 		if err = os.MkdirAll(filepath.Dir(el.Name), 0777); err != nil {
 			return
 		}
-		if err = os.WriteFile(el.Name, el.Data, 0644); err != nil {
+		if err = l.writeFile(el.Name, el.Reader, 0644); err != nil {
 			return
 		}
 	}
@@ -124,7 +373,7 @@ func (l *Local) Reader(ctx context.Context, name string) (r io.ReadCloser, err e
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -138,7 +387,7 @@ func (l *Local) Exists(ctx context.Context, name string) (e bool, err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -160,7 +409,7 @@ func (l *Local) MakePathAll(ctx context.Context, name string) (err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -174,7 +423,7 @@ func (l *Local) Remove(ctx context.Context, name string) (err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -188,7 +437,7 @@ func (l *Local) RemoveFiles(ctx context.Context, names []string) (err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -207,7 +456,7 @@ func (l *Local) RemoveAll(ctx context.Context, name string) (err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -221,7 +470,7 @@ func (l *Local) IsEmptyPath(ctx context.Context, name string) (e bool, err error
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -238,7 +487,7 @@ func (l *Local) PreparePath(ctx context.Context, name string) (absolutePath stri
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -257,13 +506,182 @@ func (l *Local) PreparePath(ctx context.Context, name string) (absolutePath stri
 	return absolutePath, nil
 }
 
+// Ping checks that the local file system is available by checking the directory for temporary files
+func (l *Local) Ping(ctx context.Context) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	_, err = os.Stat(os.TempDir())
+	return
+}
+
+// Rel returns a relative path that is lexically equivalent to targPath when joined to basePath
+func (l *Local) Rel(basePath, targPath string) (string, error) {
+	return filepath.Rel(basePath, targPath)
+}
+
+// SameName returns whether names a and b refer to the same path, i.e. they are equal after filepath.Clean.
+// Symbolic links are not resolved
+func (l *Local) SameName(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
 // Rename file
 func (l *Local) Rename(ctx context.Context, from, to string) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return
+	}
+	if err = osRename(from, to); errors.Is(err, syscall.EXDEV) { // source and destination are on different devices
+		return l.renameAcrossDevices(from, to)
+	}
+	return
+}
+
+// renameAcrossDevices renames from to the destination on another device by copying it and then
+// removing the source. Mode and modification time are preserved, and the owner is if preservePermissions is set.
+// Directories are copied recursively
+func (l *Local) renameAcrossDevices(from, to string) (err error) {
+	var fi os.FileInfo
+	if fi, err = os.Lstat(from); err != nil {
+		return
+	}
+	if fi.IsDir() {
+		if err = os.Mkdir(to, fi.Mode().Perm()); err != nil { // an existing destination is left untouched
+			return
+		}
+		if err = l.copyDirAcrossDevices(from, to, fi); err != nil {
+			_ = os.RemoveAll(to) // it is created above, so nothing else is removed
+			return
+		}
+		return os.RemoveAll(from)
+	}
+
+	// the file is copied to a temporary file near the destination to replace the destination atomically
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*"); err != nil {
+		return
+	}
+	tmpName := tmp.Name()
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = l.copyFileAcrossDevices(from, tmpName, fi); err == nil {
+		err = os.Rename(tmpName, to)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return
+	}
+	return os.Remove(from)
+}
+
+// copyDirAcrossDevices recursively copies the directory from described by fi into the just created directory to
+func (l *Local) copyDirAcrossDevices(from, to string, fi os.FileInfo) (err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(from); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		entryFrom, entryTo := filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())
+		var entryInfo os.FileInfo
+		if entryInfo, err = os.Lstat(entryFrom); err != nil {
+			return
+		}
+		if entryInfo.IsDir() {
+			if err = os.Mkdir(entryTo, entryInfo.Mode().Perm()); err == nil {
+				err = l.copyDirAcrossDevices(entryFrom, entryTo, entryInfo)
+			}
+		} else {
+			err = l.copyFileAcrossDevices(entryFrom, entryTo, entryInfo)
+		}
+		if err != nil {
+			return
+		}
+	}
+	if err = l.preserveOwner(to, fi); err != nil {
+		return
+	}
+	if err = os.Chmod(to, fi.Mode().Perm()); err != nil { // mode given to Mkdir is affected by umask
+		return
+	}
+	return os.Chtimes(to, fi.ModTime(), fi.ModTime())
+}
+
+// copyFileAcrossDevices copies the file or the symbolic link from described by fi into to
+func (l *Local) copyFileAcrossDevices(from, to string, fi os.FileInfo) (err error) {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var target string
+		if target, err = os.Readlink(from); err != nil {
+			return
+		}
+		_ = os.Remove(to)
+		if err = os.Symlink(target, to); err != nil {
+			return
+		}
+		return l.preserveOwner(to, fi)
+	}
+
+	var src, dst *os.File
+	if src, err = os.Open(from); err != nil {
+		return
+	}
+	defer func() { _ = src.Close() }()
+	if dst, err = os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm()); err != nil {
+		return
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	if err = l.preserveOwner(to, fi); err != nil { // before Chmod since changing the owner may clear setuid bits
+		return
+	}
+	if err = os.Chmod(to, fi.Mode().Perm()); err != nil { // mode given to OpenFile is affected by umask
+		return
+	}
+	return os.Chtimes(to, fi.ModTime(), fi.ModTime())
+}
+
+// preserveOwner changes the owner of the file to to the owner of the file described by fi
+// if preservePermissions is set and the owner is known on this platform. Symbolic links are not followed
+func (l *Local) preserveOwner(to string, fi os.FileInfo) error {
+	if !l.preservePermissions {
+		return nil
+	}
+	uid, gid, ok := fileOwner(fi)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(to, uid, gid)
+}
+
+// RenameNoOverwrite renames file like Rename does, but returns ErrDestinationExists if the destination exists.
+// Files are renamed atomically via a hard link. Directories are renamed after the destination existence check,
+// so a destination created concurrently between the check and the renaming may be replaced
+func (l *Local) RenameNoOverwrite(ctx context.Context, from, to string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -271,7 +689,66 @@ func (l *Local) Rename(ctx context.Context, from, to string) (err error) {
 	if filepath.Clean(from) == filepath.Clean(to) {
 		return
 	}
-	return os.Rename(from, to)
+
+	var fi os.FileInfo
+	if fi, err = os.Lstat(from); err != nil {
+		return
+	}
+	if fi.IsDir() {
+		if _, err = os.Lstat(to); err == nil {
+			return ErrDestinationExists
+		}
+		if !os.IsNotExist(err) {
+			return
+		}
+		return os.Rename(from, to)
+	}
+
+	if err = os.Link(from, to); err != nil {
+		if os.IsExist(err) {
+			return ErrDestinationExists
+		}
+		return
+	}
+	return os.Remove(from)
+}
+
+// Swap exchanges the existing files a and b renaming them through a temporary name in the directory of a.
+// If either file does not exist, nothing is modified. On failure the renamed files are moved back if possible
+func (l *Local) Swap(ctx context.Context, a, b string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return
+	}
+	for _, name := range []string{a, b} {
+		if _, err = os.Lstat(name); err != nil {
+			return
+		}
+	}
+
+	temp := filepath.Join(filepath.Dir(a), "."+filepath.Base(a)+"."+newInstanceID()+".swap")
+	if err = osRename(a, temp); err != nil {
+		return
+	}
+	if err = osRename(b, a); err != nil {
+		_ = osRename(temp, a)
+		return
+	}
+	if err = osRename(temp, b); err != nil {
+		if osRename(a, b) == nil {
+			_ = osRename(temp, a)
+		}
+		return
+	}
+	return nil
 }
 
 // Stat returns a FileInfo describing the named file
@@ -280,7 +757,7 @@ func (l *Local) Stat(ctx context.Context, name string) (fi FileInfo, err error)
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -289,7 +766,35 @@ func (l *Local) Stat(ctx context.Context, name string) (fi FileInfo, err error)
 	if osfi, err = os.Stat(name); err != nil {
 		return
 	}
-	return NewLocalFileInfo(osfi, name), nil
+	return NewLocalFileInfo(l, osfi, name), nil
+}
+
+// SetModTime sets access and modification times of the named file
+func (l *Local) SetModTime(ctx context.Context, name string, t time.Time) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return os.Chtimes(name, t, t)
+}
+
+// Chown changes the numeric uid and gid of the file
+func (l *Local) Chown(ctx context.Context, name string, uid, gid int) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return os.Chown(name, uid, gid)
 }
 
 // ReadDir with the name given
@@ -298,7 +803,7 @@ func (l *Local) ReadDir(ctx context.Context, name string) (fi FilesInfo, err err
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
@@ -309,27 +814,195 @@ func (l *Local) ReadDir(ctx context.Context, name string) (fi FilesInfo, err err
 	}
 	fi = make(FilesInfo, len(fsfi))
 	for i := range fsfi {
-		fi[i] = NewLocalFileInfo(fsfi[i], name)
+		fi[i] = NewLocalFileInfo(l, fsfi[i], filepath.Join(name, fsfi[i].Name()))
+	}
+	return
+}
+
+// Siblings returns entries of the parent directory of the given name excluding the name itself
+func (l *Local) Siblings(ctx context.Context, name string) (fi FilesInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
 	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	name = filepath.Clean(name)
+	var entries FilesInfo
+	if entries, err = l.ReadDir(ctx, filepath.Dir(name)); err != nil {
+		return
+	}
+	fi = make(FilesInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() != filepath.Base(name) {
+			fi = append(fi, entry)
+		}
+	}
+	return
+}
+
+// FreeSpace returns the amount of bytes available to the user on the file system containing the given name.
+// ErrFreeSpaceUnknown is returned on platforms where it can't be determined
+func (l *Local) FreeSpace(ctx context.Context, name string) (free uint64, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return freeSpace(name)
+}
+
+// CountObjects returns the amount of files in the directory by name and all its subdirectories,
+// directories are not counted
+func (l *Local) CountObjects(ctx context.Context, name string) (c int64, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	err = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			c++
+		}
+		return nil
+	})
 	return
 }
 
 // WalkDir traverses the filesystem from the given directory
 func (l *Local) WalkDir(ctx context.Context, root string, walkDirFunc WalkDirFunc) (err error) {
+	return l.WalkDirWithOptions(ctx, root, walkDirFunc, WalkDirOptions{})
+}
+
+// WalkDirWithOptions traverses the filesystem from the given directory with the given options
+func (l *Local) WalkDirWithOptions(ctx context.Context, root string, walkDirFunc WalkDirFunc,
+	opts WalkDirOptions) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	return filepath.WalkDir(root, func(path string, info fs.DirEntry, err error) error {
+	walkDirFunc = opts.limited(walkDirFunc)
+	var visited map[string]struct{} // real paths of walked directories, to detect symlink cycles
+	if opts.FollowSymlinks {
+		visited = make(map[string]struct{})
+	}
+	if err = l.walkDir(root, root, walkDirFunc, opts, visited); err == ErrStopWalk {
+		err = nil
+	}
+	return
+}
+
+// walkDir traverses the directory realRoot reporting its entries as if they are inside root.
+// If visited is not nil, symlinked directories not visited yet are traversed too
+func (l *Local) walkDir(root, realRoot string, walkDirFunc WalkDirFunc, opts WalkDirOptions,
+	visited map[string]struct{}) error {
+	if visited != nil {
+		if realName, err := filepath.EvalSymlinks(realRoot); err == nil {
+			visited[realName] = struct{}{}
+		}
+	}
+	return filepath.WalkDir(realRoot, func(realPath string, info fs.DirEntry, err error) error {
+		path := realPath
+		if root != realRoot {
+			path = root + strings.TrimPrefix(realPath, realRoot)
+		}
+		if visited != nil && info != nil && info.Type()&fs.ModeSymlink != 0 {
+			if target, err := filepath.EvalSymlinks(realPath); err == nil {
+				if _, ok := visited[target]; !ok {
+					if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+						return l.walkDir(path, target, walkDirFunc, opts, visited)
+					}
+				}
+			}
+		}
+		if err != nil { // info is nil if the root can't be read, otherwise it is the directory failed to be read
+			var entry DirEntry
+			if info != nil {
+				if infoInfo, errInfo := info.Info(); errInfo == nil {
+					entry = LocalDirEntry{fi: NewLocalFileInfo(l, infoInfo, path)}
+				}
+			}
+			return walkDirFailed(info, walkDirFunc(path, entry, err), opts)
+		}
 		infoInfo, err := info.Info()
 		if err != nil {
-			return err
+			return walkDirFailed(info, walkDirFunc(path, nil, err), opts)
+		}
+		if !infoInfo.IsDir() && !opts.modTimeMatches(infoInfo.ModTime()) {
+			return nil
 		}
-		return walkDirFunc(path, LocalDirEntry{fi: NewLocalFileInfo(infoInfo, path)}, err)
+		return walkDirFunc(path, LocalDirEntry{fi: NewLocalFileInfo(l, infoInfo, path)}, nil)
 	})
 }
+
+// walkDirFailed returns to filepath.WalkDir the error err returned by WalkDirFunc on a report of the failed entry info.
+// If the walk is continued, the failed directory is skipped
+func walkDirFailed(info fs.DirEntry, err error, opts WalkDirOptions) error {
+	if err == nil || opts.continued(err) != nil {
+		return err
+	}
+	if info != nil && info.IsDir() {
+		return fs.SkipDir // for a file it would skip the rest of its directory
+	}
+	return nil
+}
+
+// WalkDirWithStats is like WalkDir but also returns totals of files, directories and bytes visited
+func (l *Local) WalkDirWithStats(ctx context.Context, root string, walkDirFunc WalkDirFunc) (stats WalkStats, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return walkDirWithStats(ctx, l.WalkDir, root, walkDirFunc)
+}
+
+// WalkFiles traverses the filesystem from the given directory like WalkDir but passes
+// FileInfo objects obtained during the traversal
+func (l *Local) WalkFiles(ctx context.Context, root string, walkFilesFunc WalkFilesFunc) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		var fi FileInfo
+		if info != nil {
+			fi = NewLocalFileInfo(l, info, path)
+		}
+		return walkFilesFunc(fi, err)
+	}); err == ErrStopWalk {
+		err = nil
+	}
+	return
+}
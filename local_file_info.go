@@ -2,7 +2,9 @@ package filesystem
 
 import (
 	"io/fs"
+	"mime"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -10,11 +12,12 @@ import (
 type LocalFileInfo struct {
 	fi       os.FileInfo
 	fullName string
+	l        *Local
 }
 
 // NewLocalFileInfo returns new LocalFileInfo object
-func NewLocalFileInfo(fi os.FileInfo, fullName string) LocalFileInfo {
-	return LocalFileInfo{fi: fi, fullName: fullName}
+func NewLocalFileInfo(l *Local, fi os.FileInfo, fullName string) LocalFileInfo {
+	return LocalFileInfo{fi: fi, fullName: fullName, l: l}
 }
 
 // Name makes LocalFileInfo to implement FileInfo
@@ -35,5 +38,20 @@ func (s LocalFileInfo) ModTime() time.Time { return s.fi.ModTime() }
 // IsDir makes LocalFileInfo to implement FileInfo
 func (s LocalFileInfo) IsDir() bool { return s.fi.IsDir() }
 
+// FS makes LocalFileInfo to implement FileInfo. It returns the FileSystem the file belongs to
+func (s LocalFileInfo) FS() FileSystem { return s.l }
+
 // Sys makes LocalFileInfo to implement FileInfo
 func (s LocalFileInfo) Sys() interface{} { return s.fi.Sys() }
+
+// ContentType makes LocalFileInfo to implement ContentTyper. Returns content type derived from
+// the file name extension, it is empty for directories and unknown extensions
+func (s LocalFileInfo) ContentType() string {
+	if s.fi.IsDir() {
+		return ""
+	}
+	return mime.TypeByExtension(filepath.Ext(s.fi.Name()))
+}
+
+// ETag makes LocalFileInfo to implement ETager. It always returns an empty string
+func (s LocalFileInfo) ETag() string { return "" }
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package filesystem
+
+import "os"
+
+// fileOwner is not supported on this platform
+func fileOwner(os.FileInfo) (uid, gid int, ok bool) { return 0, 0, false }
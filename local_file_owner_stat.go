@@ -0,0 +1,18 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the numeric uid and gid of the owner of the file described by fi
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
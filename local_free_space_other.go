@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package filesystem
+
+// freeSpace is not supported on this platform
+func freeSpace(string) (uint64, error) { return 0, ErrFreeSpaceUnknown }
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package filesystem
+
+import "syscall"
+
+// freeSpace returns the amount of bytes available to unprivileged users on the file system containing name
+func freeSpace(name string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(name, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
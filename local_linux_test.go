@@ -0,0 +1,235 @@
+//go:build linux
+// +build linux
+
+package filesystem_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/mtfelian/filesystem"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Local FileSystem implementation, Linux-specific", func() {
+	var (
+		fsLocal filesystem.FileSystem
+		ctx     context.Context
+		dir     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "filesystem-local-test-")
+		Expect(err).NotTo(HaveOccurred())
+		fsLocal = filesystem.NewLocal()
+		ctx = context.Background()
+		filesystem.SetBeforeOperationCB(nil)
+		filesystem.SetAfterOperationCB(nil)
+		filesystem.SetAfterOperationCB2(nil)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("Chown", func() {
+		It("checks changing owner of a file", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+
+			uid, gid := os.Getuid(), os.Getgid() // unprivileged process may only chown to itself
+			if os.Geteuid() == 0 {
+				uid, gid = 1234, 2345
+			}
+			Expect(fsLocal.(*filesystem.Local).Chown(ctx, name, uid, gid)).To(Succeed())
+
+			fi, err := os.Stat(name)
+			Expect(err).NotTo(HaveOccurred())
+			stat, ok := fi.Sys().(*syscall.Stat_t)
+			Expect(ok).To(BeTrue())
+			Expect(int(stat.Uid)).To(Equal(uid))
+			Expect(int(stat.Gid)).To(Equal(gid))
+		})
+	})
+
+	Describe("Rename across devices", func() {
+		BeforeEach(func() {
+			filesystem.SetOSRename(func(from, to string) error {
+				return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+			})
+		})
+
+		AfterEach(func() {
+			filesystem.SetOSRename(nil)
+		})
+
+		modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		checkFile := func(name string, content string, mode os.FileMode) {
+			b, err := os.ReadFile(name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content))
+			fi, err := os.Stat(name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(mode), "name %q", name)
+			Expect(fi.ModTime()).To(BeTemporally("==", modTime), "name %q", name)
+		}
+
+		It("checks renaming a file", func() {
+			from, to := filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")
+			Expect(os.WriteFile(from, []byte("content 1"), 0600)).To(Succeed())
+			Expect(os.WriteFile(to, []byte("content 2"), 0644)).To(Succeed())
+			Expect(os.Chmod(from, 0640)).To(Succeed())
+			Expect(os.Chtimes(from, modTime, modTime)).To(Succeed())
+
+			Expect(fsLocal.Rename(ctx, from, to)).To(Succeed())
+			checkFile(to, "content 1", 0640)
+			_, err := os.Stat(from)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			entries, err := os.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1), "no temporary files should be left")
+		})
+
+		It("checks renaming a directory", func() {
+			from, to := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+			Expect(os.MkdirAll(filepath.Join(from, "c"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(from, "1.txt"), []byte("content 1"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(from, "c", "2.txt"), []byte("content 2"), 0644)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(from, "c"), 0750)).To(Succeed())
+			for _, name := range []string{"1.txt", "c/2.txt", "c", ""} {
+				Expect(os.Chtimes(filepath.Join(from, name), modTime, modTime)).To(Succeed())
+			}
+
+			Expect(fsLocal.Rename(ctx, from, to)).To(Succeed())
+			checkFile(filepath.Join(to, "1.txt"), "content 1", 0600)
+			checkFile(filepath.Join(to, "c", "2.txt"), "content 2", 0644)
+			fi, err := os.Stat(filepath.Join(to, "c"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0750)))
+			Expect(fi.ModTime()).To(BeTemporally("==", modTime))
+			_, err = os.Stat(from)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("checks that the owner is preserved with PreservePermissions", func() {
+			if os.Geteuid() != 0 {
+				Skip("changing the owner to another user requires privileges")
+			}
+			from, to := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+			Expect(os.MkdirAll(from, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(from, "1.txt"), []byte("content 1"), 0640)).To(Succeed())
+			Expect(os.Symlink("1.txt", filepath.Join(from, "link"))).To(Succeed())
+			const uid, gid = 1234, 2345
+			for _, name := range []string{"1.txt", "link", ""} {
+				Expect(os.Lchown(filepath.Join(from, name), uid, gid)).To(Succeed())
+			}
+
+			preservingFS := filesystem.NewLocalWithOptions(filesystem.LocalOptions{PreservePermissions: true})
+			Expect(preservingFS.Rename(ctx, from, to)).To(Succeed())
+			for _, name := range []string{"1.txt", "link", ""} {
+				fi, err := os.Lstat(filepath.Join(to, name))
+				Expect(err).NotTo(HaveOccurred())
+				stat := fi.Sys().(*syscall.Stat_t)
+				Expect(int(stat.Uid)).To(Equal(uid), "name %q", name)
+				Expect(int(stat.Gid)).To(Equal(gid), "name %q", name)
+			}
+			fi, err := os.Stat(filepath.Join(to, "1.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+			By("checking that the owner is not preserved by default", func() {
+				Expect(fsLocal.Rename(ctx, to, from)).To(Succeed())
+				fi, err := os.Lstat(filepath.Join(from, "1.txt"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(int(fi.Sys().(*syscall.Stat_t).Uid)).To(Equal(os.Geteuid()))
+			})
+		})
+
+		It("checks that renaming a directory onto an existing one keeps the destination", func() {
+			from, to := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+			Expect(os.MkdirAll(from, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(from, "1.txt"), []byte("content 1"), 0644)).To(Succeed())
+			Expect(os.MkdirAll(to, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(to, "2.txt"), []byte("content 2"), 0644)).To(Succeed())
+
+			Expect(fsLocal.Rename(ctx, from, to)).NotTo(Succeed())
+			b, err := os.ReadFile(filepath.Join(to, "2.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal("content 2"))
+			b, err = os.ReadFile(filepath.Join(from, "1.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal("content 1"))
+		})
+
+		It("checks renaming a non-existent file", func() {
+			err := fsLocal.Rename(ctx, filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("FreeSpace", func() {
+		It("checks free space of the file system containing a directory", func() {
+			free, err := fsLocal.(*filesystem.Local).FreeSpace(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			var stat syscall.Statfs_t
+			Expect(syscall.Statfs(dir, &stat)).To(Succeed())
+			Expect(free).To(BeNumerically(">", 0))
+			Expect(free).To(BeNumerically("<=", stat.Blocks*uint64(stat.Bsize)))
+		})
+
+		It("checks free space of a non-existent name", func() {
+			_, err := fsLocal.(*filesystem.Local).FreeSpace(ctx, filepath.Join(dir, "no", "such"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("WalkDirWithOptions following symlinks", func() {
+		var target, link, name string
+
+		BeforeEach(func() {
+			target, link = filepath.Join(dir, "target"), filepath.Join(dir, "link")
+			name = filepath.Join(target, "1.txt")
+			Expect(os.Mkdir(target, 0755)).To(Succeed())
+			Expect(os.WriteFile(name, []byte("content"), 0644)).To(Succeed())
+			Expect(os.Symlink(target, link)).To(Succeed())
+			Expect(os.Symlink(dir, filepath.Join(target, "cycle"))).To(Succeed())
+		})
+
+		walk := func(opts filesystem.WalkDirOptions) (namesWalked []string) {
+			Expect(fsLocal.WalkDirWithOptions(ctx, dir, func(name string, de filesystem.DirEntry, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				namesWalked = append(namesWalked, name)
+				return nil
+			}, opts)).To(Succeed())
+			return
+		}
+
+		It("checks that symlinked directories are walked with FollowSymlinks", func() {
+			Expect(walk(filesystem.WalkDirOptions{FollowSymlinks: true})).To(Equal([]string{
+				dir,
+				link,
+				filepath.Join(link, "1.txt"),
+				filepath.Join(link, "cycle"),
+				target,
+				name,
+				filepath.Join(target, "cycle"),
+			}))
+		})
+
+		It("checks that symlinked directories are not walked without FollowSymlinks", func() {
+			Expect(walk(filesystem.WalkDirOptions{})).To(Equal([]string{
+				dir,
+				link,
+				target,
+				name,
+				filepath.Join(target, "cycle"),
+			}))
+		})
+	})
+})
@@ -0,0 +1,11 @@
+package filesystem
+
+// LocalOptions are options for Local filesystem
+type LocalOptions struct {
+	// SyncOnWrite makes written files to be synced to stable storage before closing
+	// by WriteFile, WriteFiles and Close of the files opened for writing
+	SyncOnWrite bool
+	// PreservePermissions makes Rename of files and directories across devices to preserve their owner as well
+	// as their mode, which is preserved anyway. Changing the owner to another user requires privileges
+	PreservePermissions bool
+}
@@ -0,0 +1,17 @@
+package filesystem
+
+import "os"
+
+// syncOnCloseFile is a local file which is synced to stable storage before closing
+type syncOnCloseFile struct {
+	*os.File
+}
+
+// Close makes syncOnCloseFile to implement File. It syncs the file and then closes it
+func (f syncOnCloseFile) Close() error {
+	if err := fileSync(f.File); err != nil {
+		_ = f.File.Close()
+		return err
+	}
+	return f.File.Close()
+}
@@ -0,0 +1,974 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mtfelian/filesystem"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// readsCountingFS counts reads of files of the wrapped FileSystem
+type readsCountingFS struct {
+	filesystem.FileSystem
+	reads int
+}
+
+func (rc *readsCountingFS) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	rc.reads++
+	return rc.FileSystem.ReadFile(ctx, name)
+}
+
+func (rc *readsCountingFS) Reader(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc.reads++
+	return rc.FileSystem.Reader(ctx, name)
+}
+
+// errFailingWrites is returned by failingWritesFS on writing
+var errFailingWrites = errors.New("writes are failing")
+
+// failingWritesFS fails writing files to the wrapped FileSystem
+type failingWritesFS struct {
+	filesystem.FileSystem
+}
+
+func (fw failingWritesFS) WriteFile(context.Context, string, []byte) error { return errFailingWrites }
+
+func (fw failingWritesFS) Create(context.Context, string) (filesystem.File, error) {
+	return nil, errFailingWrites
+}
+
+var _ = Describe("Local FileSystem implementation", func() {
+	var (
+		fsLocal filesystem.FileSystem
+		ctx     context.Context
+		dir     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "filesystem-local-test-")
+		Expect(err).NotTo(HaveOccurred())
+		fsLocal = filesystem.NewLocal()
+		ctx = context.Background()
+		filesystem.SetBeforeOperationCB(nil)
+		filesystem.SetAfterOperationCB(nil)
+		filesystem.SetAfterOperationCB2(nil)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("RenameNoOverwrite", func() {
+		var name1, name2 string
+		const content1, content2 = "content 1", "content 2"
+
+		BeforeEach(func() {
+			name1, name2 = filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")
+			Expect(fsLocal.WriteFile(ctx, name1, []byte(content1))).To(Succeed())
+		})
+
+		It("checks renaming file to new name which does not exists", func() {
+			Expect(fsLocal.(*filesystem.Local).RenameNoOverwrite(ctx, name1, name2)).To(Succeed())
+			b, err := fsLocal.ReadFile(ctx, name2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content1))
+
+			exists, err := fsLocal.Exists(ctx, name1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("checks renaming file to new name which already exists, should fail", func() {
+			Expect(fsLocal.WriteFile(ctx, name2, []byte(content2))).To(Succeed())
+			Expect(fsLocal.(*filesystem.Local).RenameNoOverwrite(ctx, name1, name2)).To(Equal(filesystem.ErrDestinationExists))
+
+			b, err := fsLocal.ReadFile(ctx, name2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content2))
+			b, err = fsLocal.ReadFile(ctx, name1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content1))
+		})
+
+		It("checks renaming directory into existing directory, should fail", func() {
+			dir1, dir2 := filepath.Join(dir, "d1"), filepath.Join(dir, "d2")
+			Expect(fsLocal.MakePathAll(ctx, dir1)).To(Succeed())
+			Expect(fsLocal.MakePathAll(ctx, dir2)).To(Succeed())
+			Expect(fsLocal.(*filesystem.Local).RenameNoOverwrite(ctx, dir1, dir2)).To(Equal(filesystem.ErrDestinationExists))
+
+			Expect(os.Remove(dir2)).To(Succeed())
+			Expect(fsLocal.(*filesystem.Local).RenameNoOverwrite(ctx, dir1, dir2)).To(Succeed())
+			exists, err := fsLocal.Exists(ctx, dir2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+		})
+	})
+
+	Describe("Swap", func() {
+		var name1, name2 string
+		const content1, content2 = "content 1", "content 2"
+
+		BeforeEach(func() {
+			name1, name2 = filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")
+			Expect(fsLocal.WriteFile(ctx, name1, []byte(content1))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte(content2))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			filesystem.SetOSRename(nil)
+		})
+
+		checkContents := func(content1, content2 string) {
+			b, err := fsLocal.ReadFile(ctx, name1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content1))
+			b, err = fsLocal.ReadFile(ctx, name2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content2))
+			entries, err := os.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+		}
+
+		It("checks swapping files", func() {
+			Expect(fsLocal.Swap(ctx, name1, name2)).To(Succeed())
+			checkContents(content2, content1)
+		})
+
+		It("checks swapping with a non-existent file, should fail", func() {
+			Expect(fsLocal.Remove(ctx, name2)).To(Succeed())
+			err := fsLocal.Swap(ctx, name1, name2)
+			Expect(fsLocal.IsNotExist(err)).To(BeTrue())
+			b, err := fsLocal.ReadFile(ctx, name1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content1))
+		})
+
+		It("checks that files are moved back if the last renaming fails", func() {
+			errRename := errors.New("rename error")
+			var renames int
+			filesystem.SetOSRename(func(from, to string) error {
+				if renames++; renames == 3 {
+					return errRename
+				}
+				return os.Rename(from, to)
+			})
+			Expect(fsLocal.Swap(ctx, name1, name2)).To(MatchError(errRename))
+			checkContents(content1, content2)
+		})
+	})
+
+	Describe("SetModTime", func() {
+		It("checks setting modification time of a file", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+
+			modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+			Expect(fsLocal.SetModTime(ctx, name, modTime)).To(Succeed())
+			fi, err := fsLocal.Stat(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.ModTime()).To(BeTemporally("==", modTime))
+		})
+	})
+
+	Describe("WalkFiles", func() {
+		It("checks walking the directory tree, sizes of files should be populated", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "2.txt")
+			const content1, content2 = "content 1", "content 22"
+			Expect(fsLocal.WriteFile(ctx, name1, []byte(content1))).To(Succeed())
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name2))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte(content2))).To(Succeed())
+
+			sizes := make(map[string]int64)
+			Expect(fsLocal.WalkFiles(ctx, dir, func(fi filesystem.FileInfo, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				if !fi.IsDir() {
+					sizes[fi.FullName()] = fi.Size()
+				}
+				return nil
+			})).To(Succeed())
+			Expect(sizes).To(Equal(map[string]int64{
+				name1: int64(len(content1)),
+				name2: int64(len(content2)),
+			}))
+		})
+	})
+
+	Describe("WalkDir", func() {
+		It("checks stopping the walk after the first file", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "2.txt")
+			Expect(fsLocal.WriteFile(ctx, name1, []byte("content 1"))).To(Succeed())
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name2))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte("content 2"))).To(Succeed())
+
+			var namesWalked []string
+			Expect(fsLocal.WalkDir(ctx, dir, func(name string, de filesystem.DirEntry, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				namesWalked = append(namesWalked, name)
+				if !de.IsDir() {
+					return filesystem.ErrStopWalk
+				}
+				return nil
+			})).To(Succeed())
+			Expect(namesWalked).To(Equal([]string{dir, name1}))
+		})
+
+		It("checks that an error of walking not existing root is passed to WalkDirFunc", func() {
+			root := filepath.Join(dir, "no-such-dir")
+			var reported []error
+			err := fsLocal.WalkDir(ctx, root, func(name string, de filesystem.DirEntry, e error) error {
+				Expect(name).To(Equal(root))
+				Expect(de).To(BeNil())
+				reported = append(reported, e)
+				return e
+			})
+			Expect(fsLocal.IsNotExist(err)).To(BeTrue())
+			Expect(reported).To(HaveLen(1))
+			Expect(fsLocal.IsNotExist(reported[0])).To(BeTrue())
+		})
+	})
+
+	Describe("WalkDirWithOptions", func() {
+		It("checks ContinueOnError, the failed entry should be skipped", func() {
+			root := filepath.Join(dir, "no-such-dir")
+			walk := func(opts filesystem.WalkDirOptions) (failedNames []string, err error) {
+				err = fsLocal.WalkDirWithOptions(ctx, root, func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).To(HaveOccurred())
+					failedNames = append(failedNames, name)
+					return e
+				}, opts)
+				return
+			}
+			failedNames, err := walk(filesystem.WalkDirOptions{})
+			Expect(fsLocal.IsNotExist(err)).To(BeTrue())
+			Expect(failedNames).To(Equal([]string{root}))
+			failedNames, err = walk(filesystem.WalkDirOptions{ContinueOnError: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(failedNames).To(Equal([]string{root}))
+		})
+
+		It("checks ModifiedAfter and ModifiedBefore, directories should be descended anyway", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "2.txt")
+			name3 := filepath.Join(dir, "a", "3.txt")
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name2))).To(Succeed())
+			cutoff := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+			for i, name := range []string{name1, name2, name3} {
+				Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+				Expect(fsLocal.SetModTime(ctx, name, cutoff.Add(time.Duration(i-1)*time.Hour))).To(Succeed())
+			}
+
+			walk := func(opts filesystem.WalkDirOptions) (namesWalked []string) {
+				Expect(fsLocal.WalkDirWithOptions(ctx, dir, func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					namesWalked = append(namesWalked, name)
+					return nil
+				}, opts)).To(Succeed())
+				return
+			}
+			Expect(walk(filesystem.WalkDirOptions{ModifiedAfter: cutoff})).To(Equal([]string{dir, filepath.Dir(name2), name3}))
+			Expect(walk(filesystem.WalkDirOptions{ModifiedBefore: cutoff})).To(Equal([]string{dir, name1, filepath.Dir(name2)}))
+			Expect(walk(filesystem.WalkDirOptions{
+				ModifiedAfter:  cutoff.Add(-time.Hour),
+				ModifiedBefore: cutoff.Add(time.Hour),
+			})).To(Equal([]string{dir, filepath.Dir(name2), name2}))
+		})
+
+		It("checks Limit, entries of skipped directories should not be counted", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "2.txt")
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name2))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name1, []byte("content"))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte("content"))).To(Succeed())
+
+			walk := func(limit int, skipDir string) (namesWalked []string, err error) {
+				err = fsLocal.WalkDirWithOptions(ctx, dir, func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					namesWalked = append(namesWalked, name)
+					if name == skipDir {
+						return filesystem.ErrSkipDir
+					}
+					return nil
+				}, filesystem.WalkDirOptions{Limit: limit})
+				return
+			}
+
+			namesWalked, err := walk(3, "")
+			Expect(err).To(Equal(filesystem.ErrWalkTruncated))
+			Expect(namesWalked).To(Equal([]string{dir, name1, filepath.Dir(name2)}))
+
+			namesWalked, err = walk(4, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(namesWalked).To(HaveLen(4))
+
+			namesWalked, err = walk(3, filepath.Dir(name2))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(namesWalked).To(Equal([]string{dir, name1, filepath.Dir(name2)}))
+		})
+	})
+
+	Describe("WalkDirWithStats", func() {
+		It("checks totals of the walk", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "2.txt")
+			const content1, content2 = "content 1", "content 22"
+			Expect(fsLocal.WriteFile(ctx, name1, []byte(content1))).To(Succeed())
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name2))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte(content2))).To(Succeed())
+
+			stats, err := fsLocal.(*filesystem.Local).WalkDirWithStats(ctx, dir, func(name string, de filesystem.DirEntry, e error) error {
+				return e
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats).To(Equal(filesystem.WalkStats{Files: 2, Dirs: 2, Bytes: int64(len(content1) + len(content2))}))
+		})
+	})
+
+	Describe("Rel", func() {
+		It("checks relative name of a file", func() {
+			rel, err := fsLocal.Rel(filepath.Join(dir, "a"), filepath.Join(dir, "a", "b", "c_d", "1.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rel).To(Equal(filepath.Join("b", "c_d", "1.txt")))
+		})
+	})
+
+	Describe("SameName", func() {
+		It("checks names referring to the same path", func() {
+			name := filepath.Join(dir, "a", "1.txt")
+			Expect(fsLocal.SameName(name, dir+"/a/./b/../1.txt")).To(BeTrue())
+			Expect(fsLocal.SameName(filepath.Join(dir, "a")+"/", filepath.Join(dir, "a"))).To(BeTrue())
+			Expect(fsLocal.SameName(name, filepath.Join(dir, "a", "2.txt"))).To(BeFalse())
+
+			prefixedFS := filesystem.NewPrefixed(fsLocal, dir)
+			Expect(prefixedFS.SameName("a/1.txt", "/a/b/../1.txt")).To(BeTrue())
+			Expect(prefixedFS.SameName("/../a/1.txt", "/a/1.txt")).To(BeFalse())
+		})
+	})
+
+	Describe("CreateExcl", func() {
+		It("checks creating a not existing file", func() {
+			name := filepath.Join(dir, "a", "1.txt")
+			f, err := fsLocal.(*filesystem.Local).CreateExcl(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte("content"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			b, err := fsLocal.ReadFile(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal("content"))
+
+			_, err = fsLocal.(*filesystem.Local).CreateExcl(ctx, name)
+			Expect(errors.Is(err, fs.ErrExist)).To(BeTrue())
+			b, err = fsLocal.ReadFile(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal("content"))
+		})
+	})
+
+	Describe("OpenFile", func() {
+		var name string
+		const content = "content 1"
+
+		BeforeEach(func() {
+			name = filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte(content))).To(Succeed())
+		})
+
+		It("checks that O_EXCL fails on existing file", func() {
+			_, err := fsLocal.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+			Expect(errors.Is(err, fs.ErrExist)).To(BeTrue())
+		})
+
+		It("checks that O_RDWR preserves existing content", func() {
+			f, err := fsLocal.OpenFile(ctx, name, os.O_RDWR, 0666)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte("C"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			b, err := fsLocal.ReadFile(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo("Content 1"))
+		})
+	})
+
+	Describe("OpenW", func() {
+		It("checks opening not existing file for writing", func() {
+			name := filepath.Join(dir, "a", "1.txt")
+			const content = "content 1"
+			f, err := fsLocal.OpenW(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			b, err := fsLocal.ReadFile(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeEquivalentTo(content))
+		})
+	})
+
+	Describe("ContentType", func() {
+		It("checks that Stat exposes content type derived from extension", func() {
+			name := filepath.Join(dir, "1.json")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("{}"))).To(Succeed())
+			fi, err := fsLocal.Stat(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			contentTyper, ok := fi.(filesystem.ContentTyper)
+			Expect(ok).To(BeTrue())
+			Expect(contentTyper.ContentType()).To(Equal("application/json"))
+		})
+	})
+
+	Describe("FS", func() {
+		It("checks Stat round-trip through the FileSystem of FileInfo", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+			fi, err := fsLocal.Stat(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.FS()).NotTo(BeNil())
+			Expect(fi.FS()).To(BeIdenticalTo(fsLocal))
+			fi2, err := fi.FS().Stat(ctx, fi.FullName())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi2.FullName()).To(Equal(fi.FullName()))
+			Expect(fi2.Size()).To(Equal(fi.Size()))
+		})
+	})
+
+	Describe("ReadDir", func() {
+		It("checks full names and file systems of entries", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+			fsi, err := fsLocal.ReadDir(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fsi.FullNames()).To(Equal([]string{name}))
+			Expect(fsi[0].FS()).To(BeIdenticalTo(fsLocal))
+		})
+	})
+
+	Describe("Ping", func() {
+		It("checks that Ping succeeds", func() {
+			Expect(fsLocal.(*filesystem.Local).Ping(ctx)).To(Succeed())
+		})
+	})
+
+	Describe("WriteFileInfo", func() {
+		It("checks information of the written file", func() {
+			name := filepath.Join(dir, "a", "1.txt")
+			const content = "content 1"
+			fi, err := fsLocal.WriteFileInfo(ctx, name, []byte(content))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.FullName()).To(Equal(name))
+			Expect(fi.Size()).To(BeEquivalentTo(len(content)))
+		})
+	})
+
+	Describe("SyncOnWrite", func() {
+		var syncs int
+
+		BeforeEach(func() {
+			syncs = 0
+			filesystem.SetFileSync(func(f *os.File) error {
+				syncs++
+				return f.Sync()
+			})
+		})
+
+		AfterEach(func() {
+			filesystem.SetFileSync(nil)
+		})
+
+		It("checks that written files are synced", func() {
+			fsSync := filesystem.NewLocalWithOptions(filesystem.LocalOptions{SyncOnWrite: true})
+			name1, name2, name3 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "2.txt"), filepath.Join(dir, "3.txt")
+			const content = "content 1"
+			Expect(fsSync.WriteFile(ctx, name1, []byte(content))).To(Succeed())
+			Expect(syncs).To(Equal(1))
+			Expect(fsSync.WriteFiles(ctx, []filesystem.FileNameData{
+				{Name: name1, Data: []byte(content)},
+				{Name: name2, Data: []byte(content)},
+			})).To(Succeed())
+			Expect(syncs).To(Equal(3))
+
+			f, err := fsSync.Create(ctx, name3)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncs).To(Equal(3))
+			Expect(f.Close()).To(Succeed())
+			Expect(syncs).To(Equal(4))
+
+			f, err = fsSync.Open(ctx, name3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			Expect(syncs).To(Equal(4), "files opened for reading are not synced")
+
+			for _, name := range []string{name1, name2, name3} {
+				b, err := os.ReadFile(name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(b)).To(Equal(content))
+			}
+		})
+
+		It("checks that written files are not synced by default", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content 1"))).To(Succeed())
+			f, err := fsLocal.OpenW(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			Expect(syncs).To(BeZero())
+		})
+	})
+
+	Describe("ReadFileLimited", func() {
+		const content = "content 1"
+		var name string
+
+		BeforeEach(func() {
+			name = filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte(content))).To(Succeed())
+		})
+
+		It("checks reading a file under the limit", func() {
+			b, err := fsLocal.(*filesystem.Local).ReadFileLimited(ctx, name, int64(len(content)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content))
+		})
+
+		It("checks reading a file over the limit", func() {
+			_, err := fsLocal.(*filesystem.Local).ReadFileLimited(ctx, name, int64(len(content))-1)
+			Expect(err).To(MatchError(filesystem.ErrObjectTooLarge))
+		})
+	})
+
+	Describe("WriteFilesResult", func() {
+		It("checks that only the file which can't be written is reported as failed", func() {
+			notADir := filepath.Join(dir, "file")
+			Expect(fsLocal.WriteFile(ctx, notADir, []byte("content"))).To(Succeed())
+			invalidName := filepath.Join(notADir, "1.txt")
+			files := []filesystem.FileNameData{
+				{Name: filepath.Join(dir, "1.txt"), Data: []byte("content 1")},
+				{Name: invalidName, Data: []byte("content 2")},
+				{Name: filepath.Join(dir, "a", "3.txt"), Data: []byte("content 3")},
+			}
+			failed, err := fsLocal.(*filesystem.Local).WriteFilesResult(ctx, files)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].Name).To(Equal(invalidName))
+			Expect(failed[0].Err).To(HaveOccurred())
+
+			for _, file := range []filesystem.FileNameData{files[0], files[2]} {
+				b, err := os.ReadFile(file.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(Equal(file.Data))
+			}
+		})
+	})
+
+	Describe("ReadFileInto", func() {
+		const content = "content 1"
+		var name string
+
+		BeforeEach(func() {
+			name = filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte(content))).To(Succeed())
+		})
+
+		It("checks reading a file into a buffer of exact size", func() {
+			buf := make([]byte, len(content))
+			n, err := fsLocal.ReadFileInto(ctx, name, buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:n])).To(Equal(content))
+		})
+
+		It("checks reading a file into a larger buffer", func() {
+			buf := make([]byte, 2*len(content))
+			n, err := fsLocal.ReadFileInto(ctx, name, buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:n])).To(Equal(content))
+		})
+
+		It("checks reading a file into a smaller buffer", func() {
+			n, err := fsLocal.ReadFileInto(ctx, name, make([]byte, len(content)-1))
+			Expect(err).To(MatchError(io.ErrShortBuffer))
+			Expect(n).To(BeZero())
+		})
+	})
+
+	Describe("Head", func() {
+		const content = "content 1"
+		var name string
+
+		BeforeEach(func() {
+			name = filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte(content))).To(Succeed())
+		})
+
+		It("checks reading the first bytes of a file", func() {
+			b, err := fsLocal.Head(ctx, name, 4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content[:4]))
+		})
+
+		It("checks reading the first bytes of a file shorter than requested", func() {
+			b, err := fsLocal.Head(ctx, name, int64(2*len(content)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content))
+		})
+
+		It("checks reading the first bytes of a non-existent file", func() {
+			_, err := fsLocal.Head(ctx, filepath.Join(dir, "2.txt"), 4)
+			Expect(fsLocal.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("opening a directory", func() {
+		It("checks that Open, Create and OpenW fail", func() {
+			for _, open := range []func(context.Context, string) (filesystem.File, error){
+				fsLocal.Open, fsLocal.Create, fsLocal.OpenW,
+			} {
+				f, err := open(ctx, dir)
+				Expect(err).To(MatchError(filesystem.ErrIsADirectory))
+				Expect(f).To(BeNil())
+			}
+		})
+
+		It("checks that a regular file is still opened", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+			f, err := fsLocal.Open(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+		})
+	})
+
+	Describe("Prefixed", func() {
+		var (
+			prefixedFS filesystem.FileSystem
+			scope      string
+		)
+		const content = "content"
+
+		BeforeEach(func() {
+			scope = filepath.Join(dir, "scope")
+			prefixedFS = filesystem.NewPrefixed(fsLocal, scope)
+			Expect(prefixedFS.MakePathAll(ctx, "/a")).To(Succeed())
+			Expect(prefixedFS.WriteFile(ctx, "/a/1.txt", []byte(content))).To(Succeed())
+		})
+
+		It("checks that files are written and read inside the prefix", func() {
+			b, err := os.ReadFile(filepath.Join(scope, "a", "1.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content))
+
+			b, err = prefixedFS.ReadFile(ctx, "a/1.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content))
+
+			fi, err := prefixedFS.Stat(ctx, "/a/1.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.FullName()).To(Equal("/a/1.txt"))
+			Expect(fi.FS()).To(Equal(prefixedFS))
+
+			f, err := prefixedFS.Open(ctx, "/a/1.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Name()).To(Equal("/a/1.txt"))
+			Expect(f.Close()).To(Succeed())
+		})
+
+		It("checks that walking is confined to the prefix and names are relative to it", func() {
+			Expect(fsLocal.WriteFile(ctx, filepath.Join(dir, "outside.txt"), []byte(content))).To(Succeed())
+
+			var namesWalked, fullNamesWalked []string
+			Expect(prefixedFS.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				namesWalked, fullNamesWalked = append(namesWalked, name), append(fullNamesWalked, de.FullName())
+				return nil
+			})).To(Succeed())
+			Expect(namesWalked).To(Equal([]string{"/", "/a", "/a/1.txt"}))
+			Expect(fullNamesWalked).To(Equal(namesWalked))
+
+			fsi, err := prefixedFS.ReadDir(ctx, "/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fsi.FullNames()).To(Equal([]string{"/a"}))
+		})
+
+		It("checks that names are relative to the prefix given with a dot", func() {
+			wd, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chdir(dir)).To(Succeed())
+			defer func() { Expect(os.Chdir(wd)).To(Succeed()) }()
+
+			dotPrefixedFS := filesystem.NewPrefixed(filesystem.NewLocal(), "./scope")
+			fsi, err := dotPrefixedFS.ReadDir(ctx, "/a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fsi.FullNames()).To(Equal([]string{"/a/1.txt"}))
+
+			var namesWalked []string
+			Expect(dotPrefixedFS.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				namesWalked = append(namesWalked, de.FullName())
+				return nil
+			})).To(Succeed())
+			Expect(namesWalked).To(Equal([]string{"/", "/a", "/a/1.txt"}))
+		})
+
+		It("checks that names escaping the prefix are rejected", func() {
+			Expect(fsLocal.WriteFile(ctx, filepath.Join(dir, "outside.txt"), []byte(content))).To(Succeed())
+			for _, name := range []string{"../outside.txt", "/../outside.txt", "/a/../../outside.txt"} {
+				_, err := prefixedFS.ReadFile(ctx, name)
+				Expect(err).To(MatchError(filesystem.ErrNameEscapesPrefix), "name %q", name)
+			}
+			Expect(prefixedFS.Rename(ctx, "/a/1.txt", "../moved.txt")).To(MatchError(filesystem.ErrNameEscapesPrefix))
+
+			b, err := prefixedFS.ReadFile(ctx, "/a/../a/1.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(content))
+		})
+
+		It("checks that optional operations are passed to the wrapped FileSystem implementing them", func() {
+			Expect(prefixedFS.(filesystem.NoOverwriteRenamer).RenameNoOverwrite(ctx, "/a/1.txt", "/a/2.txt")).
+				To(Succeed())
+			Expect(prefixedFS.(filesystem.Pinger).Ping(ctx)).To(Succeed())
+
+			plainFS := filesystem.NewPrefixed(&readsCountingFS{FileSystem: fsLocal}, scope)
+			Expect(plainFS.(filesystem.NoOverwriteRenamer).RenameNoOverwrite(ctx, "/a/2.txt", "/a/3.txt")).
+				To(MatchError(filesystem.ErrNotSupported))
+			_, err := plainFS.(filesystem.FreeSpacer).FreeSpace(ctx, "/")
+			Expect(err).To(MatchError(filesystem.ErrFreeSpaceUnknown))
+			stats, err := plainFS.(filesystem.StatsWalker).WalkDirWithStats(ctx, "/",
+				func(string, filesystem.DirEntry, error) error { return nil })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats).To(Equal(filesystem.WalkStats{Files: 1, Dirs: 2, Bytes: int64(len(content))}))
+		})
+	})
+
+	Describe("Cached", func() {
+		var (
+			remote   *readsCountingFS
+			cachedFS filesystem.FileSystem
+			name     string
+		)
+		const content1, content2 = "content 1", "content 22"
+
+		BeforeEach(func() {
+			remote = &readsCountingFS{FileSystem: fsLocal}
+			cachedFS = filesystem.NewCached(remote, fsLocal.(*filesystem.Local), filepath.Join(dir, "cache"), time.Hour)
+			name = filepath.Join(dir, "remote", "1.txt")
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name, []byte(content1))).To(Succeed())
+		})
+
+		readFile := func() string {
+			b, err := cachedFS.ReadFile(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			return string(b)
+		}
+
+		It("checks that the second ReadFile hits the cache", func() {
+			Expect(readFile()).To(Equal(content1))
+			Expect(remote.reads).To(Equal(1))
+			Expect(readFile()).To(Equal(content1))
+			Expect(remote.reads).To(Equal(1))
+		})
+
+		It("checks that Reader hits the cache after the file is read entirely", func() {
+			for i := 0; i < 2; i++ {
+				r, err := cachedFS.Reader(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				b, err := io.ReadAll(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(r.Close()).To(Succeed())
+				Expect(string(b)).To(Equal(content1))
+			}
+			Expect(remote.reads).To(Equal(1))
+			Expect(readFile()).To(Equal(content1))
+			Expect(remote.reads).To(Equal(1))
+		})
+
+		It("checks that writing invalidates the cache", func() {
+			Expect(readFile()).To(Equal(content1))
+			Expect(cachedFS.WriteFile(ctx, name, []byte(content2))).To(Succeed())
+			Expect(readFile()).To(Equal(content2))
+			Expect(remote.reads).To(Equal(2))
+
+			f, err := cachedFS.Create(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte(content1))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			Expect(readFile()).To(Equal(content1))
+			Expect(remote.reads).To(Equal(3))
+		})
+
+		It("checks that removing and renaming invalidate the cache", func() {
+			Expect(readFile()).To(Equal(content1))
+			Expect(cachedFS.Remove(ctx, name)).To(Succeed())
+			_, err := cachedFS.ReadFile(ctx, name)
+			Expect(cachedFS.IsNotExist(err)).To(BeTrue())
+
+			Expect(fsLocal.WriteFile(ctx, name, []byte(content1))).To(Succeed())
+			Expect(readFile()).To(Equal(content1))
+			Expect(cachedFS.Rename(ctx, name, name+".moved")).To(Succeed())
+			_, err = cachedFS.ReadFile(ctx, name)
+			Expect(cachedFS.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("checks that an expired copy is not used", func() {
+			cachedFS = filesystem.NewCached(remote, fsLocal.(*filesystem.Local), filepath.Join(dir, "cache"),
+				time.Nanosecond)
+			Expect(readFile()).To(Equal(content1))
+			Expect(readFile()).To(Equal(content1))
+			Expect(remote.reads).To(Equal(2))
+		})
+	})
+
+	Describe("CountObjects", func() {
+		It("checks counting files recursively, directories should not be counted", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "b", "2.txt")
+			Expect(fsLocal.MakePathAll(ctx, filepath.Dir(name2))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name1, []byte("content"))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte("content"))).To(Succeed())
+
+			c, err := fsLocal.CountObjects(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(BeEquivalentTo(2))
+			c, err = fsLocal.CountObjects(ctx, filepath.Join(dir, "a"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(BeEquivalentTo(1))
+
+			ctxCanceled, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = fsLocal.CountObjects(ctxCanceled, dir)
+			Expect(err).To(Equal(context.Canceled))
+		})
+	})
+
+	Describe("Siblings", func() {
+		It("checks siblings of a file", func() {
+			name1, name2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")
+			Expect(fsLocal.WriteFile(ctx, name1, []byte("content"))).To(Succeed())
+			Expect(fsLocal.WriteFile(ctx, name2, []byte("content"))).To(Succeed())
+
+			fi, err := fsLocal.Siblings(ctx, name1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.FullNames()).To(Equal([]string{name2}))
+		})
+
+		It("checks siblings of a file alone in its directory", func() {
+			name := filepath.Join(dir, "1.txt")
+			Expect(fsLocal.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+
+			fi, err := fsLocal.Siblings(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi).NotTo(BeNil())
+			Expect(fi).To(BeEmpty())
+		})
+	})
+
+	Describe("Tee", func() {
+		var (
+			primary, secondary filesystem.FileSystem
+			teeFS              filesystem.FileSystem
+		)
+		const content = "content"
+
+		BeforeEach(func() {
+			primary = filesystem.NewPrefixed(fsLocal, filepath.Join(dir, "primary"))
+			secondary = filesystem.NewPrefixed(fsLocal, filepath.Join(dir, "secondary"))
+			Expect(primary.MakePathAll(ctx, "/")).To(Succeed())
+			Expect(secondary.MakePathAll(ctx, "/")).To(Succeed())
+			teeFS = filesystem.NewTee(primary, secondary)
+		})
+
+		expectContent := func(fsys filesystem.FileSystem, name, expected string) {
+			b, err := fsys.ReadFile(ctx, name)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ExpectWithOffset(1, string(b)).To(Equal(expected))
+		}
+
+		expectNotExists := func(fsys filesystem.FileSystem, name string) {
+			exists, err := fsys.Exists(ctx, name)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ExpectWithOffset(1, exists).To(BeFalse())
+		}
+
+		It("checks that changes are made on both filesystems", func() {
+			Expect(teeFS.WriteFile(ctx, "/1.txt", []byte(content))).To(Succeed())
+			expectContent(primary, "/1.txt", content)
+			expectContent(secondary, "/1.txt", content)
+
+			f, err := teeFS.Create(ctx, "/2.txt")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			expectContent(primary, "/2.txt", content)
+			expectContent(secondary, "/2.txt", content)
+
+			f, err = teeFS.OpenW(ctx, "/2.txt")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte("changed"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			expectContent(primary, "/2.txt", "changed")
+			expectContent(secondary, "/2.txt", "changed")
+
+			Expect(teeFS.MakePathAll(ctx, "/a")).To(Succeed())
+			Expect(teeFS.Rename(ctx, "/1.txt", "/a/1.txt")).To(Succeed())
+			expectNotExists(primary, "/1.txt")
+			expectNotExists(secondary, "/1.txt")
+			expectContent(primary, "/a/1.txt", content)
+			expectContent(secondary, "/a/1.txt", content)
+
+			Expect(teeFS.Remove(ctx, "/2.txt")).To(Succeed())
+			expectNotExists(primary, "/2.txt")
+			expectNotExists(secondary, "/2.txt")
+
+			Expect(teeFS.RemoveAll(ctx, "/a")).To(Succeed())
+			expectNotExists(primary, "/a")
+			expectNotExists(secondary, "/a")
+		})
+
+		It("checks that reads are made from the primary filesystem only", func() {
+			Expect(secondary.WriteFile(ctx, "/1.txt", []byte(content))).To(Succeed())
+			_, err := teeFS.ReadFile(ctx, "/1.txt")
+			Expect(teeFS.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("checks that a failure of the secondary filesystem is logged", func() {
+			logger, hook := logtest.NewNullLogger()
+			teeFS = filesystem.NewTeeWithOptions(primary, failingWritesFS{secondary},
+				filesystem.TeeOptions{Logger: logger})
+
+			Expect(teeFS.WriteFile(ctx, "/1.txt", []byte(content))).To(Succeed())
+			expectContent(primary, "/1.txt", content)
+			expectNotExists(secondary, "/1.txt")
+			Expect(hook.LastEntry()).NotTo(BeNil())
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue(logrus.ErrorKey, errFailingWrites))
+
+			f, err := teeFS.Create(ctx, "/2.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			expectContent(primary, "/2.txt", "")
+			Expect(hook.Entries).To(HaveLen(2))
+		})
+
+		It("checks that a failure of the secondary filesystem fails the operation if configured", func() {
+			teeFS = filesystem.NewTeeWithOptions(primary, failingWritesFS{secondary},
+				filesystem.TeeOptions{FailOnSecondaryError: true})
+
+			Expect(teeFS.WriteFile(ctx, "/1.txt", []byte(content))).To(MatchError(errFailingWrites))
+			expectContent(primary, "/1.txt", content)
+			expectNotExists(secondary, "/1.txt")
+		})
+	})
+})
@@ -0,0 +1,24 @@
+package filesystem
+
+import "io"
+
+// maxSizeReader reads from r until more than remaining bytes are read, then returns ErrObjectTooLarge
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+// Read makes maxSizeReader to implement io.Reader
+func (r *maxSizeReader) Read(p []byte) (n int, err error) {
+	if r.remaining < 0 {
+		return 0, ErrObjectTooLarge
+	}
+	if int64(len(p)) > r.remaining+1 { // one extra byte to detect exceeding
+		p = p[:r.remaining+1]
+	}
+	n, err = r.r.Read(p)
+	if r.remaining -= int64(n); r.remaining < 0 {
+		return n, ErrObjectTooLarge
+	}
+	return
+}
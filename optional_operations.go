@@ -0,0 +1,76 @@
+package filesystem
+
+import "context"
+
+// renameNoOverwriteOf renames the file with fs if it implements NoOverwriteRenamer
+func renameNoOverwriteOf(ctx context.Context, fs FileSystem, from, to string) error {
+	if r, ok := fs.(NoOverwriteRenamer); ok {
+		return r.RenameNoOverwrite(ctx, from, to)
+	}
+	return ErrNotSupported
+}
+
+// writeFilesFromOf writes the files with fs if it implements FilesFromWriter
+func writeFilesFromOf(ctx context.Context, fs FileSystem, files []FileNameReader) error {
+	if fw, ok := fs.(FilesFromWriter); ok {
+		return fw.WriteFilesFrom(ctx, files)
+	}
+	return ErrNotSupported
+}
+
+// chownOf changes the owner of the file with fs if it implements Chowner
+func chownOf(ctx context.Context, fs FileSystem, name string, uid, gid int) error {
+	if c, ok := fs.(Chowner); ok {
+		return c.Chown(ctx, name, uid, gid)
+	}
+	return ErrNotSupported
+}
+
+// pingOf checks availability of fs if it implements Pinger
+func pingOf(ctx context.Context, fs FileSystem) error {
+	if p, ok := fs.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return ErrNotSupported
+}
+
+// walkDirWithStatsOf walks the directory tree with fs. Its WalkDirWithStats is used if it implements StatsWalker,
+// otherwise the totals are counted over its WalkDir
+func walkDirWithStatsOf(ctx context.Context, fs FileSystem, root string, walkDirFunc WalkDirFunc) (WalkStats, error) {
+	if sw, ok := fs.(StatsWalker); ok {
+		return sw.WalkDirWithStats(ctx, root, walkDirFunc)
+	}
+	return walkDirWithStats(ctx, fs.WalkDir, root, walkDirFunc)
+}
+
+// freeSpaceOf returns the available space of fs if it implements FreeSpacer, otherwise it is unknown
+func freeSpaceOf(ctx context.Context, fs FileSystem, name string) (uint64, error) {
+	if fsp, ok := fs.(FreeSpacer); ok {
+		return fsp.FreeSpace(ctx, name)
+	}
+	return 0, ErrFreeSpaceUnknown
+}
+
+// readFileLimitedOf reads the file by name with fs if it implements LimitedFileReader
+func readFileLimitedOf(ctx context.Context, fs FileSystem, name string, maxBytes int64) ([]byte, error) {
+	if lr, ok := fs.(LimitedFileReader); ok {
+		return lr.ReadFileLimited(ctx, name, maxBytes)
+	}
+	return nil, ErrNotSupported
+}
+
+// writeFilesResultOf writes the files with fs if it implements FilesResultWriter
+func writeFilesResultOf(ctx context.Context, fs FileSystem, files []FileNameData) ([]FileNameError, error) {
+	if rw, ok := fs.(FilesResultWriter); ok {
+		return rw.WriteFilesResult(ctx, files)
+	}
+	return nil, ErrNotSupported
+}
+
+// createExclOf creates the file by name with fs if it implements ExclusiveCreator
+func createExclOf(ctx context.Context, fs FileSystem, name string) (File, error) {
+	if ec, ok := fs.(ExclusiveCreator); ok {
+		return ec.CreateExcl(ctx, name)
+	}
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,527 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Prefixed implements FileSystem confining another FileSystem to a directory prefix, like chroot does.
+// Names passed to it are resolved relative to the prefix and names returned by it are rooted at the prefix,
+// i.e. the prefix directory itself is "/". Names escaping the prefix with ".." are rejected with
+// ErrNameEscapesPrefix. Operation callbacks are invoked by the wrapped FileSystem only
+type Prefixed struct {
+	fs     FileSystem
+	prefix string // without trailing slash
+}
+
+// NewPrefixed returns a new FileSystem confining the given one to the given prefix
+func NewPrefixed(fs FileSystem, prefix string) FileSystem {
+	return &Prefixed{fs: fs, prefix: strings.TrimRight(path.Clean(filepath.ToSlash(prefix)), "/")}
+}
+
+// FS returns the wrapped FileSystem
+func (p *Prefixed) FS() FileSystem { return p.fs }
+
+// resolve returns the name of the wrapped FileSystem for the given name.
+// A trailing slash of the name is kept since it denotes a directory for S3
+func (p *Prefixed) resolve(name string) (string, error) {
+	name = filepath.ToSlash(name)
+	cleaned := path.Clean(strings.TrimLeft(name, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrNameEscapesPrefix
+	}
+	resolved := p.prefix + "/"
+	if cleaned != "." {
+		resolved += cleaned
+		if strings.HasSuffix(name, "/") {
+			resolved += "/"
+		}
+	}
+	return resolved, nil
+}
+
+// resolveAll returns the names of the wrapped FileSystem for the given names
+func (p *Prefixed) resolveAll(names ...string) (resolved []string, err error) {
+	resolved = make([]string, len(names))
+	for i, name := range names {
+		if resolved[i], err = p.resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// strip returns the name rooted at the prefix for the given name of the wrapped FileSystem
+func (p *Prefixed) strip(name string) string {
+	name = filepath.ToSlash(name)
+	stripped := path.Clean(name)
+	switch {
+	case stripped == p.prefix:
+		return "/"
+	case strings.HasPrefix(stripped, p.prefix+"/"): // the prefix is stripped only at a path element boundary
+		stripped = strings.TrimPrefix(stripped, p.prefix)
+	}
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(stripped, "/") { // keeping directory trailing slash
+		stripped += "/"
+	}
+	if !strings.HasPrefix(stripped, "/") {
+		stripped = "/" + stripped
+	}
+	return stripped
+}
+
+// wrapFileInfo returns the FileInfo with the name rooted at the prefix
+func (p *Prefixed) wrapFileInfo(fi FileInfo) FileInfo {
+	if fi == nil {
+		return nil
+	}
+	return prefixedFileInfo{FileInfo: fi, p: p}
+}
+
+// wrapFile returns the File with the name rooted at the prefix
+func (p *Prefixed) wrapFile(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return prefixedFile{File: f, p: p}, nil
+}
+
+// wrapWalkDirFunc returns WalkDirFunc receiving names and entries of the wrapped FileSystem
+func (p *Prefixed) wrapWalkDirFunc(walkDirFunc WalkDirFunc) WalkDirFunc {
+	return func(name string, d DirEntry, err error) error {
+		if d != nil {
+			d = prefixedDirEntry{DirEntry: d, p: p}
+		}
+		return walkDirFunc(p.strip(name), d, err)
+	}
+}
+
+// Create makes Prefixed to implement FileSystem
+func (p *Prefixed) Create(ctx context.Context, name string) (File, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.wrapFile(p.fs.Create(ctx, resolved))
+}
+
+// CreateExcl makes Prefixed to implement ExclusiveCreator
+func (p *Prefixed) CreateExcl(ctx context.Context, name string) (File, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.wrapFile(createExclOf(ctx, p.fs, resolved))
+}
+
+// Open makes Prefixed to implement FileSystem
+func (p *Prefixed) Open(ctx context.Context, name string) (File, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.wrapFile(p.fs.Open(ctx, resolved))
+}
+
+// OpenW makes Prefixed to implement FileSystem
+func (p *Prefixed) OpenW(ctx context.Context, name string) (File, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.wrapFile(p.fs.OpenW(ctx, resolved))
+}
+
+// OpenFile makes Prefixed to implement FileSystem
+func (p *Prefixed) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.wrapFile(p.fs.OpenFile(ctx, resolved, flag, perm))
+}
+
+// ReadFile makes Prefixed to implement FileSystem
+func (p *Prefixed) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.fs.ReadFile(ctx, resolved)
+}
+
+// ReadFileLimited makes Prefixed to implement LimitedFileReader
+func (p *Prefixed) ReadFileLimited(ctx context.Context, name string, maxBytes int64) ([]byte, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return readFileLimitedOf(ctx, p.fs, resolved, maxBytes)
+}
+
+// ReadFileInto makes Prefixed to implement FileSystem
+func (p *Prefixed) ReadFileInto(ctx context.Context, name string, buf []byte) (int, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return 0, err
+	}
+	return p.fs.ReadFileInto(ctx, resolved, buf)
+}
+
+// Head makes Prefixed to implement FileSystem
+func (p *Prefixed) Head(ctx context.Context, name string, n int64) ([]byte, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.fs.Head(ctx, resolved, n)
+}
+
+// WriteFile makes Prefixed to implement FileSystem
+func (p *Prefixed) WriteFile(ctx context.Context, name string, b []byte) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.WriteFile(ctx, resolved, b)
+}
+
+// WriteFileInfo makes Prefixed to implement FileSystem
+func (p *Prefixed) WriteFileInfo(ctx context.Context, name string, b []byte) (FileInfo, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := p.fs.WriteFileInfo(ctx, resolved, b)
+	return p.wrapFileInfo(fi), err
+}
+
+// resolveFileNameData returns a copy of the given files with names of the wrapped FileSystem
+func (p *Prefixed) resolveFileNameData(files []FileNameData) (resolved []FileNameData, err error) {
+	resolved = make([]FileNameData, len(files))
+	for i, file := range files {
+		if resolved[i].Name, err = p.resolve(file.Name); err != nil {
+			return nil, err
+		}
+		resolved[i].Data = file.Data
+	}
+	return
+}
+
+// WriteFiles makes Prefixed to implement FileSystem
+func (p *Prefixed) WriteFiles(ctx context.Context, files []FileNameData) error {
+	resolved, err := p.resolveFileNameData(files)
+	if err != nil {
+		return err
+	}
+	return p.fs.WriteFiles(ctx, resolved)
+}
+
+// WriteFilesResult makes Prefixed to implement FilesResultWriter
+func (p *Prefixed) WriteFilesResult(ctx context.Context, files []FileNameData) ([]FileNameError, error) {
+	resolved, err := p.resolveFileNameData(files)
+	if err != nil {
+		return nil, err
+	}
+	failed, err := writeFilesResultOf(ctx, p.fs, resolved)
+	for i := range failed {
+		failed[i].Name = p.strip(failed[i].Name)
+	}
+	return failed, err
+}
+
+// WriteFilesFrom makes Prefixed to implement FilesFromWriter
+func (p *Prefixed) WriteFilesFrom(ctx context.Context, files []FileNameReader) error {
+	resolved := make([]FileNameReader, len(files))
+	for i, file := range files {
+		var err error
+		if resolved[i].Name, err = p.resolve(file.Name); err != nil {
+			return err
+		}
+		resolved[i].Reader, resolved[i].Size = file.Reader, file.Size
+	}
+	return writeFilesFromOf(ctx, p.fs, resolved)
+}
+
+// Reader makes Prefixed to implement FileSystem
+func (p *Prefixed) Reader(ctx context.Context, name string) (io.ReadCloser, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.fs.Reader(ctx, resolved)
+}
+
+// Exists makes Prefixed to implement FileSystem
+func (p *Prefixed) Exists(ctx context.Context, name string) (bool, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return false, err
+	}
+	return p.fs.Exists(ctx, resolved)
+}
+
+// MakePathAll makes Prefixed to implement FileSystem
+func (p *Prefixed) MakePathAll(ctx context.Context, name string) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.MakePathAll(ctx, resolved)
+}
+
+// Remove makes Prefixed to implement FileSystem
+func (p *Prefixed) Remove(ctx context.Context, name string) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.Remove(ctx, resolved)
+}
+
+// RemoveFiles makes Prefixed to implement FileSystem
+func (p *Prefixed) RemoveFiles(ctx context.Context, names []string) error {
+	resolved, err := p.resolveAll(names...)
+	if err != nil {
+		return err
+	}
+	return p.fs.RemoveFiles(ctx, resolved)
+}
+
+// RemoveAll makes Prefixed to implement FileSystem
+func (p *Prefixed) RemoveAll(ctx context.Context, name string) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.RemoveAll(ctx, resolved)
+}
+
+// IsNotExist makes Prefixed to implement FileSystem
+func (p *Prefixed) IsNotExist(err error) bool { return p.fs.IsNotExist(err) }
+
+// IsEmptyPath makes Prefixed to implement FileSystem
+func (p *Prefixed) IsEmptyPath(ctx context.Context, name string) (bool, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return false, err
+	}
+	return p.fs.IsEmptyPath(ctx, resolved)
+}
+
+// PreparePath makes Prefixed to implement FileSystem
+func (p *Prefixed) PreparePath(ctx context.Context, name string) (string, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	prepared, err := p.fs.PreparePath(ctx, resolved)
+	if err != nil || len(prepared) == 0 {
+		return prepared, err
+	}
+	return p.strip(prepared), nil
+}
+
+// Rel makes Prefixed to implement FileSystem
+func (p *Prefixed) Rel(basePath, targPath string) (string, error) {
+	resolved, err := p.resolveAll(basePath, targPath)
+	if err != nil {
+		return "", err
+	}
+	return p.fs.Rel(resolved[0], resolved[1])
+}
+
+// SameName makes Prefixed to implement FileSystem. Names escaping the prefix are never the same
+func (p *Prefixed) SameName(a, b string) bool {
+	resolved, err := p.resolveAll(a, b)
+	if err != nil {
+		return false
+	}
+	return p.fs.SameName(resolved[0], resolved[1])
+}
+
+// Ping makes Prefixed to implement Pinger
+func (p *Prefixed) Ping(ctx context.Context) error { return pingOf(ctx, p.fs) }
+
+// FreeSpace makes Prefixed to implement FreeSpacer
+func (p *Prefixed) FreeSpace(ctx context.Context, name string) (uint64, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return 0, err
+	}
+	return freeSpaceOf(ctx, p.fs, resolved)
+}
+
+// CountObjects makes Prefixed to implement FileSystem
+func (p *Prefixed) CountObjects(ctx context.Context, name string) (int64, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return 0, err
+	}
+	return p.fs.CountObjects(ctx, resolved)
+}
+
+// Rename makes Prefixed to implement FileSystem
+func (p *Prefixed) Rename(ctx context.Context, from, to string) error {
+	resolved, err := p.resolveAll(from, to)
+	if err != nil {
+		return err
+	}
+	return p.fs.Rename(ctx, resolved[0], resolved[1])
+}
+
+// RenameNoOverwrite makes Prefixed to implement NoOverwriteRenamer
+func (p *Prefixed) RenameNoOverwrite(ctx context.Context, from, to string) error {
+	resolved, err := p.resolveAll(from, to)
+	if err != nil {
+		return err
+	}
+	return renameNoOverwriteOf(ctx, p.fs, resolved[0], resolved[1])
+}
+
+// Swap makes Prefixed to implement FileSystem
+func (p *Prefixed) Swap(ctx context.Context, a, b string) error {
+	resolved, err := p.resolveAll(a, b)
+	if err != nil {
+		return err
+	}
+	return p.fs.Swap(ctx, resolved[0], resolved[1])
+}
+
+// Stat makes Prefixed to implement FileSystem
+func (p *Prefixed) Stat(ctx context.Context, name string) (FileInfo, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := p.fs.Stat(ctx, resolved)
+	return p.wrapFileInfo(fi), err
+}
+
+// SetModTime makes Prefixed to implement FileSystem
+func (p *Prefixed) SetModTime(ctx context.Context, name string, t time.Time) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.SetModTime(ctx, resolved, t)
+}
+
+// Chown makes Prefixed to implement Chowner
+func (p *Prefixed) Chown(ctx context.Context, name string, uid, gid int) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return chownOf(ctx, p.fs, resolved, uid, gid)
+}
+
+// ReadDir makes Prefixed to implement FileSystem
+func (p *Prefixed) ReadDir(ctx context.Context, name string) (FilesInfo, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	fsi, err := p.fs.ReadDir(ctx, resolved)
+	for i := range fsi {
+		fsi[i] = p.wrapFileInfo(fsi[i])
+	}
+	return fsi, err
+}
+
+// Siblings makes Prefixed to implement FileSystem
+func (p *Prefixed) Siblings(ctx context.Context, name string) (FilesInfo, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	fsi, err := p.fs.Siblings(ctx, resolved)
+	for i := range fsi {
+		fsi[i] = p.wrapFileInfo(fsi[i])
+	}
+	return fsi, err
+}
+
+// WalkDir makes Prefixed to implement FileSystem
+func (p *Prefixed) WalkDir(ctx context.Context, name string, walkDirFunc WalkDirFunc) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.WalkDir(ctx, resolved, p.wrapWalkDirFunc(walkDirFunc))
+}
+
+// WalkFiles makes Prefixed to implement FileSystem
+func (p *Prefixed) WalkFiles(ctx context.Context, name string, walkFilesFunc WalkFilesFunc) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.WalkFiles(ctx, resolved, func(fi FileInfo, err error) error {
+		return walkFilesFunc(p.wrapFileInfo(fi), err)
+	})
+}
+
+// WalkDirWithStats makes Prefixed to implement StatsWalker
+func (p *Prefixed) WalkDirWithStats(ctx context.Context, name string, walkDirFunc WalkDirFunc) (WalkStats, error) {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return WalkStats{}, err
+	}
+	return walkDirWithStatsOf(ctx, p.fs, resolved, p.wrapWalkDirFunc(walkDirFunc))
+}
+
+// WalkDirWithOptions makes Prefixed to implement FileSystem
+func (p *Prefixed) WalkDirWithOptions(ctx context.Context, name string, walkDirFunc WalkDirFunc,
+	opts WalkDirOptions) error {
+	resolved, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	return p.fs.WalkDirWithOptions(ctx, resolved, p.wrapWalkDirFunc(walkDirFunc), opts)
+}
+
+// prefixedFileInfo is FileInfo of Prefixed
+type prefixedFileInfo struct {
+	FileInfo
+	p *Prefixed
+}
+
+// FullName makes prefixedFileInfo to implement FileInfo. It returns the name rooted at the prefix
+func (fi prefixedFileInfo) FullName() string { return fi.p.strip(fi.FileInfo.FullName()) }
+
+// FS makes prefixedFileInfo to implement FileInfo. It returns Prefixed
+func (fi prefixedFileInfo) FS() FileSystem { return fi.p }
+
+// prefixedDirEntry is DirEntry of Prefixed
+type prefixedDirEntry struct {
+	DirEntry
+	p *Prefixed
+}
+
+// FullName makes prefixedDirEntry to implement DirEntry. It returns the name rooted at the prefix
+func (d prefixedDirEntry) FullName() string { return d.p.strip(d.DirEntry.FullName()) }
+
+// Info makes prefixedDirEntry to implement fs.DirEntry
+func (d prefixedDirEntry) Info() (fs.FileInfo, error) {
+	info, err := d.DirEntry.Info()
+	if fi, ok := info.(FileInfo); ok {
+		return d.p.wrapFileInfo(fi), err
+	}
+	return info, err
+}
+
+// prefixedFile is File of Prefixed
+type prefixedFile struct {
+	File
+	p *Prefixed
+}
+
+// Name makes prefixedFile to implement File. It returns the name rooted at the prefix
+func (f prefixedFile) Name() string { return f.p.strip(f.File.Name()) }
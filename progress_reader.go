@@ -0,0 +1,21 @@
+package filesystem
+
+import "io"
+
+// progressReader reads from r reporting the total amount of bytes read so far to progress
+type progressReader struct {
+	r        io.Reader
+	copied   int64
+	total    int64
+	progress func(copied, total int64)
+}
+
+// Read makes progressReader to implement io.Reader
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if n > 0 {
+		r.copied += int64(n)
+		r.progress(r.copied, r.total)
+	}
+	return
+}
@@ -0,0 +1,8 @@
+package filesystem
+
+// ReadDirOptions are options for reading the directory
+type ReadDirOptions struct {
+	// IncludeStubs makes directory stub objects to be returned as regular file entries instead of being hidden.
+	// It is intended for diagnostics of the empty directories emulation
+	IncludeStubs bool
+}
@@ -1,18 +1,28 @@
 package filesystem
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -24,14 +34,46 @@ const (
 	DirStubFileName    = ".dir" // name of stub file to imitate empty folder
 	DirStubFileContent = "!"    // content of stub file to imitate empty folder
 	TempDir            = "tmp"
+
+	MaxObjectKeyLength = 1024 // max length of S3 object key in bytes
+
+	maxSingleCopySize = 5 << 30 // max size of an object copied by a single request
 )
 
+// writeFilesResultConcurrency is the max amount of objects written concurrently by WriteFilesResult
+const writeFilesResultConcurrency = 8
+
+// dirStubsStatConcurrency is the max amount of directory stubs requested concurrently by ReadDir
+const dirStubsStatConcurrency = 8
+
+// StandardStorageClass is the storage class of S3 objects which are stored without specifying one
+const StandardStorageClass = "STANDARD"
+
+// s3SystemMetadataHeaders are headers of the object system metadata which are lost on replacing its metadata
+// unless they are specified again
+var s3SystemMetadataHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"X-Amz-Website-Redirect-Location",
+	s3StorageClassHeader,
+}
+
 // ErrSkipDir should be returned from WalkDirFunc to skip walking inside directory
 var ErrSkipDir = fs.SkipDir
 
+// ErrStopWalk should be returned from WalkDirFunc to stop walking entirely, WalkDir returns nil in this case
+var ErrStopWalk = errors.New("stop walk")
+
+// ErrWalkTruncated is returned by WalkDirWithOptions if the walk is stopped having visited WalkDirOptions.Limit entries
+var ErrWalkTruncated = errors.New("walk truncated")
+
 // errors
 var (
-	ErrCantOpenS3Directory           = errors.New("can't open S3 directory")
+	ErrIsADirectory                  = errors.New("is a directory")
+	ErrCantOpenS3Directory           = ErrIsADirectory // Deprecated: use ErrIsADirectory
+	ErrCantReadS3Directory           = errors.New("can't read S3 directory")
 	ErrDirectoryNotEmpty             = errors.New("directory not empty")
 	ErrDestinationPathIsNotDirectory = errors.New("destination path is not directory while source is")
 	ErrCantUseRenameWithStubObject   = errors.New("can't use rename with stub object")
@@ -39,15 +81,31 @@ var (
 	ErrNotADirectory                 = errors.New("given path is not a directory")
 	ErrDirectoryNotExists            = errors.New("directory not exists")
 	ErrUnknownFileMode               = errors.New("unknown file mode")
+	ErrTooManyOpenFiles              = errors.New("too many open files")
+	ErrDestinationExists             = errors.New("destination already exists")
+	ErrInvalidName                   = errors.New("invalid name")
+	ErrNameTooLong                   = fmt.Errorf("%w: name is too long", ErrInvalidName)
+	ErrNameContainsControlCharacters = fmt.Errorf("%w: name contains control characters", ErrInvalidName)
+	ErrObjectTooLarge                = errors.New("object is too large")
+	ErrMaxDepthExceeded              = errors.New("max walk depth exceeded")
+	ErrBucketNotExists               = errors.New("bucket not exists")
+	ErrCantCopyS3Directory           = errors.New("can't copy S3 directory")
+	ErrFreeSpaceUnknown              = errors.New("free space is unknown")
+	ErrNotSupported                  = errors.New("operation is not supported by the file system")
+	ErrNameEscapesPrefix             = errors.New("name escapes the prefix")
+	ErrInvalidPageToken              = errors.New("invalid page token")
+	ErrInvalidPageLimit              = errors.New("page limit should be positive")
 )
 
 // S3 implements FileSystem. The implementation is not concurrent-safe
 type S3 struct {
-	endpoint  string
-	region    string
-	accessKey string
-	secretKey string
-	logger    logrus.FieldLogger
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	instanceID   string // random, names the directory of temporary files and correlates logs
+	logger       logrus.FieldLogger
 
 	useSSL      bool
 	bucketName  string
@@ -57,9 +115,26 @@ type S3 struct {
 	openedFilesList    *S3OpenedFilesList
 	openedFilesTTL     time.Duration
 	openedFilesTempDir string
+	openedFilesClosers int
+	openedFilesSlots   chan struct{} // nil if the number of opened files is not limited
+	maxOpenFilesWait   time.Duration
+
+	inMemoryOpenThreshold int64 // zero means objects are always opened in local temporary files
+
+	statCache     *s3StatCache
+	maxObjectSize int64 // zero means no limit
+	maxWalkDepth  int   // zero means no limit
+
+	copyProgressThreshold int64
+	maxSingleCopySize     int64 // larger objects are copied by parts
+	requesterPays         bool
 
 	emulateEmptyDirs     bool
-	listDirectoryEntries bool
+	listDirectoryEntries bool // guarded by configMu, may be changed by SetListDirectoryEntries
+	stubContentType      string
+	configMu             sync.Mutex
+
+	writeOptions WriteOptions // defaults
 }
 
 // NewS3 returns a pointer to a new Local object
@@ -68,34 +143,74 @@ func NewS3(ctx context.Context, p S3Params) (s3 *S3, err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
 	p.applyDefaults()
+	instanceID := newInstanceID()
 	s3 = &S3{
-		endpoint:   p.Endpoint,
-		region:     p.Region,
-		accessKey:  p.AccessKey,
-		secretKey:  p.SecretKey,
-		useSSL:     p.UseSSL,
-		bucketName: p.BucketName,
-		logger:     p.Logger,
+		endpoint:     p.Endpoint,
+		region:       p.Region,
+		accessKey:    p.AccessKey,
+		secretKey:    p.SecretKey,
+		sessionToken: p.SessionToken,
+		useSSL:       p.UseSSL,
+		bucketName:   p.BucketName,
+		instanceID:   instanceID,
+		logger:       p.Logger.WithFields(logrus.Fields{"bucket": p.BucketName, "instance": instanceID}),
 
 		openedFilesList:    NewS3OpenedFilesList(),
 		openedFilesTTL:     p.OpenedFilesTTL,
 		openedFilesLocalFS: NewLocal().(*Local),
 		openedFilesTempDir: p.OpenedFilesTempDir,
+		openedFilesClosers: p.OpenedFilesClosers,
+		maxOpenFilesWait:   p.MaxOpenFilesWait,
+		maxObjectSize:      p.MaxObjectSize,
+		maxWalkDepth:       p.MaxWalkDepth,
+
+		inMemoryOpenThreshold: p.InMemoryOpenThreshold,
+
+		copyProgressThreshold: p.CopyProgressThreshold,
+		maxSingleCopySize:     maxSingleCopySize,
+		requesterPays:         p.RequesterPays,
 
 		emulateEmptyDirs:     p.EmulateEmptyDirs,
 		listDirectoryEntries: p.ListDirectoryEntries,
+		stubContentType:      p.StubContentType,
+
+		writeOptions: WriteOptions{
+			CacheControl:       p.CacheControl,
+			ContentDisposition: p.ContentDisposition,
+			EnableContentMD5:   p.EnableContentMD5,
+		},
+	}
+	s3.statCache = newS3StatCache(p.StatCacheSize, p.StatCacheTTL, s3.now)
+
+	if p.MaxOpenFiles > 0 {
+		s3.openedFilesSlots = make(chan struct{}, p.MaxOpenFiles)
+	}
+
+	transport := p.Transport
+	if transport == nil {
+		var defaultTransport *http.Transport
+		if defaultTransport, err = minio.DefaultTransport(s3.useSSL); err != nil {
+			return
+		}
+		transport = defaultTransport
+	}
+
+	creds := p.Credentials
+	if creds == nil {
+		creds = credentials.NewStaticV4(s3.accessKey, s3.secretKey, s3.sessionToken)
 	}
 
 	if s3.minioClient, err = minio.New(s3.endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(s3.accessKey, s3.secretKey, ""),
-		Secure: s3.useSSL,
-		Region: s3.region,
+		Creds:     creds,
+		Secure:    s3.useSSL,
+		Region:    s3.region,
+		Transport: &s3Transport{underlying: transport},
 	}); err != nil {
 		return
 	}
@@ -107,24 +222,48 @@ func NewS3(ctx context.Context, p S3Params) (s3 *S3, err error) {
 	if !exists {
 		err = s3.minioClient.MakeBucket(ctx, s3.bucketName, minio.MakeBucketOptions{
 			Region:        s3.region,
-			ObjectLocking: false,
+			ObjectLocking: p.ObjectLocking,
 		})
 	}
-	if s3.emulateEmptyDirs {
+	if s3.emulateEmptyDirs && (p.CreateRootStub == nil || *p.CreateRootStub) {
 		if err = s3.putStubObject(ctx, ""); err != nil {
 			return s3, err
 		}
 	}
 
+	// only the directory of this instance is cleaned, so temporary files of other instances are kept
+	if err = os.RemoveAll(s3.tempDirName()); err != nil {
+		return
+	}
 	go s3.openedFilesListCleaning()
 	return
 }
 
+// newInstanceID returns a random identifier of the S3 instance
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
 // Logger provides access to a logger
 func (s *S3) Logger() logrus.FieldLogger { return s.logger }
 
-// SetListDirectoryEntries or unset it, use mainly for tests
-func (s *S3) SetListDirectoryEntries(v bool) { s.listDirectoryEntries = v }
+// SetListDirectoryEntries or unset it, use mainly for tests. It is safe to call concurrently with other operations
+func (s *S3) SetListDirectoryEntries(v bool) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.listDirectoryEntries = v
+}
+
+// listDirectoryEntriesEnabled returns whether the directory entries are listed in the ReadDir output
+func (s *S3) listDirectoryEntriesEnabled() bool {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	return s.listDirectoryEntries
+}
 
 // MinioClient provides access to Minio Client, use mainly for tests
 func (s *S3) MinioClient() *minio.Client { return s.minioClient }
@@ -132,6 +271,9 @@ func (s *S3) MinioClient() *minio.Client { return s.minioClient }
 // OpenedFilesList provides access to opened files list, use mainly for tests
 func (s *S3) OpenedFilesList() *S3OpenedFilesList { return s.openedFilesList }
 
+// OpenedFiles returns a snapshot of currently opened files
+func (s *S3) OpenedFiles() []OpenedFileInfo { return s.openedFilesList.Snapshot() }
+
 // OpenedFilesListLock locks opened files list associated mutex, use mainly for tests
 func (s *S3) OpenedFilesListLock() { s.openedFilesList.Lock() }
 
@@ -140,6 +282,9 @@ func (s *S3) OpenedFilesListUnlock() { s.openedFilesList.Unlock() }
 
 func (s *S3) now() time.Time { return time.Now() }
 
+// sniffLen is the max amount of bytes used by http.DetectContentType
+const sniffLen = 512
+
 var driveLetterRegexp = regexp.MustCompile(`^[A-Za-z?]:`)
 
 func (s *S3) nameToDir(name string) string {
@@ -181,6 +326,30 @@ func (s *S3) normalizeName(name string) string {
 	return name
 }
 
+// NormalizeName returns the canonical form of the object name as it will be used by S3 FileSystem.
+// Returns an error wrapping ErrInvalidName if the resulting object key is too long or contains control characters
+func (s *S3) NormalizeName(name string) (string, error) {
+	name = s.normalizeName(name)
+	if len(strings.TrimPrefix(name, "/")) > MaxObjectKeyLength {
+		return "", ErrNameTooLong
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", ErrNameContainsControlCharacters
+	}
+	return name, nil
+}
+
+// normalizeNames replaces the given names with their canonical forms like NormalizeName does,
+// the first validation error is returned
+func (s *S3) normalizeNames(names ...*string) (err error) {
+	for _, name := range names {
+		if *name, err = s.NormalizeName(*name); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (s *S3) openedFilesListCleaning() {
 	for range time.NewTicker(s.openedFilesTTL).C {
 		var s3FilesToClose []*S3OpenedFile
@@ -194,91 +363,215 @@ func (s *S3) openedFilesListCleaning() {
 				s3FilesToClose = append(s3FilesToClose, s.openedFilesList.m[key].S3File)
 			}
 		}()
-		for _, s3File := range s3FilesToClose {
-			s.logger.Infof("openedFilesListCleaning: autoclosing file %q", s3File.localName)
+		s.closeOpenedFiles(s3FilesToClose)
+	}
+}
+
+// closeOpenedFiles closes the given opened files concurrently by at most openedFilesClosers workers.
+// Errors are logged for each file
+func (s *S3) closeOpenedFiles(s3Files []*S3OpenedFile) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, s.openedFilesClosers)
+	for _, s3File := range s3Files {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(s3File *S3OpenedFile) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			logger := s.logger.WithFields(logrus.Fields{"op": "openedFilesListCleaning", "file": s3File.localName})
+			logger.Info("autoclosing file")
 			if err := s3File.Close(); err != nil {
-				s.logger.Errorf("openedFilesListCleaning: failed to s3File.Close(): %v", err)
+				logger.WithError(err).Error("failed to close file")
 			}
-		}
+		}(s3File)
 	}
+	wg.Wait()
 }
 
-// TempFileName converts file name to a temporary file name
-func (s *S3) TempFileName(name string) string {
-	return filepath.Join(s.openedFilesTempDir, TempDir, strings.ReplaceAll(name, "/", "__"))
+// acquireOpenedFileSlot takes a slot for a file to be opened. If there are no free slots
+// it waits for one according to maxOpenFilesWait
+func (s *S3) acquireOpenedFileSlot(ctx context.Context) error {
+	if s.openedFilesSlots == nil {
+		return nil
+	}
+	select {
+	case s.openedFilesSlots <- struct{}{}:
+		return nil
+	default:
+	}
+	if s.maxOpenFilesWait == 0 {
+		return ErrTooManyOpenFiles
+	}
+
+	var timeoutC <-chan time.Time
+	if s.maxOpenFilesWait > 0 {
+		timer := time.NewTimer(s.maxOpenFilesWait)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	select {
+	case s.openedFilesSlots <- struct{}{}:
+		return nil
+	case <-timeoutC:
+		return ErrTooManyOpenFiles
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-const (
-	fileModeOpen = iota
-	fileModeCreate
-	fileModeWrite
-)
+// releaseOpenedFileSlot frees a slot taken by acquireOpenedFileSlot
+func (s *S3) releaseOpenedFileSlot() {
+	if s.openedFilesSlots == nil {
+		return
+	}
+	select {
+	case <-s.openedFilesSlots:
+	default:
+	}
+}
+
+// deleteOpenedFilesListEntry unlocks and deletes opened files list entry and frees it's slot
+func (s *S3) deleteOpenedFilesListEntry(localFileName string) {
+	if s.openedFilesList.DeleteAndUnlockEntry(localFileName) {
+		s.releaseOpenedFileSlot()
+	}
+}
+
+// tempDirName returns the name of the directory of temporary files of the instance.
+// It is named by the bucket and the instance ID, so different instances never share it
+func (s *S3) tempDirName() string {
+	return filepath.Join(s.openedFilesTempDir, TempDir, s.bucketName, s.instanceID)
+}
 
-func (s *S3) openFile(ctx context.Context, name string, fileMode int) (f File, err error) {
+// TempFileName converts file name to a temporary file name.
+// The name is percent-encoded, so different names are never converted to the same temporary file name.
+// Temporary files are placed into the directory of the instance, so different instances never share them
+func (s *S3) TempFileName(name string) string {
+	return filepath.Join(s.tempDirName(), url.PathEscape(name))
+}
+
+// openFile opens a local copy of the object with the given flags (os.O_*). The existence-related flags
+// (os.O_CREATE, os.O_EXCL, os.O_TRUNC) are applied to the S3 object, others are applied to the local file.
+// If fresh is true, changes of the file opened with the same name are flushed and a separate local copy is opened
+func (s *S3) openFile(ctx context.Context, name string, flag int, fresh bool) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	if fileMode > fileModeWrite || fileMode < fileModeOpen {
+	if flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) > os.O_RDWR {
 		return nil, ErrUnknownFileMode
 	}
-	if name = s.normalizeName(name); s.nameIsADirectory(name) {
-		return nil, ErrCantOpenS3Directory
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if s.nameIsADirectory(name) {
+		return nil, ErrIsADirectory
+	}
+
+	create, exclusive, truncate := flag&os.O_CREATE != 0, flag&os.O_EXCL != 0, flag&os.O_TRUNC != 0
+	if (create && exclusive) || (truncate && !create) { // object existence should be checked beforehand
+		if _, err = s.minioClient.StatObject(ctx, s.bucketName, name, s.statObjectOptions()); err == nil {
+			if create && exclusive {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+			}
+		} else if !s.IsNotExist(err) || !create {
+			return nil, err
+		}
+		err = nil
 	}
 
 	localFileName := s.TempFileName(name)
 
-	var s3OpenedFile *S3OpenedFilesListEntry
-	func() { // checking lock on entry
-		s.OpenedFilesListLock()
-		defer s.OpenedFilesListUnlock()
-		s3OpenedFile, _ = s.openedFilesList.Map()[localFileName]
-	}()
+	if fresh {
+		var holder *S3OpenedFile
+		func() { // checking lock on entry
+			s.OpenedFilesListLock()
+			defer s.OpenedFilesListUnlock()
+			if entry := s.openedFilesList.Map()[localFileName]; entry != nil {
+				holder = entry.S3File
+			}
+		}()
+		if holder != nil {
+			if err = holder.flush(ctx); err != nil {
+				return nil, err
+			}
+		}
+		localFileName += "." + newInstanceID()
+	}
 
 	if err = s.openedFilesLocalFS.MakePathAll(ctx, filepath.Dir(localFileName)); err != nil {
 		return nil, err
 	}
 
-	if s3OpenedFile == nil {
-		s3OpenedFile = &S3OpenedFilesListEntry{
-			Added: s.now(),
-			S3File: &S3OpenedFile{
-				ctx:        ctx,
-				s3:         s,
-				underlying: nil, // to be written below
-				localName:  localFileName,
-				objectName: name,
-			},
-		}
+	if err = s.acquireOpenedFileSlot(ctx); err != nil {
+		return nil, err
 	}
-	s.openedFilesList.AddAndLockEntry(localFileName, s3OpenedFile)
+	// each opening gets its own S3OpenedFile, so closing a stale handle never closes the one of the next holder
+	s3OpenedFile := s.openedFilesList.lockEntry(localFileName, s.now(), &S3OpenedFile{
+		ctx:        withoutOperationMark(ctx), // it is used for operations on closing
+		s3:         s,
+		underlying: nil, // to be written below
+		localName:  localFileName,
+		objectName: name,
+	})
 
 	defer func() {
 		if err == nil {
 			return
 		}
-		s.openedFilesList.DeleteAndUnlockEntry(localFileName)
+		s.deleteOpenedFilesListEntry(localFileName)
 		if f != nil {
 			_ = f.Close()
 		}
 	}()
 
-	if fileMode != fileModeCreate { // fileModeOpen or fileModeWrite, so we create local file from S3 object
-		var object *minio.Object
-		if object, err = s.minioClient.GetObject(ctx, s.bucketName, name, minio.GetObjectOptions{}); err != nil {
+	// the object should be written on closing if it is truncated or created
+	s3OpenedFile.S3File.changed, s3OpenedFile.S3File.exclusive = truncate, create && exclusive
+	var object *minio.Object // nil if the object is truncated or does not exist
+	var size int64
+	if !truncate {
+		if object, err = s.minioClient.GetObject(ctx, s.bucketName, name, s.getObjectOptions()); err != nil {
+			return nil, err
+		}
+		var objectInfo minio.ObjectInfo
+		if objectInfo, err = object.Stat(); err != nil {
+			if !create || !s.IsNotExist(err) {
+				return nil, err
+			}
+			object, err = nil, nil
+			s3OpenedFile.S3File.changed = true // the file is left empty
+		}
+		size = objectInfo.Size
+	}
+
+	// truncated and created objects may grow unlimitedly, so only existing small objects are opened in memory
+	if object != nil && size < s.inMemoryOpenThreshold {
+		var b []byte
+		if b, err = io.ReadAll(object); err != nil {
 			return nil, err
 		}
+		f = newS3MemFile(localFileName, b, flag)
+		s3OpenedFile.S3File.SetUnderlying(f)
+		return s3OpenedFile.S3File, nil
+	}
+
+	if !truncate { // so we create local file from S3 object
 		if err = func() error {
 			localFile, err := s.openedFilesLocalFS.Create(ctx, localFileName)
 			if err != nil {
 				return err
 			}
 			defer localFile.Close()
+			if object == nil { // the local file is left empty
+				return nil
+			}
 			_, err = io.Copy(localFile, object)
 			return err
 		}(); err != nil {
@@ -286,14 +579,7 @@ func (s *S3) openFile(ctx context.Context, name string, fileMode int) (f File, e
 		}
 	}
 
-	switch fileMode {
-	case fileModeOpen:
-		f, err = s.openedFilesLocalFS.Open(ctx, localFileName)
-	case fileModeCreate:
-		f, err = s.openedFilesLocalFS.Create(ctx, localFileName)
-	case fileModeWrite:
-		f, err = s.openedFilesLocalFS.OpenW(ctx, localFileName)
-	}
+	f, err = s.openedFilesLocalFS.OpenFile(ctx, localFileName, flag&^os.O_EXCL|os.O_CREATE, 0666)
 	s3OpenedFile.S3File.SetUnderlying(f)
 
 	return s3OpenedFile.S3File, err
@@ -309,91 +595,95 @@ func (s *S3) Open(ctx context.Context, name string) (f File, err error) {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	return s.openFile(ctx, name, fileModeOpen)
+	return s.openFile(ctx, name, os.O_RDONLY, false)
 }
 
-// Create file with given name in the client's bucket.
-// A file will be created locally for reading, writing, truncating.
-// To remove the actual local file and write out into S3 object
-// it should be properly closed by calling Close() on the caller's side.
-// Calls to Open, Create, OpenW and S3OpenedFile.Close are concurrent-safe and mutually locking.
-func (s *S3) Create(ctx context.Context, name string) (f File, err error) {
+// OpenFresh opens file with given name in the client's bucket for reading like Open does, but does not wait for
+// the file opened with the same name to be closed. Instead, changes of that file are written into S3 storage
+// and the object is downloaded into a separate local file, so the returned File reflects the latest changes.
+func (s *S3) OpenFresh(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	if dir := path.Dir(name); dir != "." && dir != "/" {
-		if err = s.MakePathAll(ctx, dir); err != nil {
-			return
-		}
-	}
-	return s.openFile(ctx, name, fileModeCreate)
+	return s.openFile(ctx, name, os.O_RDONLY, true)
 }
 
-// OpenW opens file in the FileSystem for writing.
-// An object will be downloaded from S3 storage and opened as a local file for writing.
+// Create file with given name in the client's bucket.
+// A file will be created locally for reading, writing, truncating.
 // To remove the actual local file and write out into S3 object
 // it should be properly closed by calling Close() on the caller's side.
 // Calls to Open, Create, OpenW and S3OpenedFile.Close are concurrent-safe and mutually locking.
-func (s *S3) OpenW(ctx context.Context, name string) (f File, err error) {
+func (s *S3) Create(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	if dir := path.Dir(name); dir != "." && dir != "/" {
-		if err = s.MakePathAll(ctx, dir); err != nil {
-			return
+	if s.emulateEmptyDirs {
+		if dir := path.Dir(name); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
 		}
 	}
-	return s.openFile(ctx, name, fileModeWrite)
+	return s.openFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, false)
 }
 
-// ReadFile by it's name from the client's bucket
-func (s *S3) ReadFile(ctx context.Context, name string) (b []byte, err error) {
+// CreateExcl creates file with given name in the client's bucket like Create does, but returns an error
+// satisfying errors.Is(err, fs.ErrExist) if the object already exists. The object is written on closing
+// only if it still does not exist, otherwise Close returns such an error, so concurrent creators don't overwrite
+// each other
+func (s *S3) CreateExcl(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	var o *minio.Object
-	if o, err = s.minioClient.GetObject(ctx, s.bucketName, name, minio.GetObjectOptions{}); err != nil {
-		return
+	if s.emulateEmptyDirs {
+		if dir := path.Dir(name); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
+		}
 	}
-	return io.ReadAll(o)
+	return s.openFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_TRUNC, false)
 }
 
-// WriteFile by it's name to the client's bucket
-func (s *S3) WriteFile(ctx context.Context, name string, b []byte) (err error) {
+// OpenW opens file in the FileSystem for writing.
+// An object will be downloaded from S3 storage and opened as a local file for writing.
+// If the object does not exist, it will be created on closing.
+// To remove the actual local file and write out into S3 object
+// it should be properly closed by calling Close() on the caller's side.
+// Calls to Open, Create, OpenW and S3OpenedFile.Close are concurrent-safe and mutually locking.
+func (s *S3) OpenW(ctx context.Context, name string) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
 	if s.emulateEmptyDirs {
 		if dir := path.Dir(name); dir != "." && dir != "/" {
 			if err = s.MakePathAll(ctx, dir); err != nil {
@@ -401,575 +691,2156 @@ func (s *S3) WriteFile(ctx context.Context, name string, b []byte) (err error) {
 			}
 		}
 	}
-	_, err = s.minioClient.PutObject(ctx, s.bucketName, name, bytes.NewReader(b), int64(len(b)),
-		minio.PutObjectOptions{ContentType: http.DetectContentType(b)})
-	return err
+	return s.openFile(ctx, name, os.O_WRONLY|os.O_CREATE, false)
 }
 
-// WriteFiles by the data given. An archive will be created by the underlying minio client
-func (s *S3) WriteFiles(ctx context.Context, f []FileNameData) (err error) {
+// OpenFile opens file with given name in the client's bucket with the given flags (os.O_*).
+// An object will be downloaded from S3 storage unless os.O_TRUNC is given, and opened as a local file.
+// os.O_CREATE, os.O_EXCL and os.O_TRUNC are applied to the S3 object. The perm is ignored.
+// To remove the actual local file and write out into S3 object
+// it should be properly closed by calling Close() on the caller's side.
+// Calls to Open, Create, OpenW, OpenFile and S3OpenedFile.Close are concurrent-safe and mutually locking.
+func (s *S3) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (f File, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	snowBallC := make(chan minio.SnowballObject)
-	for i, el := range f {
-		f[i].Name = s.normalizeName(el.Name)
-		if s.emulateEmptyDirs {
-			// todo may be optimized if many files have to be written in same subdir structure via a tree
-			if dir := path.Dir(el.Name); dir != "." && dir != "/" {
-				if err = s.MakePathAll(ctx, dir); err != nil {
-					return
-				}
+	if flag&os.O_CREATE != 0 && s.emulateEmptyDirs {
+		if dir := path.Dir(name); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
 			}
 		}
 	}
-	go func() {
-		for i := range f {
-			snowBallC <- minio.SnowballObject{
-				Key:     f[i].Name,
-				Size:    int64(len(f[i].Data)),
-				ModTime: s.now(),
-				Content: bytes.NewReader(f[i].Data),
-			}
-		}
-		close(snowBallC)
-	}()
-	return s.minioClient.PutObjectsSnowball(ctx, s.bucketName, minio.SnowballOptions{Compress: true}, snowBallC)
+	return s.openFile(ctx, name, flag, false)
 }
 
-// Reader returns reader by it's name
-func (s *S3) Reader(ctx context.Context, name string) (r io.ReadCloser, err error) {
+// OpenDir opens a directory with given name in the client's bucket for reading its entries.
+// Entries are listed at the moment of opening the directory.
+func (s *S3) OpenDir(ctx context.Context, name string) (df *S3DirFile, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	return s.minioClient.GetObject(ctx, s.bucketName, name, minio.GetObjectOptions{})
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	name = s.nameToDir(s.stubToDir(name))
+	df = &S3DirFile{}
+	if df.fi, err = s.Stat(ctx, name); err != nil {
+		return nil, err
+	}
+	var fsi FilesInfo
+	if fsi, err = s.ReadDir(ctx, name); err != nil {
+		return nil, err
+	}
+	df.entries = make(FilesInfo, 0, len(fsi))
+	for _, fi := range fsi {
+		if !s.nameIsADirectoryStub(fi.FullName()) {
+			df.entries = append(df.entries, fi)
+		}
+	}
+	sort.Slice(df.entries, func(i, j int) bool { return df.entries[i].FullName() < df.entries[j].FullName() })
+	return df, nil
 }
 
-// Count returns count of items in a folder. May count in childs also if recursive param set to true.
-func (s *S3) Count(ctx context.Context, name string, recursive bool,
-	countFunc func(oi minio.ObjectInfo, num int64) (proceed bool, e error)) (c int64, err error) {
+// ReadFile by it's name from the client's bucket
+func (s *S3) ReadFile(ctx context.Context, name string) (b []byte, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithCancel(ctx)
-	defer cancel()
-	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    name,
-		Recursive: recursive,
-	}) {
-		c++
-		if countFunc != nil {
-			proceed, e := countFunc(objectInfo, c)
-			if !proceed {
-				break
-			}
-			if e != nil {
-				return c, e
-			}
-		}
-		if objectInfo.Err != nil {
-			return c, objectInfo.Err
-		}
+	if name, err = s.NormalizeName(name); err != nil {
+		return
 	}
-	return c, nil
+	var o *minio.Object
+	if o, err = s.minioClient.GetObject(ctx, s.bucketName, name, s.getObjectOptions()); err != nil {
+		return
+	}
+	return io.ReadAll(o)
 }
 
-// Exists checks whether an object exists
-func (s *S3) Exists(ctx context.Context, name string) (e bool, err error) {
+// ReadFileLimited reads the object by it's name like ReadFile does, but returns ErrObjectTooLarge
+// if the object is larger than maxBytes
+func (s *S3) ReadFileLimited(ctx context.Context, name string, maxBytes int64) (b []byte, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	if !s.nameIsADirectoryPath(name) { // not a folder
-		_, err = s.minioClient.StatObject(ctx, s.bucketName, name, minio.StatObjectOptions{})
-		switch {
-		case err == nil:
-			return true, nil
-		case s.IsNotExist(err):
-			return false, nil
-		default:
-			return false, err
-		}
+	if name, err = s.NormalizeName(name); err != nil {
+		return
 	}
-
-	// if name is a folder path
-	// we may check for just a stub file. But we do a more thorough check
-	// for a case if stub file will not exist.
-	var count int64
-	count, err = s.Count(ctx, name, true, nil)
-	return count > 0, err
+	var o *minio.Object
+	if o, err = s.minioClient.GetObject(ctx, s.bucketName, name, s.getObjectOptions()); err != nil {
+		return
+	}
+	defer func() { _ = o.Close() }()
+	var objectInfo minio.ObjectInfo
+	if objectInfo, err = o.Stat(); err != nil {
+		return
+	}
+	if objectInfo.Size > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	return io.ReadAll(&maxSizeReader{r: o, remaining: maxBytes}) // in case the object is replaced while reading
 }
 
-func (s *S3) putStubObject(ctx context.Context, name string) (err error) {
+// ReadFileInto reads the object by it's name into buf and returns the amount of bytes read.
+// If the object is larger than buf, nothing is read and the error wrapping io.ErrShortBuffer is returned
+func (s *S3) ReadFileInto(ctx context.Context, name string, buf []byte) (n int, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.nameToStub(name)
-	_, err = s.minioClient.PutObject(ctx, s.bucketName, name, strings.NewReader(DirStubFileContent),
-		int64(len(DirStubFileContent)), minio.PutObjectOptions{
-			DisableMultipart: true,
-			ContentType:      "text/plain",
-		})
-	return
-}
-
-// MakePathAll does nothing in S3 FileSystem. As a workaround to make sure that we have a precreated folder,
-// we create a small file in it.
-// refer to: https://github.com/minio/minio/issues/3555, https://github.com/minio/minio/issues/2423
-func (s *S3) MakePathAll(ctx context.Context, name string) (err error) {
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	var o *minio.Object
+	if o, err = s.minioClient.GetObject(ctx, s.bucketName, name, s.getObjectOptions()); err != nil {
+		return
+	}
+	defer func() { _ = o.Close() }()
+	var objectInfo minio.ObjectInfo
+	if objectInfo, err = o.Stat(); err != nil {
+		return
+	}
+	if objectInfo.Size > int64(len(buf)) {
+		return 0, fmt.Errorf("%w: object size is %d", io.ErrShortBuffer, objectInfo.Size)
+	}
+	return io.ReadFull(o, buf[:objectInfo.Size])
+}
+
+// Head reads at most n first bytes of the object by it's name with a ranged request.
+// If the object is shorter than n bytes, it is read entirely
+func (s *S3) Head(ctx context.Context, name string, n int64) (b []byte, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if n <= 0 {
+		_, err = s.minioClient.StatObject(ctx, s.bucketName, name, s.statObjectOptions())
+		return []byte{}, err
+	}
+	opts := s.getObjectOptions()
+	if err = opts.SetRange(0, n-1); err != nil {
+		return
+	}
+	var o *minio.Object
+	if o, err = s.minioClient.GetObject(ctx, s.bucketName, name, opts); err != nil {
+		return
+	}
+	defer func() { _ = o.Close() }()
+	if b, err = io.ReadAll(io.LimitReader(o, n)); minio.ToErrorResponse(err).Code == "InvalidRange" {
+		return []byte{}, nil // the object is empty
+	}
+	return
+}
+
+// WriteFile by it's name to the client's bucket
+func (s *S3) WriteFile(ctx context.Context, name string, b []byte) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	_, err = s.writeFileInfo(ctx, name, b, WriteOptions{})
+	return
+}
+
+// WriteFileWithOptions writes file like WriteFile does with the given options
+func (s *S3) WriteFileWithOptions(ctx context.Context, name string, b []byte, opts WriteOptions) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	_, err = s.writeFileInfo(ctx, name, b, opts)
+	return
+}
+
+// WriteFileInfo writes file like WriteFile does and returns information of the written object.
+// The information is built from the upload result, so no additional Stat request is made
+func (s *S3) WriteFileInfo(ctx context.Context, name string, b []byte) (fi FileInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return s.writeFileInfo(ctx, name, b, WriteOptions{})
+}
+
+// writeFileInfo writes file with the given options and returns information of the written object
+func (s *S3) writeFileInfo(ctx context.Context, name string, b []byte, opts WriteOptions) (fi FileInfo, err error) {
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if s.objectSizeExceeded(int64(len(b))) {
+		return nil, ErrObjectTooLarge
+	}
+	defer s.statCache.invalidate(name)
+	if s.emulateEmptyDirs {
+		if dir := path.Dir(name); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
+		}
+	}
+	contentType := http.DetectContentType(b)
+	var uploadInfo minio.UploadInfo
+	if uploadInfo, err = s.minioClient.PutObject(ctx, s.bucketName, name, bytes.NewReader(b), int64(len(b)),
+		s.putObjectOptions(contentType, opts)); err != nil {
+		return
+	}
+	lastModified := uploadInfo.LastModified
+	if lastModified.IsZero() { // it is not returned by PutObject for single part uploads
+		lastModified = s.now()
+	}
+	return NewS3FileInfo(s, minio.ObjectInfo{
+		Key:          name,
+		Size:         uploadInfo.Size,
+		ETag:         uploadInfo.ETag,
+		LastModified: lastModified,
+		ContentType:  contentType,
+		VersionID:    uploadInfo.VersionID,
+	}), nil
+}
+
+// putObjectOptions returns options to put an object with the given content type and write options,
+// empty write options are replaced by the defaults
+func (s *S3) putObjectOptions(contentType string, opts WriteOptions) minio.PutObjectOptions {
+	if len(opts.CacheControl) == 0 {
+		opts.CacheControl = s.writeOptions.CacheControl
+	}
+	if len(opts.ContentDisposition) == 0 {
+		opts.ContentDisposition = s.writeOptions.ContentDisposition
+	}
+	putOpts := minio.PutObjectOptions{
+		ContentType:        contentType,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+		SendContentMd5:     opts.EnableContentMD5 || s.writeOptions.EnableContentMD5,
+	}
+	if opts.ExpireAfter > 0 {
+		putOpts.UserTags = map[string]string{ExpireTagKey: s.now().Add(opts.ExpireAfter).UTC().Format(time.RFC3339)}
+	}
+	return putOpts
+}
+
+// objectSizeExceeded returns whether the given object size exceeds the limit
+func (s *S3) objectSizeExceeded(size int64) bool {
+	return s.maxObjectSize > 0 && size > s.maxObjectSize
+}
+
+// WriteFileIfNotExists writes the object only if it does not exist yet, using If-None-Match precondition.
+// If the object already exists, or it was concurrently created by another writer, returns false and no error
+func (s *S3) WriteFileIfNotExists(ctx context.Context, name string, b []byte) (created bool, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if s.objectSizeExceeded(int64(len(b))) {
+		return false, ErrObjectTooLarge
+	}
+	defer s.statCache.invalidate(name)
+	if s.emulateEmptyDirs {
+		if dir := path.Dir(name); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
+		}
+	}
+	_, err = s.minioClient.PutObject(withS3Headers(ctx, http.Header{"If-None-Match": []string{"*"}}),
+		s.bucketName, name, bytes.NewReader(b), int64(len(b)),
+		s.putObjectOptions(http.DetectContentType(b), WriteOptions{}))
+	switch {
+	case err == nil:
+		return true, nil
+	case s.isPreconditionFailed(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// IsTimeout returns whether err is caused by a timeout: either a network or context deadline one,
+// or a request timeout reported by S3
+func (s *S3) IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return true
+	}
+	errorResponse := minio.ToErrorResponse(err)
+	switch errorResponse.Code {
+	case "RequestTimeout", "RequestTimeoutException":
+		return true
+	default:
+		return errorResponse.StatusCode == http.StatusGatewayTimeout
+	}
+}
+
+// IsThrottled returns whether err is caused by S3 requests rate limiting, so the request may be retried later
+func (s *S3) IsThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	errorResponse := minio.ToErrorResponse(err)
+	switch errorResponse.Code {
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests":
+		return true
+	default:
+		return errorResponse.StatusCode == http.StatusServiceUnavailable ||
+			errorResponse.StatusCode == http.StatusTooManyRequests
+	}
+}
+
+// isPreconditionFailed returns whether err is caused by a failed conditional request
+func (s *S3) isPreconditionFailed(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return true
+	default:
+		return false
+	}
+}
+
+// WriteFiles by the data given. An archive will be created by the underlying minio client
+func (s *S3) WriteFiles(ctx context.Context, f []FileNameData) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	for i, el := range f {
+		if f[i].Name, err = s.NormalizeName(el.Name); err != nil {
+			return fmt.Errorf("%w at object %s", err, el.Name)
+		}
+		if s.objectSizeExceeded(int64(len(el.Data))) {
+			return fmt.Errorf("%w at object %s", ErrObjectTooLarge, f[i].Name)
+		}
+	}
+
+	snowBallC := make(chan minio.SnowballObject)
+	for _, el := range f {
+		defer s.statCache.invalidate(el.Name)
+		if s.emulateEmptyDirs {
+			// todo may be optimized if many files have to be written in same subdir structure via a tree
+			if dir := path.Dir(el.Name); dir != "." && dir != "/" {
+				if err = s.MakePathAll(ctx, dir); err != nil {
+					return
+				}
+			}
+		}
+	}
+	// feeder should exit if PutObjectsSnowball returns early and stops receiving
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	go func() {
+		defer close(snowBallC)
+		for i := range f {
+			select {
+			case snowBallC <- minio.SnowballObject{
+				Key:     f[i].Name,
+				Size:    int64(len(f[i].Data)),
+				ModTime: s.now(),
+				Content: bytes.NewReader(f[i].Data),
+			}:
+			case <-ctx1.Done():
+				return
+			}
+		}
+	}()
+	return s.minioClient.PutObjectsSnowball(ctx1, s.bucketName, minio.SnowballOptions{Compress: true}, snowBallC)
+}
+
+// WriteFilesResult writes files like WriteFiles does, but each object is written by a separate request,
+// so the files which failed to be written are reported with their errors while the rest are written.
+// The error is returned if the context is done
+func (s *S3) WriteFilesResult(ctx context.Context, f []FileNameData) (failed []FileNameError, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, writeFilesResultConcurrency)
+	)
+	for _, el := range f {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(el FileNameData) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			name, err := s.NormalizeName(el.Name)
+			if err == nil {
+				err = s.WriteFile(ctx, name, el.Data)
+			}
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, FileNameError{Name: el.Name, Err: err})
+				mu.Unlock()
+			}
+		}(el)
+	}
+	wg.Wait()
+	return failed, ctx.Err()
+}
+
+// WriteFilesFrom writes objects by the data read from the given readers. Each object is streamed
+// by a separate request, so only a small part of data is held in memory at once
+func (s *S3) WriteFilesFrom(ctx context.Context, f []FileNameReader) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	dirsMade := make(map[string]struct{})
+	for _, el := range f {
+		var name string
+		if name, err = s.NormalizeName(el.Name); err != nil {
+			return fmt.Errorf("%w at object %s", err, el.Name)
+		}
+		if s.objectSizeExceeded(el.Size) {
+			return fmt.Errorf("%w at object %s", ErrObjectTooLarge, name)
+		}
+		if s.emulateEmptyDirs {
+			if dir := path.Dir(name); dir != "." && dir != "/" {
+				if _, ok := dirsMade[dir]; !ok {
+					if err = s.MakePathAll(ctx, dir); err != nil {
+						return
+					}
+					dirsMade[dir] = struct{}{}
+				}
+			}
+		}
+
+		reader := el.Reader
+		if s.maxObjectSize > 0 { // the size may be unknown or wrong, so the upload is aborted on exceeding
+			reader = &maxSizeReader{r: reader, remaining: s.maxObjectSize}
+		}
+		r := bufio.NewReaderSize(reader, sniffLen)
+		head, _ := r.Peek(sniffLen) // error will be returned on reading by PutObject
+		_, err = s.minioClient.PutObject(ctx, s.bucketName, name, r, el.Size,
+			s.putObjectOptions(http.DetectContentType(head), WriteOptions{}))
+		s.statCache.invalidate(name)
+		if err != nil {
+			return fmt.Errorf("%w at object %s", err, name)
+		}
+	}
+	return nil
+}
+
+// Reader returns reader by it's name. The returned reader also implements io.WriterTo
+func (s *S3) Reader(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	var object *minio.Object
+	if object, err = s.minioClient.GetObject(ctx, s.bucketName, name, s.getObjectOptions()); err != nil {
+		return
+	}
+	return s3ObjectReader{Object: object}, nil
+}
+
+// CountObjects returns the amount of objects in the directory by name and all its subdirectories.
+// Objects are listed recursively in a streaming manner without keeping them in memory.
+// If EmulateEmptyDirs, directory stub objects are counted too, see CountExcludingStubs
+func (s *S3) CountObjects(ctx context.Context, name string) (c int64, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return s.countObjects(ctx, name, true)
+}
+
+// CountExcludingStubs returns the amount of objects like CountObjects does, but not counting directory stubs
+func (s *S3) CountExcludingStubs(ctx context.Context, name string) (c int64, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return s.countObjects(ctx, name, false)
+}
+
+// countObjects returns the amount of objects in the directory by name recursively, with or without stubs
+func (s *S3) countObjects(ctx context.Context, name string, withStubs bool) (c int64, err error) {
+	name = s.nameToDir(s.stubToDir(s.normalizeName(name)))
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    name,
+		Recursive: true,
+	})) {
+		if objectInfo.Err != nil {
+			return c, objectInfo.Err
+		}
+		if withStubs || !s.nameIsADirectoryStub("/"+strings.TrimPrefix(objectInfo.Key, "/")) {
+			c++
+		}
+	}
+	return c, ctx.Err()
+}
+
+// hasObjects returns whether any object exists with the given prefix. Only a single key is listed,
+// so it is cheap for large directories
+func (s *S3) hasObjects(ctx context.Context, prefix string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the listing after the first key
+	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+		MaxKeys:   1,
+	})) {
+		return objectInfo.Err == nil, objectInfo.Err
+	}
+	return false, nil
+}
+
+// Count returns count of items in a folder. May count in childs also if recursive param set to true.
+func (s *S3) Count(ctx context.Context, name string, recursive bool,
+	countFunc func(oi minio.ObjectInfo, num int64) (proceed bool, e error)) (c int64, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    name,
+		Recursive: recursive,
+	})) {
+		c++
+		if countFunc != nil {
+			proceed, e := countFunc(objectInfo, c)
+			if !proceed {
+				break
+			}
+			if e != nil {
+				return c, e
+			}
+		}
+		if objectInfo.Err != nil {
+			return c, objectInfo.Err
+		}
+	}
+	return c, nil
+}
+
+// ExistsAsDir checks whether a directory by name exists regardless of the trailing slash of the name.
+// So ExistsAsDir("/a/b") checks the directory "/a/b/" while Exists("/a/b") checks the object "/a/b"
+func (s *S3) ExistsAsDir(ctx context.Context, name string) (e bool, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	return s.Exists(ctx, s.nameToDir(s.stubToDir(name)))
+}
+
+// Exists checks whether an object exists. The name is sensitive to the trailing slash: a name with it
+// is checked as a directory, which exists if there are any objects inside it, and a name without it
+// is checked as an object only, see ExistsAsDir
+func (s *S3) Exists(ctx context.Context, name string) (e bool, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if !s.nameIsADirectoryPath(name) { // not a folder
+		if _, ok := s.statCache.get(name); ok {
+			return true, nil
+		}
+		var objectInfo minio.ObjectInfo
+		objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, name, s.statObjectOptions())
+		switch {
+		case err == nil:
+			s.statCache.put(name, objectInfo)
+			return true, nil
+		case s.IsNotExist(err):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	// if name is a folder path
+	// we may check for just a stub file. But we do a more thorough check
+	// for a case if stub file will not exist.
+	var count int64
+	count, err = s.Count(ctx, name, true, nil)
+	return count > 0, err
+}
+
+func (s *S3) putStubObject(ctx context.Context, name string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	name = s.nameToStub(name)
+	defer s.statCache.invalidate(name)
+	_, err = s.minioClient.PutObject(ctx, s.bucketName, name, strings.NewReader(DirStubFileContent),
+		int64(len(DirStubFileContent)), minio.PutObjectOptions{
+			DisableMultipart: true,
+			ContentType:      s.stubContentType,
+		})
+	return
+}
+
+// MakePathAll does nothing in S3 FileSystem. As a workaround to make sure that we have a precreated folder,
+// we create a small file in it.
+// refer to: https://github.com/minio/minio/issues/3555, https://github.com/minio/minio/issues/2423
+func (s *S3) MakePathAll(ctx context.Context, name string) (err error) {
+	if !s.emulateEmptyDirs { // if no empty dirs allowed just do nothing
+		return
+	}
+
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+
+	for ; name != "/"; name = path.Dir(name) {
+		if err = s.putStubObject(ctx, name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MakeDir creates a stub object of only the directory with the given name. Unlike MakePathAll it creates
+// no stubs of parent directories, so it is up to the caller to make sure they exist.
+// It does nothing if empty dirs are not emulated
+func (s *S3) MakeDir(ctx context.Context, name string) (err error) {
+	if !s.emulateEmptyDirs {
+		return
+	}
+
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if name == "/" {
+		return
+	}
+	return s.putStubObject(ctx, name)
+}
+
+// makePathAllOnce works like MakePathAll but skips directories in madeDirs, which are already made.
+// Directories made are added to madeDirs
+func (s *S3) makePathAllOnce(ctx context.Context, name string, madeDirs map[string]struct{}) (err error) {
+	if !s.emulateEmptyDirs {
+		return
+	}
+	for name = strings.TrimSuffix(s.normalizeName(name), "/"); name != "" && name != "/"; name = path.Dir(name) {
+		if _, made := madeDirs[name]; made {
+			return
+		}
+		if err = s.putStubObject(ctx, name); err != nil {
+			return
+		}
+		madeDirs[name] = struct{}{}
+	}
+	return
+}
+
+// RepairStubs creates missing stub objects of directories under the given directory prefix, so every directory
+// containing objects and every directory above it has a stub. It returns the amount of stubs created.
+// It does nothing if empty dirs are not emulated
+func (s *S3) RepairStubs(ctx context.Context, prefix string) (created int, err error) {
+	if !s.emulateEmptyDirs {
+		return
+	}
+
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if prefix, err = s.NormalizeName(prefix); err != nil {
+		return
+	}
+	if !s.nameIsADirectory(prefix) {
+		return 0, ErrNotADirectory
+	}
+	prefix = s.stubToDir(prefix)
+
+	parentDir := func(name string) string { return s.nameToDir(path.Dir(strings.TrimSuffix(name, "/"))) }
+	stubbed, needed := make(map[string]bool), make(map[string]bool)
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	for objectInfo := range s.minioClient.ListObjects(ctx1, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})) {
+		if objectInfo.Err != nil {
+			return created, objectInfo.Err
+		}
+		key := "/" + strings.TrimPrefix(objectInfo.Key, "/")
+		if s.nameIsADirectoryStub(key) {
+			stubbed[parentDir(key)] = true
+		}
+		for dir := parentDir(key); !needed[dir]; dir = parentDir(dir) {
+			needed[dir] = true
+			if dir == "/" {
+				break
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(needed))
+	for dir := range needed {
+		if !stubbed[dir] {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if !strings.HasPrefix(dir, prefix) { // stubs above the prefix are not listed
+			var exists bool
+			if exists, err = s.Exists(ctx, s.nameToStub(dir)); err != nil {
+				return
+			}
+			if exists {
+				continue
+			}
+		}
+		if err = s.putStubObject(ctx, dir); err != nil {
+			return
+		}
+		created++
+	}
+	return
+}
+
+// Remove object by the given name. Returns no error even if object does not exists
+func (s *S3) Remove(ctx context.Context, name string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	name = s.stubToDir(name) // if stub, convert to dir with trailing '/'
+	defer s.statCache.invalidate(name, s.nameToStub(name))
+	if !s.nameIsADirectoryPath(name) { // means was not a stub but a normal object name
+		return s.minioClient.RemoveObject(ctx, s.bucketName, name, minio.RemoveObjectOptions{})
+	}
+	// if nameIsADirectoryPath
+
+	var isEmpty bool
+	if isEmpty, err = s.IsEmptyPath(ctx, name); err != nil {
+		return
+	}
+	if !isEmpty {
+		return ErrDirectoryNotEmpty
+	}
+	// if nameIsADirectoryPath && isEmpty
+
+	if !s.emulateEmptyDirs {
+		return
+	}
+
+	return s.minioClient.RemoveObject(ctx, s.bucketName, s.nameToStub(name), minio.RemoveObjectOptions{})
+}
+
+// RemoveAndPrune removes object like Remove does, then removes its parent directories which became empty,
+// stopping at the first non-empty one. If empty dirs are not emulated, parent directories vanish by themselves
+func (s *S3) RemoveAndPrune(ctx context.Context, name string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	name = s.stubToDir(name)
+	if err = s.Remove(ctx, name); err != nil || !s.emulateEmptyDirs {
+		return
+	}
+
+	parent := func(name string) string { return path.Dir(strings.TrimSuffix(name, "/")) + "/" }
+	for dirName := parent(name); dirName != "/"; dirName = parent(dirName) {
+		var isEmpty bool
+		if isEmpty, err = s.IsEmptyPath(ctx, dirName); err != nil || !isEmpty {
+			return
+		}
+		if err = s.Remove(ctx, dirName); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// RemoveFiles removes multiple objects in batch by the given names.
+// Returns no error even if any object does not exists
+func (s *S3) RemoveFiles(ctx context.Context, names []string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	objectInfoC := make(chan minio.ObjectInfo)
+	idx := make([]int, 0, len(names))
+	for i := range names {
+		if names[i], err = s.NormalizeName(names[i]); err != nil {
+			return
+		}
+		names[i] = s.stubToDir(names[i]) // if stub, convert to dir with trailing '/'
+		defer s.statCache.invalidate(names[i], s.nameToStub(names[i]))
+
+		if !s.nameIsADirectoryPath(names[i]) || !s.emulateEmptyDirs { // means was not a stub but a normal object name
+			idx = append(idx, i)
+			continue
+		}
+		// if nameIsADirectoryPath
+
+		var isEmpty bool
+		if isEmpty, err = s.IsEmptyPath(ctx, names[i]); err != nil {
+			return err
+		}
+		if !isEmpty {
+			return ErrDirectoryNotEmpty
+		}
+		// if nameIsADirectoryPath && isEmpty
+		idx = append(idx, i)
+	}
+
+	go func() {
+		defer close(objectInfoC)
+		for _, i := range idx {
+			objectInfoC <- minio.ObjectInfo{Key: names[i]}
+		}
+	}()
+
+	objectRemoveErrorC := s.minioClient.RemoveObjects(ctx, s.bucketName, objectInfoC, minio.RemoveObjectsOptions{})
+	select {
+	case ore, more := <-objectRemoveErrorC: // if no error, more will be false
+		if more && ore.Err != nil {
+			return fmt.Errorf("%w at object %s", ore.Err, ore.ObjectName)
+		}
+	}
+	return nil
+}
+
+// RemoveAll objects by the given filepath
+func (s *S3) RemoveAll(ctx context.Context, name string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	defer s.statCache.invalidatePrefix(name)
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	objectInfoC := s.minioClient.ListObjects(ctx1, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    name,
+		Recursive: s.nameIsADirectory(name),
+	}))
+
+	ctx2, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+	for roeC := range s.minioClient.RemoveObjects(ctx2, s.bucketName, objectInfoC, minio.RemoveObjectsOptions{}) {
+		if roeC.Err != nil {
+			return roeC.Err
+		}
+	}
+	return nil
+}
+
+// PurgeAllVersions permanently removes all versions and delete markers of objects with names starting with
+// the given prefix, so nothing of them can be restored. It returns the amount of versions and delete markers removed.
+// Objects of a bucket without versioning are just removed
+func (s *S3) PurgeAllVersions(ctx context.Context, prefix string) (purged int, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if prefix, err = s.NormalizeName(prefix); err != nil {
+		return
+	}
+	defer s.statCache.invalidatePrefix(prefix)
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	objectInfoC := s.minioClient.ListObjects(ctx1, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: true,
+	}))
+
+	var (
+		listed  int
+		listErr error
+	)
+	toRemoveC := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(toRemoveC)
+		for objectInfo := range objectInfoC {
+			if objectInfo.Err != nil {
+				listErr = objectInfo.Err
+				return
+			}
+			select {
+			case toRemoveC <- objectInfo:
+				listed++
+			case <-ctx1.Done():
+				return
+			}
+		}
+	}()
+
+	var failed int
+	for roeC := range s.minioClient.RemoveObjects(ctx, s.bucketName, toRemoveC, minio.RemoveObjectsOptions{}) {
+		if roeC.Err != nil {
+			if err == nil {
+				err = roeC.Err
+			}
+			failed++
+		}
+	}
+	// the removal channel is closed only after toRemoveC is closed, so listed and listErr are safe to read
+	if err == nil {
+		err = listErr
+	}
+	return listed - failed, err
+}
+
+// Ping checks that the bucket is reachable with the client's endpoint and credentials
+func (s *S3) Ping(ctx context.Context) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	var exists bool
+	if exists, err = s.minioClient.BucketExists(ctx, s.bucketName); err != nil {
+		return
+	}
+	if !exists {
+		return ErrBucketNotExists
+	}
+	return nil
+}
+
+// FreeSpace makes S3 to implement FreeSpacer. S3 storage is treated as unbounded,
+// so ErrFreeSpaceUnknown is always returned
+func (s *S3) FreeSpace(ctx context.Context, name string) (free uint64, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	return 0, ErrFreeSpaceUnknown
+}
+
+// Rel returns a relative name that is lexically equivalent to targPath when joined to basePath.
+// Both names are normalized first, so the error is never returned. Directory names keep the trailing slash
+func (s *S3) Rel(basePath, targPath string) (string, error) {
+	basePath, targPath = s.normalizeName(basePath), s.normalizeName(targPath)
+	splitName := func(name string) []string {
+		if name = strings.Trim(name, "/"); len(name) == 0 {
+			return nil
+		}
+		return strings.Split(name, "/")
+	}
+	base, targ := splitName(basePath), splitName(targPath)
+
+	i := 0
+	for i < len(base) && i < len(targ) && base[i] == targ[i] {
+		i++
+	}
+	parts := make([]string, 0, len(base)-i+len(targ)-i)
+	for range base[i:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, targ[i:]...)
+	if len(parts) == 0 {
+		return ".", nil
+	}
+	rel := strings.Join(parts, "/")
+	if s.nameIsADirectoryPath(targPath) && i < len(targ) {
+		rel += "/"
+	}
+	return rel, nil
+}
+
+// SameName returns whether names a and b refer to the same object, i.e. their normalized forms are equal.
+// So drive letters and backslashes are not significant, but a trailing slash is since it denotes a directory
+func (s *S3) SameName(a, b string) bool {
+	return s.normalizeName(a) == s.normalizeName(b)
+}
+
+// IsNotExist returns whether err is an 'bucket not exists' error, 'object not exists' error
+// or ErrDirectoryNotExists
+func (s *S3) IsNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == ErrDirectoryNotExists {
+		return true
+	}
+	// look https://github.com/minio/minio-go/issues/1082#issuecomment-468215014 for more details
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsEmptyPath works according to the MakePathAll implementation.
+// Returns true only if specified path contains only a dir stub file.
+func (s *S3) IsEmptyPath(ctx context.Context, name string) (e bool, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	name = s.nameToDir(name)
+
+	// a single pass: not-existing path is empty, existing path is empty
+	// if it contains nothing but a single stub object (if empty dirs are emulated)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var i int
+	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    name,
+		Recursive: true,
+	})) {
+		if objectInfo.Err != nil {
+			return false, objectInfo.Err
+		}
+		if i++; i > 1 || !s.emulateEmptyDirs || !s.nameIsADirectoryStub("/"+objectInfo.Key) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// IsEmptyPathIgnoringStubs returns true if specified path contains no objects except dir stub files,
+// so a path containing only nested empty directories is empty
+func (s *S3) IsEmptyPathIgnoringStubs(ctx context.Context, name string) (e bool, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	name = s.nameToDir(name)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    name,
+		Recursive: true,
+	})) {
+		if objectInfo.Err != nil {
+			return false, objectInfo.Err
+		}
+		if !s.nameIsADirectoryStub("/" + objectInfo.Key) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PreparePath works according to the MakePathAll implementation.
+func (s *S3) PreparePath(ctx context.Context, name string) (_ string, err error) {
 	if !s.emulateEmptyDirs { // if no empty dirs allowed just do nothing
 		return
 	}
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	var exists bool
+	if exists, err = s.Exists(ctx, name); !exists && err == nil {
+		if err = s.MakePathAll(ctx, name); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// Rename object
+func (s *S3) Rename(ctx context.Context, from string, to string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if err = s.normalizeNames(&from, &to); err != nil {
+		return
+	}
+	if from == to {
+		return
+	}
+	defer s.statCache.invalidatePrefix(from)
+	defer s.statCache.invalidatePrefix(to)
+
+	if s.nameIsADirectoryStub(to) || s.nameIsADirectoryStub(from) {
+		return ErrCantUseRenameWithStubObject
+	}
+
+	if !s.nameIsADirectory(from) { // normal object
+		if dir := path.Dir(to); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
+		}
+		objectInfo, ok := s.statCache.get(from)
+		if !ok {
+			if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, from, s.statObjectOptions()); err != nil {
+				return
+			}
+		}
+		if err = s.copyObject(ctx, from, to, objectInfo.Size); err != nil {
+			return
+		}
+		return s.minioClient.RemoveObject(ctx, s.bucketName, from, minio.RemoveObjectOptions{})
+	}
+	// if s.nameIsADirectory(from)
+
+	if !s.nameIsADirectoryPath(to) {
+		return ErrDestinationPathIsNotDirectory
+	}
+
+	var exists bool
+	if exists, err = s.Exists(ctx, from); err != nil {
+		return
+	}
+	if !exists {
+		return ErrRenamingNonExistentDirectory
+	}
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	madeDirs := make(map[string]struct{}) // destination directories having stubs
+	for objectInfo := range s.minioClient.ListObjects(ctx1, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
+		Prefix:    from,
+		Recursive: true,
+	})) {
+		if objectInfo.Err != nil {
+			return objectInfo.Err
+		}
+		// stubs of empty subdirectories are listed too, so they are recreated at the destination
+		objTo := to + strings.TrimPrefix("/"+objectInfo.Key, from)
+		dir := path.Dir(objTo)
+		if s.nameIsADirectoryStub(objTo) { // the stub of dir is created by copying
+			err = s.makePathAllOnce(ctx, path.Dir(dir), madeDirs)
+		} else {
+			err = s.makePathAllOnce(ctx, dir, madeDirs)
+		}
+		if err != nil {
+			return
+		}
+
+		if err = s.copyObject(ctx, objectInfo.Key, objTo, objectInfo.Size); err != nil {
+			return
+		}
+		if s.nameIsADirectoryStub(objTo) {
+			madeDirs[dir] = struct{}{}
+		}
+		if err = s.minioClient.RemoveObject(ctx, s.bucketName, objectInfo.Key, minio.RemoveObjectOptions{}); err != nil {
+			s.logger.WithFields(logrus.Fields{"op": "Rename", "object": objectInfo.Key}).WithError(err).
+				Error("failed to remove object while batch moving")
+			return
+		}
+	}
+	return nil
+}
+
+// copyObject copies the object of the given size server-side. Objects larger than the max size of a single copy
+// request are copied by parts with a multipart upload
+func (s *S3) copyObject(ctx context.Context, from, to string, size int64) (err error) {
+	dst := minio.CopyDestOptions{Bucket: s.bucketName, Object: to}
+	src := minio.CopySrcOptions{Bucket: s.bucketName, Object: from}
+	if size > s.maxSingleCopySize {
+		_, err = s.minioClient.ComposeObject(ctx, dst, src)
+		return
+	}
+	_, err = s.minioClient.CopyObject(ctx, dst, src)
+	return
+}
 
+// RenameNoOverwrite renames object or directory like Rename does, but returns ErrDestinationExists
+// if the destination exists. S3 has no atomic rename, so a destination created concurrently
+// between the check and the renaming may be replaced
+func (s *S3) RenameNoOverwrite(ctx context.Context, from string, to string) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
+	if err = s.normalizeNames(&from, &to); err != nil {
+		return
+	}
+	if from == to {
+		return
+	}
 
-	for ; name != "/"; name = path.Dir(name) {
-		if err = s.putStubObject(ctx, name); err != nil {
+	var exists bool
+	if exists, err = s.Exists(ctx, to); err != nil {
+		return
+	}
+	if exists {
+		return ErrDestinationExists
+	}
+	return s.Rename(ctx, from, to)
+}
+
+// Swap exchanges contents and metadata of the existing objects a and b copying them through a temporary object.
+// If either object does not exist, nothing is modified. S3 has no atomic operations on several objects,
+// so concurrent readers may observe both objects having the same contents while swapping
+func (s *S3) Swap(ctx context.Context, a, b string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if err = s.normalizeNames(&a, &b); err != nil {
+		return
+	}
+	if a == b {
+		return
+	}
+	if s.nameIsADirectory(a) || s.nameIsADirectory(b) {
+		return ErrIsADirectory
+	}
+	sizes := make(map[string]int64, 2)
+	for _, name := range []string{a, b} {
+		var objectInfo minio.ObjectInfo
+		if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, name, s.statObjectOptions()); err != nil {
 			return
 		}
+		sizes[name] = objectInfo.Size
 	}
-	return
+	defer s.statCache.invalidate(a)
+	defer s.statCache.invalidate(b)
+
+	temp := path.Join(path.Dir(a), "."+path.Base(a)+"."+newInstanceID()+".swap")
+	if err = s.copyObject(ctx, a, temp, sizes[a]); err != nil {
+		return
+	}
+	if err = s.copyObject(ctx, b, a, sizes[b]); err != nil {
+		_ = s.minioClient.RemoveObject(ctx, s.bucketName, temp, minio.RemoveObjectOptions{})
+		return
+	}
+	if err = s.copyObject(ctx, temp, b, sizes[a]); err != nil { // the contents of a are kept in the temporary object
+		s.logger.WithFields(logrus.Fields{"op": "Swap", "object": temp}).WithError(err).
+			Error("failed to copy temporary object while swapping")
+		return
+	}
+	return s.minioClient.RemoveObject(ctx, s.bucketName, temp, minio.RemoveObjectOptions{})
 }
 
-// Remove object by the given name. Returns no error even if object does not exists
-func (s *S3) Remove(ctx context.Context, name string) (err error) {
+// PresignedPostPolicy returns URL and form data to upload the object with the given name by HTTP POST request
+// with a multipart form, e.g. directly from a browser. The upload is allowed until the expiry duration passes
+// and only if the object size is not greater than maxSize. Stubs of the parent directories are not created
+// by such an upload, they may be created by MakePathAll or RepairStubs
+func (s *S3) PresignedPostPolicy(ctx context.Context, name string, expiry time.Duration,
+	maxSize int64) (u string, formData map[string]string, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	name = s.stubToDir(name)           // if stub, convert to dir with trailing '/'
-	if !s.nameIsADirectoryPath(name) { // means was not a stub but a normal object name
-		return s.minioClient.RemoveObject(ctx, s.bucketName, name, minio.RemoveObjectOptions{})
+	if name, err = s.NormalizeName(name); err != nil {
+		return
 	}
-	// if nameIsADirectoryPath
+	if s.nameIsADirectory(name) {
+		return "", nil, ErrIsADirectory
+	}
+	policy := minio.NewPostPolicy()
+	if err = policy.SetBucket(s.bucketName); err != nil {
+		return
+	}
+	if err = policy.SetKey(strings.TrimPrefix(name, "/")); err != nil { // leading slash is not stripped from form
+		return
+	}
+	if err = policy.SetExpires(s.now().Add(expiry)); err != nil {
+		return
+	}
+	if err = policy.SetContentLengthRange(0, maxSize); err != nil {
+		return
+	}
+	var postURL *url.URL
+	if postURL, formData, err = s.minioClient.PresignedPostPolicy(ctx, policy); err != nil {
+		return
+	}
+	return postURL.String(), formData, nil
+}
 
-	var isEmpty bool
-	if isEmpty, err = s.IsEmptyPath(ctx, name); err != nil {
+// StorageClass returns the storage class of the object with the given name, it is empty for directories
+func (s *S3) StorageClass(ctx context.Context, name string) (storageClass string, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
-	if !isEmpty {
-		return ErrDirectoryNotEmpty
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
 	}
-	// if nameIsADirectoryPath && isEmpty
+	if s.nameIsADirectory(name) {
+		return "", nil
+	}
+	var fi FileInfo
+	if fi, err = s.Stat(ctx, name); err != nil {
+		return
+	}
+	return fi.(StorageClasser).StorageClass(), nil
+}
 
-	if !s.emulateEmptyDirs {
+// CopyWithProgress copies the object from into the object to. Objects larger than CopyProgressThreshold
+// are streamed through the client reporting the amount of bytes copied to progress, smaller objects are
+// copied server-side and progress is called once after the copying is done. A nil progress reports nothing
+func (s *S3) CopyWithProgress(ctx context.Context, from, to string, progress func(copied, total int64)) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
 
-	return s.minioClient.RemoveObject(ctx, s.bucketName, s.nameToStub(name), minio.RemoveObjectOptions{})
+	if err = s.normalizeNames(&from, &to); err != nil {
+		return
+	}
+	if s.nameIsADirectory(from) || s.nameIsADirectory(to) {
+		return ErrCantCopyS3Directory
+	}
+	if from == to {
+		return
+	}
+	if progress == nil {
+		progress = func(copied, total int64) {}
+	}
+	defer s.statCache.invalidate(to)
+
+	var objectInfo minio.ObjectInfo
+	if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, from, s.statObjectOptions()); err != nil {
+		return
+	}
+	if s.objectSizeExceeded(objectInfo.Size) {
+		return ErrObjectTooLarge
+	}
+
+	if s.emulateEmptyDirs {
+		if dir := path.Dir(to); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
+		}
+	}
+
+	if objectInfo.Size <= s.copyProgressThreshold {
+		if err = s.copyObject(ctx, from, to, objectInfo.Size); err != nil {
+			return
+		}
+		progress(objectInfo.Size, objectInfo.Size)
+		return
+	}
+
+	var object *minio.Object
+	if object, err = s.minioClient.GetObject(ctx, s.bucketName, from, s.getObjectOptions()); err != nil {
+		return
+	}
+	defer func() { _ = object.Close() }()
+	putOpts := s.putObjectOptions(objectInfo.ContentType, WriteOptions{})
+	putOpts.UserMetadata = objectInfo.UserMetadata
+	_, err = s.minioClient.PutObject(ctx, s.bucketName, to,
+		&progressReader{r: object, total: objectInfo.Size, progress: progress}, objectInfo.Size, putOpts)
+	return
 }
 
-// RemoveFiles removes multiple objects in batch by the given names.
-// Returns no error even if any object does not exists
-func (s *S3) RemoveFiles(ctx context.Context, names []string) (err error) {
+// CopyToBucket copies the object srcName into the object dstName of the bucket dstBucket server-side.
+// The destination bucket should exist and be accessible with the same credentials
+func (s *S3) CopyToBucket(ctx context.Context, srcName, dstBucket, dstName string) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	objectInfoC := make(chan minio.ObjectInfo)
-	idx := make([]int, 0, len(names))
-	for i := range names {
-		names[i] = s.normalizeName(names[i])
-		names[i] = s.stubToDir(names[i]) // if stub, convert to dir with trailing '/'
+	if err = s.normalizeNames(&srcName, &dstName); err != nil {
+		return
+	}
+	if s.nameIsADirectory(srcName) || s.nameIsADirectory(dstName) {
+		return ErrCantCopyS3Directory
+	}
 
-		if !s.nameIsADirectoryPath(names[i]) || !s.emulateEmptyDirs { // means was not a stub but a normal object name
-			idx = append(idx, i)
-			continue
+	var exists bool
+	if exists, err = s.minioClient.BucketExists(ctx, dstBucket); err != nil {
+		return
+	}
+	if !exists {
+		return ErrBucketNotExists
+	}
+	if dstBucket == s.bucketName {
+		defer s.statCache.invalidatePrefix(dstName)
+	}
+
+	_, err = s.minioClient.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: dstBucket, Object: dstName},
+		minio.CopySrcOptions{Bucket: s.bucketName, Object: srcName})
+	return
+}
+
+// SyncObject copies the object src into the object dst server-side only if dst does not exist or its ETag differs
+// from the src one, returns whether the object was copied. Objects copied by parts get ETags different
+// from their sources, so they are copied on each sync
+func (s *S3) SyncObject(ctx context.Context, src, dst string) (copied bool, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if err = s.normalizeNames(&src, &dst); err != nil {
+		return
+	}
+	if s.nameIsADirectory(src) || s.nameIsADirectory(dst) {
+		return false, ErrCantCopyS3Directory
+	}
+	if src == dst {
+		return
+	}
+
+	var srcInfo, dstInfo minio.ObjectInfo
+	if srcInfo, err = s.minioClient.StatObject(ctx, s.bucketName, src, s.statObjectOptions()); err != nil {
+		return
+	}
+	if dstInfo, err = s.minioClient.StatObject(ctx, s.bucketName, dst, s.statObjectOptions()); err == nil {
+		if dstInfo.ETag == srcInfo.ETag {
+			return false, nil
 		}
-		// if nameIsADirectoryPath
+	} else if !s.IsNotExist(err) {
+		return
+	}
+	err = nil
 
-		var isEmpty bool
-		if isEmpty, err = s.IsEmptyPath(ctx, names[i]); err != nil {
-			return err
+	if s.emulateEmptyDirs {
+		if dir := path.Dir(dst); dir != "." && dir != "/" {
+			if err = s.MakePathAll(ctx, dir); err != nil {
+				return
+			}
 		}
-		if !isEmpty {
-			return ErrDirectoryNotEmpty
+	}
+	defer s.statCache.invalidate(dst)
+	if err = s.copyObject(ctx, src, dst, srcInfo.Size); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// Stat returns S3 object information as FileInfo interface
+func (s *S3) Stat(ctx context.Context, name string) (fi FileInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if s.nameIsADirectoryPath(name) && s.emulateEmptyDirs {
+		var objectInfo minio.ObjectInfo
+		if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, s.nameToStub(name),
+			s.statObjectOptions()); err != nil {
+			// the root stub may be not created, then the bucket itself represents the root directory
+			if name == "/" && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				return NewS3FileInfoStub(s, name, time.Time{}), nil
+			}
+			return
 		}
-		// if nameIsADirectoryPath && isEmpty
-		idx = append(idx, i)
+		// objectInfo.LastModified may be zero struct
+		return NewS3FileInfoStub(s, name, s3ObjectModTime(objectInfo)), nil
 	}
+	// if !s.nameIsADirectory(name) || !s.emulateEmptyDirs
 
-	go func() {
-		defer close(objectInfoC)
-		for _, i := range idx {
-			objectInfoC <- minio.ObjectInfo{Key: names[i]}
+	if name == "/" { // the bucket itself represents the root directory, it exists even if the bucket is empty
+		return NewS3FileInfoStub(s, name, time.Time{}), nil
+	}
+	if s.nameIsADirectoryPath(name) {
+		var exists bool
+		if exists, err = s.hasObjects(ctx, name); err != nil {
+			return
+		}
+		if exists { // directory virtually exists
+			// modTime is not available when empty dirs are not emulated
+			return NewS3FileInfoStub(s, name, time.Time{}), nil
+		}
+		return nil, ErrDirectoryNotExists
+	}
+	// if (!s.nameIsADirectory(name) || !s.emulateEmptyDirs) && !s.nameIsADirectoryPath(name)
+
+	if objectInfo, ok := s.statCache.get(name); ok {
+		return NewS3FileInfo(s, objectInfo), nil
+	}
+	var objectInfo minio.ObjectInfo
+	if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, name, s.statObjectOptions()); err != nil {
+		return
+	}
+	s.statCache.put(name, objectInfo)
+	return NewS3FileInfo(s, objectInfo), nil
+}
+
+// SetModTime sets modification time of the object. Since S3 doesn't allow to change the last modified time,
+// the given time is stored in the object's user metadata by copying the object onto itself.
+// For a directory it sets modification time of the stub object, or does nothing if empty dirs are not emulated
+func (s *S3) SetModTime(ctx context.Context, name string, t time.Time) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if s.nameIsADirectoryPath(name) {
+		if !s.emulateEmptyDirs {
+			return
 		}
-	}()
+		name = s.nameToStub(name)
+	}
+	defer s.statCache.invalidate(name)
 
-	objectRemoveErrorC := s.minioClient.RemoveObjects(ctx, s.bucketName, objectInfoC, minio.RemoveObjectsOptions{})
-	select {
-	case ore, more := <-objectRemoveErrorC: // if no error, more will be false
-		if more && ore.Err != nil {
-			return fmt.Errorf("%w at object %s", ore.Err, ore.ObjectName)
+	var objectInfo minio.ObjectInfo
+	if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, name, s.statObjectOptions()); err != nil {
+		return
+	}
+	// metadata is replaced entirely, so the existing one should be preserved
+	userMetadata := make(map[string]string, len(objectInfo.UserMetadata)+len(s3SystemMetadataHeaders)+2)
+	for key, value := range objectInfo.UserMetadata {
+		userMetadata[key] = value
+	}
+	userMetadata[s3ModTimeMetadataKey] = t.UTC().Format(time.RFC3339Nano)
+	if len(objectInfo.ContentType) > 0 {
+		userMetadata["Content-Type"] = objectInfo.ContentType
+	}
+	for _, header := range s3SystemMetadataHeaders { // minio passes them as headers, not as user metadata
+		if value := objectInfo.Metadata.Get(header); len(value) > 0 {
+			userMetadata[header] = value
 		}
 	}
-	return nil
+	_, err = s.minioClient.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucketName, Object: name, UserMetadata: userMetadata, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: s.bucketName, Object: name})
+	return
 }
 
-// RemoveAll objects by the given filepath
-func (s *S3) RemoveAll(ctx context.Context, name string) (err error) {
+// SetRetention sets the retention of an object with the given name. The bucket should have object locking enabled
+func (s *S3) SetRetention(ctx context.Context, name string, mode RetentionMode, until time.Time) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	ctx1, cancel1 := context.WithCancel(ctx)
-	defer cancel1()
-	objectInfoC := s.minioClient.ListObjects(ctx1, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    name,
-		Recursive: s.nameIsADirectory(name),
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	minioMode := minio.RetentionMode(mode)
+	return s.minioClient.PutObjectRetention(ctx, s.bucketName, name, minio.PutObjectRetentionOptions{
+		Mode:            &minioMode,
+		RetainUntilDate: &until,
 	})
+}
 
-	ctx2, cancel2 := context.WithCancel(ctx)
-	defer cancel2()
-	for roeC := range s.minioClient.RemoveObjects(ctx2, s.bucketName, objectInfoC, minio.RemoveObjectsOptions{}) {
-		if roeC.Err != nil {
-			return roeC.Err
-		}
+// GetRetention returns the retention mode and the retain until date of an object with the given name
+func (s *S3) GetRetention(ctx context.Context, name string) (mode RetentionMode, until time.Time, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
 	}
-	return nil
-}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
 
-// IsNotExist returns whether err is an 'bucket not exists' error or 'object not exists' error
-func (s *S3) IsNotExist(err error) bool {
-	if err == nil {
-		return false
+	if name, err = s.NormalizeName(name); err != nil {
+		return
 	}
-	// look https://github.com/minio/minio-go/issues/1082#issuecomment-468215014 for more details
-	switch minio.ToErrorResponse(err).Code {
-	case "NoSuchKey", "NoSuchBucket":
-		return true
-	default:
-		return false
+	var (
+		minioMode *minio.RetentionMode
+		untilPtr  *time.Time
+	)
+	if minioMode, untilPtr, err = s.minioClient.GetObjectRetention(ctx, s.bucketName, name, ""); err != nil {
+		return
+	}
+	if minioMode != nil {
+		mode = RetentionMode(*minioMode)
 	}
+	if untilPtr != nil {
+		until = *untilPtr
+	}
+	return
 }
 
-// IsEmptyPath works according to the MakePathAll implementation.
-// Returns true only if specified path contains only a dir stub file.
-func (s *S3) IsEmptyPath(ctx context.Context, name string) (e bool, err error) {
+// ListIncompleteUploads returns multipart uploads of objects with names starting with the given prefix
+// which were initiated but neither completed nor aborted
+func (s *S3) ListIncompleteUploads(ctx context.Context, prefix string) (uploads []IncompleteUpload, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	name = s.nameToDir(name)
-
-	if s.emulateEmptyDirs {
-		var exists bool
-		if exists, err = s.Exists(ctx, name); err != nil {
-			return false, err
-		}
-		if !exists {
-			return true, nil
-		}
-	}
+	return s.listIncompleteUploads(ctx, prefix)
+}
 
+// listIncompleteUploads is ListIncompleteUploads without callbacks invocation
+func (s *S3) listIncompleteUploads(ctx context.Context, prefix string) (uploads []IncompleteUpload, err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	var i int
-	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    name,
-		Recursive: true,
-	}) {
-		if objectInfo.Err != nil {
-			return false, objectInfo.Err
-		}
-		i++
-		if (i > 1 || !s.nameIsADirectoryStub("/"+objectInfo.Key)) && s.emulateEmptyDirs ||
-			i > 0 && !s.emulateEmptyDirs {
-			return false, nil
+	for upload := range s.minioClient.ListIncompleteUploads(ctx, s.bucketName, s.normalizeName(prefix), true) {
+		if upload.Err != nil {
+			return nil, upload.Err
 		}
+		uploads = append(uploads, IncompleteUpload{
+			Name:      "/" + strings.TrimPrefix(upload.Key, "/"),
+			UploadID:  upload.UploadID,
+			Initiated: upload.Initiated,
+			Size:      upload.Size,
+		})
 	}
-	return i == 1 && s.emulateEmptyDirs || i == 0 && !s.emulateEmptyDirs, nil
+	return
 }
 
-// PreparePath works according to the MakePathAll implementation.
-func (s *S3) PreparePath(ctx context.Context, name string) (_ string, err error) {
-	if !s.emulateEmptyDirs { // if no empty dirs allowed just do nothing
-		return
-	}
+// AbortIncompleteUploads aborts multipart uploads of objects with names starting with the given prefix
+// which were initiated but neither completed nor aborted. It returns the number of aborted uploads
+func (s *S3) AbortIncompleteUploads(ctx context.Context, prefix string) (aborted int, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	var exists bool
-	if exists, err = s.Exists(ctx, name); !exists && err == nil {
-		if err = s.MakePathAll(ctx, name); err != nil {
-			return "", err
+	uploads, err := s.listIncompleteUploads(ctx, prefix)
+	if err != nil {
+		return
+	}
+	core := minio.Core{Client: s.minioClient}
+	for _, upload := range uploads {
+		if err = core.AbortMultipartUpload(ctx, s.bucketName, upload.Name, upload.UploadID); err != nil {
+			return
 		}
+		aborted++
 	}
-	return name, nil
+	return
 }
 
-// Rename object
-func (s *S3) Rename(ctx context.Context, from string, to string) (err error) {
+// Chown only validates the name in S3 FileSystem since objects have no owners
+func (s *S3) Chown(ctx context.Context, name string, uid, gid int) (err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	if from, to = s.normalizeName(from), s.normalizeName(to); from == to {
+	_, err = s.NormalizeName(name)
+	return
+}
+
+// ReadDir simulates directory reading by the given name
+func (s *S3) ReadDir(ctx context.Context, name string) (fi FilesInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
 
-	if s.nameIsADirectoryStub(to) || s.nameIsADirectoryStub(from) {
-		return ErrCantUseRenameWithStubObject
+	return s.readDir(ctx, name, true, s.listDirectoryEntriesEnabled(), ReadDirOptions{})
+}
+
+// ReadDirWithOptions simulates directory reading by the given name with the given options
+func (s *S3) ReadDirWithOptions(ctx context.Context, name string, opts ReadDirOptions) (fi FilesInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
 	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
 
-	if !s.nameIsADirectory(from) { // normal object
-		if dir := path.Dir(to); dir != "." && dir != "/" {
-			if err = s.MakePathAll(ctx, dir); err != nil {
-				return
-			}
-		}
-		if _, err = s.minioClient.CopyObject(ctx,
-			minio.CopyDestOptions{Bucket: s.bucketName, Object: to},
-			minio.CopySrcOptions{Bucket: s.bucketName, Object: from}); err != nil {
-			return
-		}
-		return s.minioClient.RemoveObject(ctx, s.bucketName, from, minio.RemoveObjectOptions{})
+	return s.readDir(ctx, name, true, s.listDirectoryEntriesEnabled(), opts)
+}
+
+// ReadDirs returns only immediate subdirectories of the directory with the given name
+func (s *S3) ReadDirs(ctx context.Context, name string) (fi FilesInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
 	}
-	// if s.nameIsADirectory(from)
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
 
-	if !s.nameIsADirectoryPath(to) {
-		return ErrDestinationPathIsNotDirectory
+	return s.readDir(ctx, name, false, true, ReadDirOptions{})
+}
+
+// Siblings returns entries of the parent directory of the given name excluding the name itself
+func (s *S3) Siblings(ctx context.Context, name string) (fi FilesInfo, err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
 	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
 
-	var exists bool
-	if exists, err = s.Exists(ctx, from); err != nil {
+	if name, err = s.NormalizeName(name); err != nil {
 		return
 	}
-	if !exists {
-		return ErrRenamingNonExistentDirectory
+	name = strings.TrimSuffix(s.stubToDir(name), "/")
+	var entries FilesInfo
+	if entries, err = s.ReadDir(ctx, s.nameToDir(path.Dir(name))); err != nil {
+		return
 	}
-
-	ctx1, cancel1 := context.WithCancel(ctx)
-	defer cancel1()
-	for objectInfo := range s.minioClient.ListObjects(ctx1, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    from,
-		Recursive: true,
-	}) {
-		objTo := to + strings.TrimPrefix("/"+objectInfo.Key, from)
-		if dir := path.Dir(objTo); dir != "." && dir != "/" {
-			if err = s.MakePathAll(ctx, dir); err != nil {
-				return
-			}
-		}
-
-		if _, err = s.minioClient.CopyObject(ctx,
-			minio.CopyDestOptions{Bucket: s.bucketName, Object: objTo},
-			minio.CopySrcOptions{Bucket: s.bucketName, Object: objectInfo.Key}); err != nil {
-			return
-		}
-		if err = s.minioClient.RemoveObject(ctx, s.bucketName, objectInfo.Key, minio.RemoveObjectOptions{}); err != nil {
-			s.logger.Errorf("S3.Rename: failed to remove object %q while batch moving", objectInfo.Key)
-			return
+	fi = make(FilesInfo, 0, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSuffix(entry.FullName(), "/") != name {
+			fi = append(fi, entry)
 		}
 	}
-	return nil
+	return
 }
 
-// Stat returns S3 object information as FileInfo interface
-func (s *S3) Stat(ctx context.Context, name string) (fi FileInfo, err error) {
+// ReadDirPage reads a page of at most limit entries of the directory by name in the lexical order of their names.
+// The page starts after the entries of the page the token is returned with, an empty token means the first page.
+// The returned nextToken is opaque and should be passed to read the next page, an empty nextToken means the end
+func (s *S3) ReadDirPage(ctx context.Context, name string, token string,
+	limit int) (entries FilesInfo, nextToken string, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
-	if s.nameIsADirectoryPath(name) && s.emulateEmptyDirs {
-		var objectInfo minio.ObjectInfo
-		if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, s.nameToStub(name),
-			minio.StatObjectOptions{}); err != nil {
-			return
+	if limit <= 0 {
+		return nil, "", ErrInvalidPageLimit
+	}
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
+	if !s.nameIsADirectory(name) {
+		return nil, "", ErrNotADirectory
+	}
+	name = s.stubToDir(name)
+
+	var startAfter string
+	if len(token) > 0 {
+		var b []byte
+		if b, err = base64.RawURLEncoding.DecodeString(token); err != nil {
+			return nil, "", ErrInvalidPageToken
+		}
+		if startAfter = string(b); !strings.HasPrefix("/"+startAfter, name) {
+			return nil, "", ErrInvalidPageToken
 		}
-		// objectInfo.LastModified may be zero struct
-		return NewS3FileInfoStub(s, name, objectInfo.LastModified), nil
 	}
-	// if !s.nameIsADirectory(name) || !s.emulateEmptyDirs
 
-	if s.nameIsADirectoryPath(name) {
-		var c int64
-		if c, err = s.Count(ctx, name, true, nil); err != nil {
-			return
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	withDirs := s.listDirectoryEntriesEnabled()
+	var objectInfos []minio.ObjectInfo // the extra one means there is a next page
+	for objectInfo := range s.minioClient.ListObjects(listCtx, s.bucketName,
+		s.listObjectsOptions(minio.ListObjectsOptions{Prefix: name, StartAfter: startAfter})) {
+		if objectInfo.Err != nil {
+			return nil, "", objectInfo.Err
 		}
-		if c > 0 { // directory virtually exists
-			// modTime is not available when empty dirs are not emulated
-			return NewS3FileInfoStub(s, name, time.Time{}), nil
+		if objectInfo.Key <= startAfter { // a common prefix containing the key the listing starts after
+			continue
+		}
+		fullKey := "/" + strings.TrimPrefix(objectInfo.Key, "/")
+		if s.nameIsADirectoryPath(fullKey) {
+			if !withDirs || fullKey == name {
+				continue
+			}
+		} else if s.nameIsADirectory(fullKey) {
+			continue
+		}
+		if objectInfos = append(objectInfos, objectInfo); len(objectInfos) > limit {
+			break
 		}
-		return nil, ErrDirectoryNotExists
 	}
-	// if (!s.nameIsADirectory(name) || !s.emulateEmptyDirs) && !s.nameIsADirectoryPath(name)
+	if len(objectInfos) > limit {
+		objectInfos = objectInfos[:limit]
+		nextToken = base64.RawURLEncoding.EncodeToString([]byte(objectInfos[limit-1].Key))
+	}
 
-	var objectInfo minio.ObjectInfo
-	if objectInfo, err = s.minioClient.StatObject(ctx, s.bucketName, name, minio.StatObjectOptions{}); err != nil {
-		return
+	entries = make(FilesInfo, len(objectInfos))
+	var (
+		dirNames   []string
+		dirIndexes []int // indexes of directory entries in entries
+	)
+	for i, objectInfo := range objectInfos {
+		objectInfo.Key = "/" + strings.TrimPrefix(objectInfo.Key, "/") // add leading '/'
+		if !s.nameIsADirectoryPath(objectInfo.Key) {
+			entries[i] = NewS3FileInfo(s, objectInfo)
+			continue
+		}
+		dirNames, dirIndexes = append(dirNames, objectInfo.Key), append(dirIndexes, i)
 	}
-	return NewS3FileInfo(s, objectInfo), nil
+	var modTimes []time.Time
+	if modTimes, err = s.dirsModTime(ctx, dirNames); err != nil {
+		return nil, "", err
+	}
+	for j, i := range dirIndexes {
+		entries[i] = NewS3FileInfoStub(s, dirNames[j], modTimes[j])
+	}
+	return entries, nextToken, nil
 }
 
-// ReadDir simulates directory reading by the given name
-func (s *S3) ReadDir(ctx context.Context, name string) (fi FilesInfo, err error) {
-	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+// readDir lists the directory with the given name returning files and (or) immediate subdirectories.
+// A single non-recursive listing is used, so subdirectories are the common prefixes of the listed keys
+// and the descendants of subdirectories are not listed
+func (s *S3) readDir(ctx context.Context, name string, withFiles, withDirs bool,
+	opts ReadDirOptions) (fi FilesInfo, err error) {
+	if name, err = s.NormalizeName(name); err != nil {
 		return
 	}
-	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
-			err = errcb
-		} // else drop callback error
-	}()
-
-	name = s.normalizeName(name)
 	if !s.nameIsADirectory(name) {
 		return nil, ErrNotADirectory
 	}
 	name = s.stubToDir(name)
 
-	dirMap := make(map[string]struct{})
-
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
 	fi = make(FilesInfo, 0)
 
-	// reading files
-	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
+	var dirNames []string
+	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, s.listObjectsOptions(minio.ListObjectsOptions{
 		Prefix:    name,
 		Recursive: false,
-	}) {
+	})) {
 		if objectInfo.Err != nil {
 			return fi, objectInfo.Err
 		}
-		if s.nameIsADirectory(objectInfo.Key) {
+		fullKey := "/" + strings.TrimPrefix(objectInfo.Key, "/")
+		if s.nameIsADirectoryPath(fullKey) { // common prefix
+			if withDirs && fullKey != name {
+				dirNames = append(dirNames, fullKey)
+			}
 			continue
 		}
-		if !strings.HasPrefix(objectInfo.Key, "/") { // add leading '/'
-			objectInfo.Key = "/" + objectInfo.Key
+		if !withFiles || (!opts.IncludeStubs && s.nameIsADirectory(fullKey)) {
+			continue
 		}
+		objectInfo.Key = fullKey // add leading '/'
 		fi = append(fi, NewS3FileInfo(s, objectInfo))
 	}
 
-	if !s.listDirectoryEntries {
-		return fi, nil
+	modTimes, err := s.dirsModTime(ctx, dirNames)
+	if err != nil {
+		return fi, err
 	}
+	for i, dirName := range dirNames { // adding directory entries to the list
+		fi = append(fi, NewS3FileInfoStub(s, dirName, modTimes[i]))
+	}
+	return fi, nil
+}
 
-	// reading dir entries
-
-	for objectInfo := range s.minioClient.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    name,
-		Recursive: true,
-	}) {
-		if objectInfo.Err != nil {
-			return fi, objectInfo.Err
-		}
-
-		// only current level directories
-		var key string
-		parent := func() string { return path.Dir("/"+objectInfo.Key) + "/" }
-		stillNotRoot := func() bool { return len(strings.TrimRight(key, "/")) > 0 }
-		upwards := func() string { return path.Dir(strings.TrimSuffix(key, "/")) + "/" }
-		for key = parent(); stillNotRoot(); key = upwards() {
-			if strings.HasPrefix(key, name) && strings.Count(strings.TrimPrefix(key, name), "/") <= 1 && key != name {
-				dirMap[key] = struct{}{}
-			}
-		}
+// dirsModTime returns modification times of the directories with the given names. If empty directories
+// are emulated, their stubs are requested concurrently by at most dirStubsStatConcurrency workers,
+// otherwise or if a directory has no stub its modification time is zero
+func (s *S3) dirsModTime(ctx context.Context, dirNames []string) (modTimes []time.Time, err error) {
+	modTimes = make([]time.Time, len(dirNames))
+	if !s.emulateEmptyDirs || len(dirNames) == 0 {
+		return modTimes, nil
 	}
 
-	for dirName := range dirMap { // adding directory entries to the list
-		s3fi := NewS3FileInfoStub(s, dirName, time.Time{})
-		if s.emulateEmptyDirs { // may request stat
-			var o FileInfo
-			if o, err = s.Stat(ctx, s.nameToStub(dirName)); err != nil {
-				return fi, err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		once  sync.Once
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, dirStubsStatConcurrency)
+	)
+	for i, dirName := range dirNames {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, stub string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			objectInfo, errStat := s.minioClient.StatObject(ctx, s.bucketName, stub, s.statObjectOptions())
+			switch {
+			case errStat == nil:
+				modTimes[i] = s3ObjectModTime(objectInfo)
+			case !s.IsNotExist(errStat):
+				once.Do(func() { // the first error is returned, the rest requests are cancelled
+					err = errStat
+					cancel()
+				})
 			}
-			s3fi.oi.LastModified = o.ModTime()
-		}
-
-		fi = append(fi, s3fi)
+		}(i, s.nameToStub(dirName))
 	}
-	return fi, nil
+	wg.Wait()
+	return modTimes, err
 }
 
-// walkDir recursively descends path, calling walkDirFunc
-func (s *S3) walkDir(ctx context.Context, name string, d DirEntry, walkDirFunc WalkDirFunc) (err error) {
+// walkDir recursively descends path, calling walkDirFunc. The depth of the walking root is zero
+func (s *S3) walkDir(ctx context.Context, name string, d DirEntry, depth int, walkDirFunc WalkDirFunc,
+	opts WalkDirOptions) (err error) {
+	if s.maxWalkDepth > 0 && depth > s.maxWalkDepth {
+		return ErrMaxDepthExceeded
+	}
 	name = s.normalizeName(name)
+	if !d.IsDir() && !opts.modTimeMatches(d.(S3DirEntry).fi.ModTime()) {
+		return nil
+	}
 	if err = walkDirFunc(name, d, nil); err != nil || !d.IsDir() {
 		if err == ErrSkipDir && d.IsDir() {
 			err = nil
@@ -980,7 +2851,7 @@ func (s *S3) walkDir(ctx context.Context, name string, d DirEntry, walkDirFunc W
 	var fsi FilesInfo
 	if fsi, err = s.ReadDir(ctx, name); err != nil {
 		if err = walkDirFunc(name, d, err); err != nil { // second call, to report an error from s.ReadDir()
-			return
+			return opts.continued(err) // skips only the failed directory if continued
 		}
 	}
 
@@ -989,7 +2860,7 @@ func (s *S3) walkDir(ctx context.Context, name string, d DirEntry, walkDirFunc W
 			continue
 		}
 		if err = s.walkDir(ctx, fi.FullName(), S3DirEntry{oi: fi.(S3FileInfo).oi, fi: fi, s3: fi.Sys().(*S3)},
-			walkDirFunc); err != nil {
+			depth+1, walkDirFunc, opts); err != nil {
 			if err == ErrSkipDir {
 				break
 			}
@@ -999,24 +2870,63 @@ func (s *S3) walkDir(ctx context.Context, name string, d DirEntry, walkDirFunc W
 	return nil
 }
 
-// WalkDir simulates traversing the filesystem from the given directory
+// WalkDir simulates traversing the filesystem from the given directory.
+// If the given directory does not exist, ErrDirectoryNotExists is returned regardless of EmulateEmptyDirs
 func (s *S3) WalkDir(ctx context.Context, name string, walkDirFunc WalkDirFunc) (err error) {
+	return s.WalkDirWithOptions(ctx, name, walkDirFunc, WalkDirOptions{})
+}
+
+// WalkDirWithStats is like WalkDir but also returns totals of files, directories and bytes visited
+func (s *S3) WalkDirWithStats(ctx context.Context, name string, walkDirFunc WalkDirFunc) (stats WalkStats, err error) {
 	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
 		return
 	}
 	defer func() {
-		if errcb := invokeAfterOperationCB(ctx); err == nil {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
 			err = errcb
 		} // else drop callback error
 	}()
 
-	name = s.normalizeName(name)
+	return walkDirWithStats(ctx, s.WalkDir, name, walkDirFunc)
+}
+
+// WalkFiles simulates traversing the filesystem from the given directory like WalkDir but passes
+// FileInfo objects taken from the listing data, so no additional Stat calls are made
+func (s *S3) WalkFiles(ctx context.Context, name string, walkFilesFunc WalkFilesFunc) (err error) {
+	return s.WalkDir(ctx, name, func(_ string, d DirEntry, err error) error {
+		var fi FileInfo
+		if d != nil {
+			fi = d.(S3DirEntry).fi
+		}
+		return walkFilesFunc(fi, err)
+	})
+}
+
+// WalkDirWithOptions simulates traversing the filesystem from the given directory with the given options
+func (s *S3) WalkDirWithOptions(ctx context.Context, name string, walkDirFunc WalkDirFunc,
+	opts WalkDirOptions) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	if name, err = s.NormalizeName(name); err != nil {
+		return
+	}
 	var fi FileInfo
 	if fi, err = s.Stat(ctx, name); err != nil {
+		if s.nameIsADirectoryPath(name) && s.IsNotExist(err) { // the error differs depending on emulateEmptyDirs
+			err = ErrDirectoryNotExists
+		}
 		return err
 	}
-	err = s.walkDir(ctx, name, S3DirEntry{oi: fi.(S3FileInfo).oi, fi: fi, s3: fi.Sys().(*S3)}, walkDirFunc)
-	if err == ErrSkipDir {
+	err = s.walkDir(ctx, name, S3DirEntry{oi: fi.(S3FileInfo).oi, fi: fi, s3: fi.Sys().(*S3)}, 0,
+		opts.limited(walkDirFunc), opts)
+	if err == ErrSkipDir || err == ErrStopWalk {
 		return nil
 	}
 	return
@@ -0,0 +1,62 @@
+package filesystem
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// S3DirFile implements fs.ReadDirFile for an S3 directory
+type S3DirFile struct {
+	mu sync.Mutex
+
+	fi      FileInfo  // directory information
+	entries FilesInfo // directory entries, sorted by full name
+	offset  int       // index of the next entry to be returned by ReadDir
+	closed  bool
+}
+
+// Stat makes S3DirFile to implement fs.File. Returns the directory information
+func (df *S3DirFile) Stat() (fs.FileInfo, error) { return df.fi, nil }
+
+// Read makes S3DirFile to implement fs.File. It always returns an error
+func (df *S3DirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: df.fi.FullName(), Err: ErrCantReadS3Directory}
+}
+
+// Close makes S3DirFile to implement fs.File
+func (df *S3DirFile) Close() error {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	if df.closed {
+		return &fs.PathError{Op: "close", Path: df.fi.FullName(), Err: fs.ErrClosed}
+	}
+	df.closed = true
+	return nil
+}
+
+// ReadDir makes S3DirFile to implement fs.ReadDirFile.
+// If n > 0, returns at most n entries, and io.EOF if there are no more entries.
+// If n <= 0, returns all the remaining entries and a nil error
+func (df *S3DirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	if df.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: df.fi.FullName(), Err: fs.ErrClosed}
+	}
+
+	remaining := len(df.entries) - df.offset
+	if n > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > remaining {
+		n = remaining
+	}
+
+	res := make([]fs.DirEntry, n)
+	for i, fi := range df.entries[df.offset : df.offset+n] {
+		res[i] = S3DirEntry{oi: fi.(S3FileInfo).oi, fi: fi, s3: fi.Sys().(*S3)}
+	}
+	df.offset += n
+	return res, nil
+}
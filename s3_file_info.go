@@ -9,6 +9,23 @@ import (
 	"github.com/minio/minio-go/v7"
 )
 
+// s3ModTimeMetadataKey is a user metadata key of the object modification time set by S3.SetModTime
+const s3ModTimeMetadataKey = "Mtime"
+
+// s3StorageClassHeader is a header of the object storage class
+const s3StorageClassHeader = "X-Amz-Storage-Class"
+
+// s3ObjectModTime returns the object modification time from its user metadata if present,
+// otherwise returns last modified time
+func s3ObjectModTime(oi minio.ObjectInfo) time.Time {
+	if value, ok := oi.UserMetadata[s3ModTimeMetadataKey]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t
+		}
+	}
+	return oi.LastModified
+}
+
 // S3FileInfo implements FileInfo
 type S3FileInfo struct {
 	oi minio.ObjectInfo
@@ -35,8 +52,9 @@ func (s S3FileInfo) Size() int64 { return s.oi.Size }
 // Mode makes S3FileInfo to implement FileInfo. It always returns 0
 func (s S3FileInfo) Mode() fs.FileMode { return 0 }
 
-// ModTime makes S3FileInfo to implement FileInfo. Returns last modified time
-func (s S3FileInfo) ModTime() time.Time { return s.oi.LastModified }
+// ModTime makes S3FileInfo to implement FileInfo. Returns modification time set by S3.SetModTime
+// if present, otherwise returns last modified time
+func (s S3FileInfo) ModTime() time.Time { return s3ObjectModTime(s.oi) }
 
 // IsDir makes S3FileInfo to implement FileInfo. It returns whether an object key
 // ends in '/' (and it's size is 0)
@@ -44,6 +62,53 @@ func (s S3FileInfo) IsDir() bool {
 	return strings.HasSuffix(s.oi.Key, "/") // && s.oi.Size == 0
 }
 
+// FS makes S3FileInfo to implement FileInfo. It returns the FileSystem the object belongs to
+func (s S3FileInfo) FS() FileSystem { return s.s3 }
+
 // Sys makes S3FileInfo to implement FileInfo. It returns a value of type *S3:
 // a pointer to the underlying FileSystem-implementing object
 func (s S3FileInfo) Sys() interface{} { return s.s3 }
+
+// ContentType makes S3FileInfo to implement ContentTyper. Returns content type of S3 object.
+// It is empty for directories and for objects information obtained by listing
+func (s S3FileInfo) ContentType() string { return s.oi.ContentType }
+
+// ETag makes S3FileInfo to implement ETager. Returns entity tag of S3 object, it is empty for directories
+func (s S3FileInfo) ETag() string {
+	if s.IsDir() {
+		return ""
+	}
+	return s.oi.ETag
+}
+
+// StorageClass makes S3FileInfo to implement StorageClasser. Returns storage class of S3 object,
+// it is empty for directories. S3 does not report the storage class of standard objects, so
+// StandardStorageClass is returned if it is unknown
+func (s S3FileInfo) StorageClass() string {
+	if s.IsDir() {
+		return ""
+	}
+	if len(s.oi.StorageClass) > 0 { // listing data
+		return s.oi.StorageClass
+	}
+	if storageClass := s.oi.Metadata.Get(s3StorageClassHeader); len(storageClass) > 0 {
+		return storageClass
+	}
+	return StandardStorageClass
+}
+
+// UserMetadata makes S3FileInfo to implement MetadataProvider. Returns a copy of user metadata of S3 object
+// without the "X-Amz-Meta-" prefix of keys. Metadata used by the filesystem itself is not included.
+// It is empty for directories and for objects information obtained by listing
+func (s S3FileInfo) UserMetadata() map[string]string {
+	if s.IsDir() {
+		return nil
+	}
+	userMetadata := make(map[string]string, len(s.oi.UserMetadata))
+	for key, value := range s.oi.UserMetadata {
+		if key != s3ModTimeMetadataKey {
+			userMetadata[key] = value
+		}
+	}
+	return userMetadata
+}
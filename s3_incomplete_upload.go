@@ -0,0 +1,11 @@
+package filesystem
+
+import "time"
+
+// IncompleteUpload describes a multipart upload which was initiated but neither completed nor aborted
+type IncompleteUpload struct {
+	Name      string    // normalized object name
+	UploadID  string    // multipart upload ID
+	Initiated time.Time // when the upload was initiated
+	Size      int64     // size of the uploaded parts if known
+}
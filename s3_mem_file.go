@@ -0,0 +1,190 @@
+package filesystem
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// s3MemFile implements File over an in-memory buffer, it is used for small opened S3 objects
+type s3MemFile struct {
+	mu sync.Mutex
+
+	name    string
+	flag    int
+	data    []byte
+	offset  int64
+	modTime time.Time
+	closed  bool
+}
+
+// newS3MemFile returns a new in-memory File by name with the given contents opened with the given flag
+func newS3MemFile(name string, data []byte, flag int) *s3MemFile {
+	if flag&os.O_TRUNC != 0 {
+		data = nil
+	}
+	return &s3MemFile{name: name, flag: flag, data: data, modTime: time.Now()}
+}
+
+// check returns an error if the file is closed or is not opened for the operation
+func (f *s3MemFile) check(op string, write bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	writable := f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if (write && !writable) || (!write && f.flag&os.O_WRONLY != 0) {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// Bytes returns a copy of the file contents, it is available after closing the file
+func (f *s3MemFile) Bytes() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]byte{}, f.data...)
+}
+
+// Read makes s3MemFile to implement File
+func (f *s3MemFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+// ReadAt makes s3MemFile to implement File
+func (f *s3MemFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write makes s3MemFile to implement File
+func (f *s3MemFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	n := copy(f.data[f.offset:], p)
+	f.offset += int64(n)
+	f.modTime = time.Now()
+	return n, nil
+}
+
+// Seek makes s3MemFile to implement File
+func (f *s3MemFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Truncate makes s3MemFile to implement File
+func (f *s3MemFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if size > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.data = f.data[:size]
+	f.modTime = time.Now()
+	return nil
+}
+
+// Sync makes s3MemFile to implement File, there is nothing to sync in memory
+func (f *s3MemFile) Sync() error { return nil }
+
+// Stat makes s3MemFile to implement File
+func (f *s3MemFile) Stat() (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return s3MemFileInfo{name: path.Base(f.name), size: int64(len(f.data)), modTime: f.modTime}, nil
+}
+
+// Name makes s3MemFile to implement File
+func (f *s3MemFile) Name() string { return f.name }
+
+// Close makes s3MemFile to implement File
+func (f *s3MemFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// s3MemFileInfo implements fs.FileInfo for s3MemFile
+type s3MemFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// Name makes s3MemFileInfo to implement fs.FileInfo
+func (fi s3MemFileInfo) Name() string { return fi.name }
+
+// Size makes s3MemFileInfo to implement fs.FileInfo
+func (fi s3MemFileInfo) Size() int64 { return fi.size }
+
+// Mode makes s3MemFileInfo to implement fs.FileInfo
+func (fi s3MemFileInfo) Mode() fs.FileMode { return 0666 }
+
+// ModTime makes s3MemFileInfo to implement fs.FileInfo
+func (fi s3MemFileInfo) ModTime() time.Time { return fi.modTime }
+
+// IsDir makes s3MemFileInfo to implement fs.FileInfo
+func (fi s3MemFileInfo) IsDir() bool { return false }
+
+// Sys makes s3MemFileInfo to implement fs.FileInfo
+func (fi s3MemFileInfo) Sys() interface{} { return nil }
@@ -0,0 +1,18 @@
+package filesystem
+
+import (
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3ObjectReader is a minio object returned by S3.Reader, it also implements io.WriterTo
+type s3ObjectReader struct {
+	*minio.Object
+}
+
+// WriteTo makes s3ObjectReader to implement io.WriterTo, which S3.Reader promises. It is a plain io.Copy
+// of the object contents to w, with no copying optimizations of its own
+func (r s3ObjectReader) WriteTo(w io.Writer) (n int64, err error) {
+	return io.Copy(w, r.Object) // *minio.Object is not an io.WriterTo, so no recursion here
+}
@@ -14,12 +14,17 @@ type S3OpenedFile struct {
 	ctx context.Context
 
 	underlyingMu sync.Mutex
-	underlying   File // underlying local file
+	underlying   File // underlying local or in-memory file
 
 	localName  string // underlying local file path
 	objectName string // S3 object key
 
-	changed bool
+	writeMu   sync.Mutex // guards changes of the file against writing them back by another holder, see S3.OpenFresh
+	changed   bool
+	exclusive bool // the object should be written only if it does not exist, see S3.CreateExcl
+
+	closeMu sync.Mutex
+	closed  bool // whether Close was called, further calls return an error
 }
 
 // Underlying returns an underlying file
@@ -38,6 +43,8 @@ func (of *S3OpenedFile) SetUnderlying(f File) {
 
 // Sync makes S3OpenedFile to implement File
 func (of *S3OpenedFile) Sync() error { // todo does it work as intended?
+	of.writeMu.Lock()
+	defer of.writeMu.Unlock()
 	if err := of.Underlying().Sync(); err != nil { // does this work?
 		return err
 	}
@@ -55,7 +62,7 @@ func (of *S3OpenedFile) Sync() error { // todo does it work as intended?
 	if _, err := of.Seek(offset, io.SeekStart); err != nil {
 		return err
 	}
-	if err := of.s3.WriteFile(of.ctx, of.objectName, buf.Bytes()); err != nil { // write it into S3 storage
+	if err := of.writeBack(of.ctx, buf.Bytes()); err != nil { // write it into S3 storage
 		return err
 	}
 	buf.Reset()
@@ -65,6 +72,8 @@ func (of *S3OpenedFile) Sync() error { // todo does it work as intended?
 
 // Truncate makes S3OpenedFile to implement File
 func (of *S3OpenedFile) Truncate(size int64) error {
+	of.writeMu.Lock()
+	defer of.writeMu.Unlock()
 	of.changed = true
 	return of.Underlying().Truncate(size)
 }
@@ -87,45 +96,68 @@ func (of *S3OpenedFile) ReadAt(p []byte, off int64) (n int, err error) {
 
 // Write makes S3OpenedFile to implement File
 func (of *S3OpenedFile) Write(p []byte) (n int, err error) {
+	of.writeMu.Lock()
+	defer of.writeMu.Unlock()
 	of.changed = true
 	return of.Underlying().Write(p)
 }
 
 // Close makes S3OpenedFile to implement File. It closed the underlying File and removes it from local file system.
-func (of *S3OpenedFile) Close() error {
-	// unlock and delete opened files list entry
-	defer of.s3.OpenedFilesList().DeleteAndUnlockEntry(of.localName)
+// Calls after the first one (including autoclosing) return an error satisfying errors.Is(err, fs.ErrClosed).
+// Changes are written into S3 storage with the context the file was opened with, see CloseCtx
+func (of *S3OpenedFile) Close() error { return of.CloseCtx(of.ctx) }
+
+// CloseCtx closes the file like Close does, but writes changes into S3 storage with the given context,
+// so writing back may be cancelled. The file is closed, its local file is removed and its opened files list entry
+// is deleted even if an error is returned
+func (of *S3OpenedFile) CloseCtx(ctx context.Context) (err error) {
+	of.closeMu.Lock()
+	defer of.closeMu.Unlock()
+	if of.closed { // the list entry may already belong to the file opened again with the same name
+		return &fs.PathError{Op: "close", Path: of.objectName, Err: fs.ErrClosed}
+	}
+	of.closed = true
+	of.writeMu.Lock()
+	defer of.writeMu.Unlock()
+
+	// unlock and delete opened files list entry, then free the opened file slot
+	defer of.s3.deleteOpenedFilesListEntry(of.localName)
 
 	underlying := of.Underlying()
 	if underlying == nil {
 		of.s3.logger.Warnf("S3OpenedFile.Close: underlying is nil on file %q", of.localName)
 		return nil
 	}
+	defer func() {
+		if err != nil { // the local file should not be left orphaned, deferred before deleting the list entry
+			of.removeLocalFile(ctx)
+		}
+	}()
 
 	if err := underlying.Close(); err != nil { // close the underlying file
 		of.s3.logger.Errorf("failed to underlying.Close() on file %q: %v", of.localName, err)
 		return err
 	}
 
-	b, err := of.s3.openedFilesLocalFS.ReadFile(of.ctx, of.localName) // re-read local file
+	b, err := of.contents(ctx) // re-read the underlying file
 	if err != nil {
 		return err
 	}
 
 	if of.changed {
-		if err := of.s3.WriteFile(of.ctx, of.objectName, b); err != nil { // write it into S3 storage
+		if err := of.writeBack(ctx, b); err != nil { // write it into S3 storage
 			return err
 		}
 		of.changed = false
 	}
 
-	exists, err := of.s3.openedFilesLocalFS.Exists(of.ctx, of.localName) // if local file still exists...
+	exists, err := of.s3.openedFilesLocalFS.Exists(ctx, of.localName) // if local file still exists...
 	if err != nil {
 		of.s3.logger.Errorf("failed to of.fsLocal.Exists() on file %q: %v", of.localName, err)
 		return err
 	}
 	if exists { // then remove it
-		if err := of.s3.openedFilesLocalFS.Remove(of.ctx, of.localName); err != nil {
+		if err := of.s3.openedFilesLocalFS.Remove(ctx, of.localName); err != nil {
 			of.s3.logger.Errorf("failed to of.fsLocal.Remove() on file %q: %v", of.localName, err)
 			return err
 		}
@@ -133,6 +165,59 @@ func (of *S3OpenedFile) Close() error {
 	return nil
 }
 
+// writeBack writes the file contents into S3 storage. If the file is exclusive, the object is written only
+// if it does not exist, otherwise an error satisfying errors.Is(err, fs.ErrExist) is returned
+func (of *S3OpenedFile) writeBack(ctx context.Context, b []byte) error {
+	if !of.exclusive {
+		return of.s3.WriteFile(ctx, of.objectName, b)
+	}
+	created, err := of.s3.WriteFileIfNotExists(ctx, of.objectName, b)
+	if err != nil {
+		return err
+	}
+	if !created { // it was created concurrently after opening
+		return &fs.PathError{Op: "close", Path: of.objectName, Err: fs.ErrExist}
+	}
+	of.exclusive = false // the object is written by this file now
+	return nil
+}
+
+// removeLocalFile removes the local file if it exists, errors are logged only
+func (of *S3OpenedFile) removeLocalFile(ctx context.Context) {
+	err := of.s3.openedFilesLocalFS.Remove(ctx, of.localName)
+	if err != nil && !of.s3.openedFilesLocalFS.IsNotExist(err) {
+		of.s3.logger.Errorf("failed to of.fsLocal.Remove() on file %q: %v", of.localName, err)
+	}
+}
+
+// flush writes changes of the file into S3 storage if it is not closed yet
+func (of *S3OpenedFile) flush(ctx context.Context) error {
+	of.closeMu.Lock()
+	defer of.closeMu.Unlock()
+	of.writeMu.Lock()
+	defer of.writeMu.Unlock()
+	if of.closed || !of.changed {
+		return nil
+	}
+	b, err := of.contents(ctx)
+	if err != nil {
+		return err
+	}
+	if err := of.writeBack(ctx, b); err != nil {
+		return err
+	}
+	of.changed = false
+	return nil
+}
+
+// contents returns contents of the underlying file, which may be already closed
+func (of *S3OpenedFile) contents(ctx context.Context) ([]byte, error) {
+	if f, ok := of.Underlying().(*s3MemFile); ok {
+		return f.Bytes(), nil
+	}
+	return of.s3.openedFilesLocalFS.ReadFile(ctx, of.localName)
+}
+
 // LocalName returns local file name
 func (of *S3OpenedFile) LocalName() string { return of.localName }
 
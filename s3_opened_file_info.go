@@ -0,0 +1,12 @@
+package filesystem
+
+import (
+	"time"
+)
+
+// OpenedFileInfo is a snapshot of an opened files list entry
+type OpenedFileInfo struct {
+	ObjectName string    // S3 object key
+	LocalName  string    // underlying local file path
+	Added      time.Time // time when the file was opened
+}
@@ -1,7 +1,9 @@
 package filesystem
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
 // S3OpenedFilesList represents S3 opened files list
@@ -25,6 +27,22 @@ func (ofl *S3OpenedFilesList) Len() int {
 	return len(ofl.m)
 }
 
+// Snapshot returns a copy of the list contents as a slice sorted by local file name
+func (ofl *S3OpenedFilesList) Snapshot() []OpenedFileInfo {
+	ofl.Lock()
+	defer ofl.Unlock()
+	res := make([]OpenedFileInfo, 0, len(ofl.m))
+	for localFileName, entry := range ofl.m {
+		res = append(res, OpenedFileInfo{
+			ObjectName: entry.S3File.objectName,
+			LocalName:  localFileName,
+			Added:      entry.Added,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LocalName < res[j].LocalName })
+	return res
+}
+
 // AddAndLockEntry adds an entry to the list and locks it
 func (ofl *S3OpenedFilesList) AddAndLockEntry(localFileName string, entry *S3OpenedFilesListEntry) {
 	entry.Lock()
@@ -33,14 +51,44 @@ func (ofl *S3OpenedFilesList) AddAndLockEntry(localFileName string, entry *S3Ope
 	ofl.m[localFileName] = entry
 }
 
-// DeleteAndUnlockEntry deletes and unlocks an entry from the list if it exists
-func (ofl *S3OpenedFilesList) DeleteAndUnlockEntry(localFileName string) {
+// lockEntry locks the entry of the local file name waiting for its holder to delete it from the list,
+// then adds the entry to the list with the given file. The entry is created if it is not in the list.
+// Returns the locked entry
+func (ofl *S3OpenedFilesList) lockEntry(localFileName string, added time.Time,
+	file *S3OpenedFile) *S3OpenedFilesListEntry {
+	for {
+		ofl.Lock()
+		entry := ofl.m[localFileName]
+		ofl.Unlock()
+		if entry == nil {
+			entry = &S3OpenedFilesListEntry{}
+		}
+		entry.Lock()
+
+		ofl.Lock()
+		if _, held := ofl.m[localFileName]; !held {
+			entry.Added, entry.S3File = added, file
+			ofl.m[localFileName] = entry
+			ofl.Unlock()
+			return entry
+		}
+		ofl.Unlock()
+		entry.Unlock() // another entry was added meanwhile, so wait for it
+	}
+}
+
+// DeleteAndUnlockEntry deletes and unlocks an entry from the list if it exists.
+// Returns whether the entry existed
+func (ofl *S3OpenedFilesList) DeleteAndUnlockEntry(localFileName string) bool {
 	ofl.Lock()
 	defer ofl.Unlock()
-	if entry := ofl.m[localFileName]; entry != nil {
-		delete(ofl.m, localFileName)
-		entry.Unlock()
+	entry := ofl.m[localFileName]
+	if entry == nil {
+		return false
 	}
+	delete(ofl.m, localFileName)
+	entry.Unlock()
+	return true
 }
 
 // existsEntry returns whether the entry exists
@@ -1,28 +1,58 @@
 package filesystem
 
 import (
+	"net/http"
 	"path/filepath"
 	"time"
 
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
 )
 
 // S3Params are parameters for S3 filesystem client
 type S3Params struct {
-	Endpoint   string
-	Region     string
-	AccessKey  string
-	SecretKey  string
-	UseSSL     bool
-	BucketName string
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string                   // for temporary credentials, may be empty
+	Credentials  *credentials.Credentials // if set, used instead of AccessKey, SecretKey and SessionToken
+	UseSSL       bool
+	BucketName   string
+	Transport    http.RoundTripper // custom HTTP transport, if nil the minio client's default is used
+
+	RequesterPays bool // sends x-amz-request-payer header reading and listing objects, for requester-pays buckets
 
 	OpenedFilesTTL     time.Duration
 	OpenedFilesTempDir string
+	OpenedFilesClosers int // max amount of expired opened files closed concurrently, 4 by default
+	// InMemoryOpenThreshold, if positive, makes objects smaller than it to be opened in memory instead of
+	// local temporary files. Truncated and created objects are always opened in local temporary files
+	InMemoryOpenThreshold int64
+
+	MaxOpenFiles     int           // zero means no limit
+	MaxOpenFilesWait time.Duration // zero means fail-fast, negative means wait without timeout
+
+	StatCacheSize int           // max amount of objects information cached, zero means no caching
+	StatCacheTTL  time.Duration // cached objects information lifetime
+
+	MaxObjectSize int64 // max size of an object to write in bytes, zero means no limit
+	MaxWalkDepth  int   // max depth of WalkDir relative to the walking root, zero means no limit
+
+	CopyProgressThreshold int64 // objects larger than this are copied reporting progress by CopyWithProgress
 
 	Logger logrus.FieldLogger
 
 	EmulateEmptyDirs     bool // without this directory modification time will not be available
 	ListDirectoryEntries bool // in the ReadDir output
+	ObjectLocking        bool // enables object locking on the bucket if it is created by NewS3
+
+	StubContentType string // content type of directory stub objects, "text/plain" by default
+	CreateRootStub  *bool  // whether NewS3 creates the root directory stub if EmulateEmptyDirs, nil means true
+
+	CacheControl       string // default Cache-Control header of written objects
+	ContentDisposition string // default Content-Disposition header of written objects
+	EnableContentMD5   bool   // sends Content-MD5 header writing objects by default, see WriteOptions.EnableContentMD5
 }
 
 func (s3p *S3Params) applyDefaults() {
@@ -30,6 +60,22 @@ func (s3p *S3Params) applyDefaults() {
 	if s3p.OpenedFilesTTL <= 0 {
 		s3p.OpenedFilesTTL = defaultOpenedFilesTTL
 	}
+	const defaultOpenedFilesClosers = 4
+	if s3p.OpenedFilesClosers <= 0 {
+		s3p.OpenedFilesClosers = defaultOpenedFilesClosers
+	}
+	const defaultStatCacheTTL = time.Minute
+	if s3p.StatCacheTTL <= 0 {
+		s3p.StatCacheTTL = defaultStatCacheTTL
+	}
+	const defaultCopyProgressThreshold = 64 << 20
+	if s3p.CopyProgressThreshold <= 0 {
+		s3p.CopyProgressThreshold = defaultCopyProgressThreshold
+	}
+	const defaultStubContentType = "text/plain"
+	if len(s3p.StubContentType) == 0 {
+		s3p.StubContentType = defaultStubContentType
+	}
 	if len(s3p.OpenedFilesTempDir) == 0 {
 		s3p.OpenedFilesTempDir = "." + string(filepath.Separator)
 	}
@@ -0,0 +1,25 @@
+package filesystem
+
+import "github.com/minio/minio-go/v7"
+
+// requestPayerHeader is an HTTP header to be sent with requests to requester-pays buckets
+const requestPayerHeader = "x-amz-request-payer"
+
+// getObjectOptions returns options for getting an object
+func (s *S3) getObjectOptions() (opts minio.GetObjectOptions) {
+	if s.requesterPays {
+		opts.Set(requestPayerHeader, "requester")
+	}
+	return
+}
+
+// statObjectOptions returns options for getting an object information
+func (s *S3) statObjectOptions() minio.StatObjectOptions { return s.getObjectOptions() }
+
+// listObjectsOptions returns the given options for listing objects with the request payer header set if needed
+func (s *S3) listObjectsOptions(opts minio.ListObjectsOptions) minio.ListObjectsOptions {
+	if s.requesterPays {
+		opts.Set(requestPayerHeader, "requester")
+	}
+	return opts
+}
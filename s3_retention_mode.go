@@ -0,0 +1,12 @@
+package filesystem
+
+import "github.com/minio/minio-go/v7"
+
+// RetentionMode is an S3 object retention mode
+type RetentionMode string
+
+// retention modes
+const (
+	RetentionGovernance RetentionMode = RetentionMode(minio.Governance) // may be bypassed with special permissions
+	RetentionCompliance RetentionMode = RetentionMode(minio.Compliance) // can't be bypassed or shortened by anyone
+)
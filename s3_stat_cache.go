@@ -0,0 +1,108 @@
+package filesystem
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3StatCacheEntry is an entry of s3StatCache
+type s3StatCacheEntry struct {
+	key     string
+	oi      minio.ObjectInfo
+	expires time.Time
+}
+
+// s3StatCache is a size-bounded LRU cache of S3 objects information with entries expiration.
+// A nil *s3StatCache is valid and caches nothing
+type s3StatCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+	order *list.List               // front is the most recently used
+	m     map[string]*list.Element // map of normalized object name to an element of order
+}
+
+// newS3StatCache returns a pointer to a new s3StatCache or nil if size is not positive
+func newS3StatCache(size int, ttl time.Duration, now func() time.Time) *s3StatCache {
+	if size <= 0 {
+		return nil
+	}
+	return &s3StatCache{size: size, ttl: ttl, now: now, order: list.New(), m: make(map[string]*list.Element)}
+}
+
+// get returns cached object information by the name
+func (c *s3StatCache) get(name string) (minio.ObjectInfo, bool) {
+	if c == nil {
+		return minio.ObjectInfo{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.m[name]
+	if !ok {
+		return minio.ObjectInfo{}, false
+	}
+	entry := el.Value.(*s3StatCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.removeElement(el)
+		return minio.ObjectInfo{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.oi, true
+}
+
+// put object information into the cache, evicting the least recently used entry if the cache is full
+func (c *s3StatCache) put(name string, oi minio.ObjectInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.m[name]; ok {
+		el.Value.(*s3StatCacheEntry).oi, el.Value.(*s3StatCacheEntry).expires = oi, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.m[name] = c.order.PushFront(&s3StatCacheEntry{key: name, oi: oi, expires: expires})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// invalidate cached object information by the names
+func (c *s3StatCache) invalidate(names ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		if el, ok := c.m[name]; ok {
+			c.removeElement(el)
+		}
+	}
+}
+
+// invalidatePrefix invalidates cached information of all objects which names start with prefix
+func (c *s3StatCache) invalidatePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, el := range c.m {
+		if strings.HasPrefix(name, prefix) {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *s3StatCache) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.m, el.Value.(*s3StatCacheEntry).key)
+}
@@ -3,22 +3,197 @@ package filesystem_test
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
 	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/mtfelian/filesystem"
 	"github.com/mtfelian/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
+// countingTransport counts HTTP requests passed through it
+type countingTransport struct{ count int64 }
+
+func (ct *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&ct.count, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (ct *countingTransport) Count() int64 { return atomic.LoadInt64(&ct.count) }
+
+// methodsCountingTransport counts HTTP requests passed through it by their methods
+type methodsCountingTransport struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (mt *methodsCountingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	mt.mu.Lock()
+	if mt.counts == nil {
+		mt.counts = make(map[string]int)
+	}
+	mt.counts[r.Method]++
+	mt.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (mt *methodsCountingTransport) Count(method string) int {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	return mt.counts[method]
+}
+
+// listedKeysCountingTransport counts object keys returned by listing requests passed through it
+type listedKeysCountingTransport struct{ count int64 }
+
+func (lt *listedKeysCountingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil || r.Method != http.MethodGet {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&lt.count, int64(bytes.Count(body, []byte("<Contents>"))))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (lt *listedKeysCountingTransport) Count() int64 { return atomic.LoadInt64(&lt.count) }
+
+// headersRecordingTransport records values of the given HTTP header of requests passed through it
+type headersRecordingTransport struct {
+	mu     sync.Mutex
+	header string
+	values []string
+}
+
+func (ht *headersRecordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ht.mu.Lock()
+	ht.values = append(ht.values, r.Header.Get(ht.header))
+	ht.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (ht *headersRecordingTransport) Values() []string {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	return append([]string(nil), ht.values...)
+}
+
+// putsRecordingTransport records URL paths of PUT requests passed through it
+type putsRecordingTransport struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (pt *putsRecordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == http.MethodPut {
+		pt.mu.Lock()
+		pt.paths = append(pt.paths, r.URL.Path)
+		pt.mu.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (pt *putsRecordingTransport) Paths() []string {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return append([]string(nil), pt.paths...)
+}
+
+// hangingTransport waits for the request context to be done instead of passing requests while hanging is set
+type hangingTransport struct{ hanging int32 }
+
+func (ht *hangingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&ht.hanging) == 0 {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+}
+
+func (ht *hangingTransport) SetHanging(hanging bool) {
+	var value int32
+	if hanging {
+		value = 1
+	}
+	atomic.StoreInt32(&ht.hanging, value)
+}
+
+// deniedPutsTransport responds to PUT requests with AccessDenied error while denying is set
+type deniedPutsTransport struct{ denying int32 }
+
+func (dt *deniedPutsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodPut || atomic.LoadInt32(&dt.denying) == 0 {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	return accessDeniedResponse(r), nil
+}
+
+func (dt *deniedPutsTransport) SetDenying(denying bool) {
+	var value int32
+	if denying {
+		value = 1
+	}
+	atomic.StoreInt32(&dt.denying, value)
+}
+
+// deniedListingTransport responds to listing requests of the given prefix with AccessDenied error
+type deniedListingTransport struct{ prefix string }
+
+func (dt *deniedListingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	query := r.URL.Query()
+	if r.Method != http.MethodGet || query.Get("list-type") == "" || query.Get("prefix") != dt.prefix {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	return accessDeniedResponse(r), nil
+}
+
+// deniedStatTransport responds to HEAD requests of the objects with the given key suffix with AccessDenied error
+type deniedStatTransport struct{ suffix string }
+
+func (dt *deniedStatTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodHead || !strings.HasSuffix(r.URL.Path, dt.suffix) {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	return accessDeniedResponse(r), nil
+}
+
+// accessDeniedResponse returns S3 AccessDenied error response to the request
+func accessDeniedResponse(r *http.Request) *http.Response {
+	const body = `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`
+	return &http.Response{
+		StatusCode: http.StatusForbidden,
+		Status:     "403 Forbidden",
+		Header:     http.Header{"Content-Type": []string{"application/xml"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}
+}
+
 var _ = Describe("S3 FileSystem implementation", func() {
 	var (
 		s3fs        filesystem.FileSystem
@@ -71,6 +246,7 @@ var _ = Describe("S3 FileSystem implementation", func() {
 			ctxKey   = "key"
 			ctxValue = "value"
 		)
+		filesystem.SetAfterOperationCB2(nil)
 		filesystem.SetBeforeOperationCB(func(ctx context.Context) (context.Context, error) {
 			return context.WithValue(ctx, ctxKey, ctxValue), nil
 		})
@@ -131,6 +307,20 @@ var _ = Describe("S3 FileSystem implementation", func() {
 		})
 	}
 
+	// newEmptyBucketFS returns S3 FileSystem for a new empty bucket and a function removing the bucket
+	newEmptyBucketFS := func() (filesystem.FileSystem, func()) {
+		const emptyBucketName = "test-bucket-empty"
+		emptyParams := s3Params
+		emptyParams.BucketName = emptyBucketName
+		emptyFS, err := filesystem.NewS3(ctx, emptyParams)
+		Expect(err).NotTo(HaveOccurred())
+		return emptyFS, func() {
+			Expect(minioClient.RemoveBucketWithOptions(ctx, emptyBucketName, minio.RemoveBucketOptions{
+				ForceDelete: true,
+			})).To(Succeed())
+		}
+	}
+
 	type walkDirEntry struct {
 		name  string
 		isDir bool
@@ -142,12 +332,394 @@ var _ = Describe("S3 FileSystem implementation", func() {
 			prepareSpec(s3Params)
 		})
 
+		It("checks walking an empty bucket", func() {
+			emptyFS, removeBucket := newEmptyBucketFS()
+			defer removeBucket()
+
+			var entriesWalked []walkDirEntry
+			Expect(emptyFS.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				entriesWalked = append(entriesWalked, walkDirEntry{name: name, isDir: de.IsDir()})
+				return nil
+			})).To(Succeed())
+			Expect(entriesWalked).To(Equal([]walkDirEntry{{name: "/", isDir: true}}))
+		})
+
+		It("checks reading the root directory of an empty bucket", func() {
+			emptyFS, removeBucket := newEmptyBucketFS()
+			defer removeBucket()
+
+			exists, err := emptyFS.Exists(ctx, "/"+filesystem.DirStubFileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+
+			fsi, err := emptyFS.ReadDir(ctx, "/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fsi).To(BeEmpty())
+
+			fsi, nextToken, err := emptyFS.(*filesystem.S3).ReadDirPage(ctx, "/", "", 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fsi).To(BeEmpty())
+			Expect(nextToken).To(BeEmpty())
+		})
+
 		It("checks that created bucket exists", func() {
 			exists, err := minioClient.BucketExists(ctx, bucketName)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(exists).To(BeTrue())
 		})
 
+		It("checks that callbacks are invoked once for an operation calling other operations", func() {
+			var before, after int
+			filesystem.SetBeforeOperationCB(func(ctx context.Context) (context.Context, error) {
+				before++
+				return ctx, nil
+			})
+			filesystem.SetAfterOperationCB(func(ctx context.Context) error {
+				after++
+				return nil
+			})
+
+			f, err := s3fs.Create(ctx, "/x/y/1.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(before).To(Equal(1))
+			Expect(after).To(Equal(1))
+
+			Expect(f.Close()).To(Succeed())
+		})
+
+		It("checks that the result callback observes the operation name, error and duration", func() {
+			type result struct {
+				op  string
+				err error
+				dur time.Duration
+			}
+			var results []result
+			filesystem.SetAfterOperationCB2(func(ctx context.Context, op string, err error, dur time.Duration) error {
+				results = append(results, result{op: op, err: err, dur: dur})
+				return nil
+			})
+			defer filesystem.SetAfterOperationCB2(nil)
+
+			_, err := s3fs.ReadFile(ctx, noSuchKey)
+			Expect(s3fs.IsNotExist(err)).To(BeTrue())
+			_, err = s3fs.ReadFile(ctx, key1)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(results).To(HaveLen(2))
+			Expect(results[0].op).To(Equal("S3.ReadFile"))
+			Expect(s3fs.IsNotExist(results[0].err)).To(BeTrue())
+			Expect(results[1].op).To(Equal("S3.ReadFile"))
+			Expect(results[1].err).NotTo(HaveOccurred())
+			for _, r := range results {
+				Expect(r.dur).To(BeNumerically(">", 0))
+				Expect(r.dur).To(BeNumerically("<", time.Minute))
+			}
+		})
+
+		It("checks that an error of the result callback is returned", func() {
+			errCallback := errors.New("callback error")
+			filesystem.SetAfterOperationCB2(func(context.Context, string, error, time.Duration) error {
+				return errCallback
+			})
+			defer filesystem.SetAfterOperationCB2(nil)
+			_, err := s3fs.ReadFile(ctx, key1)
+			Expect(err).To(MatchError(errCallback))
+		})
+
+		Describe("autoclosing many changed files", func() {
+			BeforeEach(func() {
+				s3Params.OpenedFilesClosers = 4
+			})
+
+			It("checks that all files expired simultaneously are flushed", func() {
+				const filesCount = 20
+				names := make([]string, filesCount)
+				for i := range names {
+					names[i] = fmt.Sprintf("/many/%d.txt", i)
+					f, err := s3fs.OpenW(ctx, names[i])
+					Expect(err).NotTo(HaveOccurred())
+					_, err = f.Write([]byte(names[i]))
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				Eventually(s3fs.(*filesystem.S3).OpenedFilesList().Len, 3*ttl, ttl/4).Should(BeZero())
+				for _, name := range names {
+					b, err := s3fs.ReadFile(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(b)).To(Equal(name))
+				}
+			})
+		})
+
+		Describe("structured logging", func() {
+			It("checks that emitted entries carry bucket and instance fields", func() {
+				l, hook := logtest.NewNullLogger()
+				s3Params.Logger = l
+				hookedFS, err := filesystem.NewS3(ctx, s3Params)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hookedFS.WriteFile(ctx, key1, []byte(content1))).To(Succeed())
+				_, err = hookedFS.Open(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(func() []*logrus.Entry { return hook.AllEntries() }, 3*ttl, ttl/2).ShouldNot(BeEmpty())
+				entry := hook.AllEntries()[0]
+				Expect(entry.Data).To(HaveKeyWithValue("bucket", bucketName))
+				Expect(entry.Data).To(HaveKeyWithValue("op", "openedFilesListCleaning"))
+				Expect(entry.Data).To(HaveKey("instance"))
+				Expect(entry.Data["instance"]).NotTo(BeEmpty())
+			})
+		})
+
+		Describe("errors classification", func() {
+			It("checks IsTimeout", func() {
+				s3 := s3fs.(*filesystem.S3)
+				Expect(s3.IsTimeout(nil)).To(BeFalse())
+				Expect(s3.IsTimeout(context.DeadlineExceeded)).To(BeTrue())
+				Expect(s3.IsTimeout(fmt.Errorf("wrapped: %w", context.DeadlineExceeded))).To(BeTrue())
+				Expect(s3.IsTimeout(minio.ErrorResponse{Code: "RequestTimeout", StatusCode: http.StatusBadRequest})).
+					To(BeTrue())
+				Expect(s3.IsTimeout(minio.ErrorResponse{StatusCode: http.StatusGatewayTimeout})).To(BeTrue())
+				Expect(s3.IsTimeout(minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound})).
+					To(BeFalse())
+				Expect(s3.IsTimeout(minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable})).
+					To(BeFalse())
+			})
+
+			It("checks IsThrottled", func() {
+				s3 := s3fs.(*filesystem.S3)
+				Expect(s3.IsThrottled(nil)).To(BeFalse())
+				Expect(s3.IsThrottled(minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable})).
+					To(BeTrue())
+				Expect(s3.IsThrottled(minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable})).To(BeTrue())
+				Expect(s3.IsThrottled(minio.ErrorResponse{StatusCode: http.StatusTooManyRequests})).To(BeTrue())
+				Expect(s3.IsThrottled(minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound})).
+					To(BeFalse())
+				Expect(s3.IsThrottled(context.DeadlineExceeded)).To(BeFalse())
+			})
+		})
+
+		Describe("Ping", func() {
+			var transport *hangingTransport
+			BeforeEach(func() {
+				transport = &hangingTransport{}
+				s3Params.Transport = transport
+			})
+
+			It("checks that Ping succeeds", func() {
+				Expect(s3fs.(*filesystem.S3).Ping(ctx)).To(Succeed())
+			})
+
+			It("checks that Ping fails fast on unreachable endpoint", func() {
+				transport.SetHanging(true)
+				ctxTimeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				defer cancel()
+				started := time.Now()
+				Expect(s3fs.(*filesystem.S3).Ping(ctxTimeout)).NotTo(Succeed())
+				Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+				transport.SetHanging(false)
+			})
+		})
+
+		Context("with session token", func() {
+			const sessionToken = "session-token"
+			var transport *headersRecordingTransport
+			BeforeEach(func() {
+				transport = &headersRecordingTransport{header: "X-Amz-Security-Token"}
+				s3Params.Transport = transport
+				s3Params.SessionToken = sessionToken
+			})
+
+			It("checks that session token is sent with requests", func() {
+				values := transport.Values()
+				Expect(values).NotTo(BeEmpty())
+				for _, value := range values {
+					Expect(value).To(Equal(sessionToken))
+				}
+			})
+		})
+
+		Context("with requester pays", func() {
+			var transport *headersRecordingTransport
+			BeforeEach(func() {
+				transport = &headersRecordingTransport{header: "X-Amz-Request-Payer"}
+				s3Params.Transport = transport
+				s3Params.RequesterPays = true
+			})
+
+			It("checks that request payer is sent with reading and listing requests", func() {
+				valuesBefore := len(transport.Values())
+				actualContent, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(actualContent).To(BeEquivalentTo(content1))
+				_, err = s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = s3fs.ReadDir(ctx, dir1)
+				Expect(err).NotTo(HaveOccurred())
+
+				values := transport.Values()[valuesBefore:]
+				Expect(values).NotTo(BeEmpty())
+				for _, value := range values {
+					Expect(value).To(Equal("requester"))
+				}
+			})
+		})
+
+		Context("without requester pays", func() {
+			var transport *headersRecordingTransport
+			BeforeEach(func() {
+				transport = &headersRecordingTransport{header: "X-Amz-Request-Payer"}
+				s3Params.Transport = transport
+			})
+
+			It("checks that request payer is not sent", func() {
+				_, err := s3fs.ReadDir(ctx, dir1)
+				Expect(err).NotTo(HaveOccurred())
+				values := transport.Values()
+				Expect(values).NotTo(BeEmpty())
+				for _, value := range values {
+					Expect(value).To(BeEmpty())
+				}
+			})
+		})
+
+		Context("without root stub creation", func() {
+			BeforeEach(func() {
+				createRootStub := false
+				s3Params.CreateRootStub = &createRootStub
+			})
+
+			It("checks that root stub does not exist", func() {
+				_, err := minioClient.StatObject(ctx, bucketName, "/"+filesystem.DirStubFileName, minio.StatObjectOptions{})
+				Expect(minio.ToErrorResponse(err).Code).To(Equal("NoSuchKey"))
+			})
+
+			It("checks Stat on root directory", func() {
+				fi, err := s3fs.Stat(ctx, "/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.IsDir()).To(BeTrue())
+			})
+
+			It("checks walking an empty bucket", func() {
+				emptyFS, removeBucket := newEmptyBucketFS()
+				defer removeBucket()
+
+				var entriesWalked []walkDirEntry
+				Expect(emptyFS.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					entriesWalked = append(entriesWalked, walkDirEntry{name: name, isDir: de.IsDir()})
+					return nil
+				})).To(Succeed())
+				Expect(entriesWalked).To(Equal([]walkDirEntry{{name: "/", isDir: true}}))
+			})
+
+			It("checks Stat on root directory of an empty bucket", func() {
+				emptyFS, removeBucket := newEmptyBucketFS()
+				defer removeBucket()
+
+				fi, err := emptyFS.Stat(ctx, "/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.IsDir()).To(BeTrue())
+				Expect(fi.FullName()).To(Equal("/"))
+				Expect(fi.Size()).To(BeZero())
+			})
+		})
+
+		Context("with stub content type", func() {
+			const stubContentType = "application/x-directory"
+			BeforeEach(func() {
+				s3Params.StubContentType = stubContentType
+			})
+
+			It("checks content type of stub objects", func() {
+				for _, dirName := range []string{"/", dir0, dir1, dir2} {
+					objectInfo, err := minioClient.StatObject(ctx, bucketName, dirName+filesystem.DirStubFileName,
+						minio.StatObjectOptions{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(objectInfo.ContentType).To(Equal(stubContentType), "dirname=%q", dirName)
+				}
+			})
+		})
+
+		Context("with object locking", func() {
+			BeforeEach(func() {
+				s3Params.ObjectLocking = true
+			})
+
+			AfterEach(func() { // governance mode retention should be cleared to allow the bucket removal
+				for key := range keyToContent {
+					Expect(minioClient.PutObjectRetention(ctx, bucketName, key, minio.PutObjectRetentionOptions{
+						GovernanceBypass: true,
+					})).To(Succeed())
+				}
+			})
+
+			It("checks that created bucket has object locking enabled", func() {
+				objectLock, _, _, _, err := minioClient.GetObjectLockConfig(ctx, bucketName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(objectLock).To(Equal("Enabled"))
+			})
+
+			It("checks setting and getting retention of an object", func() {
+				until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+				Expect(s3fs.(*filesystem.S3).SetRetention(ctx, key1, filesystem.RetentionGovernance, until)).
+					To(Succeed())
+
+				mode, actualUntil, err := s3fs.(*filesystem.S3).GetRetention(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mode).To(Equal(filesystem.RetentionGovernance))
+				Expect(actualUntil).To(BeTemporally("==", until))
+			})
+
+			It("checks getting retention of not existing object", func() {
+				_, _, err := s3fs.(*filesystem.S3).GetRetention(ctx, noSuchKey)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("with env-based credentials provider", func() {
+			var (
+				transport *headersRecordingTransport
+				envToSet  = map[string]string{"MINIO_ROOT_USER": accessKey, "MINIO_ROOT_PASSWORD": secretKey}
+				prevEnv   map[string]*string
+			)
+			BeforeEach(func() {
+				prevEnv = make(map[string]*string)
+				for key, value := range envToSet {
+					if prevValue, wasSet := os.LookupEnv(key); wasSet {
+						prevEnv[key] = &prevValue
+					}
+					Expect(os.Setenv(key, value)).To(Succeed())
+				}
+				transport = &headersRecordingTransport{header: "Authorization"}
+				s3Params.Transport = transport
+				s3Params.AccessKey, s3Params.SecretKey = "", ""
+				s3Params.Credentials = credentials.NewEnvMinio()
+			})
+
+			AfterEach(func() {
+				for key := range envToSet {
+					if prevValue := prevEnv[key]; prevValue != nil {
+						Expect(os.Setenv(key, *prevValue)).To(Succeed())
+						continue
+					}
+					Expect(os.Unsetenv(key)).To(Succeed())
+				}
+			})
+
+			It("checks that operations work with credentials from env", func() {
+				actualContent, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(actualContent).To(BeEquivalentTo(content1))
+
+				values := transport.Values()
+				Expect(values).NotTo(BeEmpty())
+				for _, value := range values {
+					Expect(value).To(ContainSubstring("Credential=" + accessKey + "/"))
+				}
+			})
+		})
+
 		It("checks that not created bucket does not exists", func() {
 			exists, err := minioClient.BucketExists(ctx, noSuchBucket)
 			Expect(err).NotTo(HaveOccurred())
@@ -162,6 +734,137 @@ var _ = Describe("S3 FileSystem implementation", func() {
 			}
 		})
 
+		Describe("MakeDir", func() {
+			It("checks that only the stub of the given directory is created", func() {
+				const newDir = "/m/n/o/"
+				Expect(s3fs.(*filesystem.S3).MakeDir(ctx, newDir)).To(Succeed())
+
+				var keys []string
+				for objectInfo := range minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+					Prefix:    "m/",
+					Recursive: true,
+				}) {
+					Expect(objectInfo.Err).NotTo(HaveOccurred())
+					keys = append(keys, "/"+strings.TrimPrefix(objectInfo.Key, "/"))
+				}
+				Expect(keys).To(Equal([]string{newDir + filesystem.DirStubFileName}))
+
+				fi, err := s3fs.Stat(ctx, newDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.IsDir()).To(BeTrue())
+			})
+		})
+
+		Describe("RepairStubs", func() {
+			It("checks repairing removed stubs", func() {
+				for _, dirName := range []string{dir1, dir2} {
+					Expect(minioClient.RemoveObject(ctx, bucketName, dirName+filesystem.DirStubFileName,
+						minio.RemoveObjectOptions{})).To(Succeed())
+				}
+				_, err := s3fs.Stat(ctx, dir1)
+				Expect(err).To(HaveOccurred())
+
+				created, err := s3fs.(*filesystem.S3).RepairStubs(ctx, dir1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(created).To(Equal(2))
+				for _, dirName := range []string{"/", dir0, dir1, dir2} {
+					fi, err := s3fs.Stat(ctx, dirName)
+					Expect(err).NotTo(HaveOccurred(), "dirName %q", dirName)
+					Expect(fi.IsDir()).To(BeTrue(), "dirName %q", dirName)
+				}
+
+				By("repairing again", func() {
+					created, err := s3fs.(*filesystem.S3).RepairStubs(ctx, "/")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(created).To(BeZero())
+				})
+			})
+
+			It("checks repairing stubs above the prefix", func() {
+				Expect(minioClient.RemoveObject(ctx, bucketName, dir0+filesystem.DirStubFileName,
+					minio.RemoveObjectOptions{})).To(Succeed())
+				created, err := s3fs.(*filesystem.S3).RepairStubs(ctx, dir2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(created).To(Equal(1))
+				_, err = s3fs.Stat(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("checks repairing a non-directory", func() {
+				_, err := s3fs.(*filesystem.S3).RepairStubs(ctx, key1)
+				Expect(err).To(MatchError(filesystem.ErrNotADirectory))
+			})
+		})
+
+		Describe("ReadFileInto", func() {
+			It("checks reading an object into a buffer of exact size", func() {
+				buf := make([]byte, len(content1))
+				n, err := s3fs.ReadFileInto(ctx, key1, buf)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf[:n]).To(BeEquivalentTo(content1))
+			})
+
+			It("checks reading an object into a larger buffer", func() {
+				buf := make([]byte, 2*len(content1))
+				n, err := s3fs.ReadFileInto(ctx, key1, buf)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n).To(Equal(len(content1)))
+				Expect(buf[:n]).To(BeEquivalentTo(content1))
+			})
+
+			It("checks reading an object into a smaller buffer", func() {
+				buf := make([]byte, len(content1)-1)
+				n, err := s3fs.ReadFileInto(ctx, key1, buf)
+				Expect(err).To(MatchError(io.ErrShortBuffer))
+				Expect(n).To(BeZero())
+			})
+		})
+
+		Describe("Head", func() {
+			It("checks reading the first bytes of an object", func() {
+				b, err := s3fs.Head(ctx, key1, 4)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1[:4]))
+			})
+
+			It("checks reading the first bytes of an object shorter than requested", func() {
+				b, err := s3fs.Head(ctx, key1, int64(2*len(content1)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks reading the first bytes of an empty object", func() {
+				const name = "/x/empty.txt"
+				Expect(s3fs.WriteFile(ctx, name, nil)).To(Succeed())
+				b, err := s3fs.Head(ctx, name, 4)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEmpty())
+			})
+
+			It("checks reading the first bytes of a non-existent object", func() {
+				_, err := s3fs.Head(ctx, noSuchKey, 4)
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Describe("ReadFileLimited", func() {
+			It("checks reading an object under the limit", func() {
+				b, err := s3fs.(*filesystem.S3).ReadFileLimited(ctx, key1, int64(len(content1)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks reading an object over the limit", func() {
+				_, err := s3fs.(*filesystem.S3).ReadFileLimited(ctx, key1, int64(len(content1))-1)
+				Expect(err).To(MatchError(filesystem.ErrObjectTooLarge))
+			})
+
+			It("checks reading a non-existent object", func() {
+				_, err := s3fs.(*filesystem.S3).ReadFileLimited(ctx, noSuchKey, 1)
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
 		Describe("Opening files in various modes, closing and autoclosing", func() {
 			var (
 				openedFilesList *filesystem.S3OpenedFilesList
@@ -216,34 +919,116 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				})
 			})
 
-			Context("Opening file for reading", func() {
-				JustBeforeEach(func() {
+			It("checks OpenedFiles snapshot", func() {
+				f1, err := s3fs.Open(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(f1.Close()).To(Succeed()) }()
+				f2, err := s3fs.Open(ctx, key2)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(f2.Close()).To(Succeed()) }()
+
+				s3 := s3fs.(*filesystem.S3)
+				openedFiles := s3.OpenedFiles()
+				Expect(openedFiles).To(HaveLen(2))
+				Expect(openedFiles[0].ObjectName).To(Equal(key1))
+				Expect(openedFiles[0].LocalName).To(Equal(s3.TempFileName(key1)))
+				Expect(openedFiles[0].Added).To(BeTemporally("~", time.Now(), 2*time.Second))
+				Expect(openedFiles[1].ObjectName).To(Equal(key2))
+				Expect(openedFiles[1].LocalName).To(Equal(s3.TempFileName(key2)))
+				Expect(openedFiles[1].Added).To(BeTemporally("~", time.Now(), 2*time.Second))
+			})
+
+			Context("MaxOpenFiles is 1", func() {
+				BeforeEach(func() { s3Params.MaxOpenFiles = 1 })
+
+				It("checks that the second open fails in fail-fast mode", func() {
 					f, err = s3fs.Open(ctx, key1)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(f).NotTo(BeNil())
 					opened = true
 
-					openedFilesList = s3fs.(*filesystem.S3).OpenedFilesList()
-					Expect(openedFilesList).NotTo(BeNil())
-					Expect(openedFilesList.Len()).To(Equal(1))
-				})
-
-				It("checks Close", func() {
-					s3FileEntry := lookUpForSingleEntry()
-					Expect(s3FileEntry.Added).To(BeTemporally("~", time.Now(), 2*time.Second))
+					f2, err := s3fs.Open(ctx, key2)
+					Expect(err).To(MatchError(filesystem.ErrTooManyOpenFiles))
+					Expect(f2).To(BeNil())
+					Expect(s3fs.(*filesystem.S3).OpenedFiles()).To(HaveLen(1))
 
-					name := s3FileEntry.S3File.LocalName()
-					Expect(name).To(Equal(s3fs.(*filesystem.S3).TempFileName(key1)))
-					Expect(s3FileEntry.S3File.Close()).To(Succeed())
+					Expect(f.Close()).To(Succeed())
 					opened = false
 
-					By("checking that file was removed at Close call", func() {
-						Expect(isExists(name)).To(BeFalse())
-					})
+					f2, err = s3fs.Open(ctx, key2)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f2.Close()).To(Succeed())
 				})
 
-				It("checks autoclosing", func() {
-					s3FileEntry := lookUpForSingleEntry()
+				When("MaxOpenFilesWait is negative", func() {
+					BeforeEach(func() { s3Params.MaxOpenFilesWait = -1 })
+
+					It("checks that the second open blocks until the first file is closed", func() {
+						f, err = s3fs.Open(ctx, key1)
+						Expect(err).NotTo(HaveOccurred())
+						opened = true
+
+						openedC := make(chan filesystem.File)
+						go func() {
+							defer GinkgoRecover()
+							f2, err := s3fs.Open(ctx, key2)
+							Expect(err).NotTo(HaveOccurred())
+							openedC <- f2
+						}()
+						Consistently(openedC, ttl/4).ShouldNot(Receive())
+
+						Expect(f.Close()).To(Succeed())
+						opened = false
+
+						var f2 filesystem.File
+						Eventually(openedC, ttl).Should(Receive(&f2))
+						Expect(f2.Close()).To(Succeed())
+					})
+				})
+
+				When("MaxOpenFilesWait is positive", func() {
+					BeforeEach(func() { s3Params.MaxOpenFilesWait = ttl / 4 })
+
+					It("checks that the second open fails after the timeout", func() {
+						f, err = s3fs.Open(ctx, key1)
+						Expect(err).NotTo(HaveOccurred())
+						opened = true
+
+						now := time.Now()
+						_, err := s3fs.Open(ctx, key2)
+						Expect(err).To(MatchError(filesystem.ErrTooManyOpenFiles))
+						Expect(time.Now()).To(BeTemporally(">=", now.Add(ttl/4)))
+					})
+				})
+			})
+
+			Context("Opening file for reading", func() {
+				JustBeforeEach(func() {
+					f, err = s3fs.Open(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f).NotTo(BeNil())
+					opened = true
+
+					openedFilesList = s3fs.(*filesystem.S3).OpenedFilesList()
+					Expect(openedFilesList).NotTo(BeNil())
+					Expect(openedFilesList.Len()).To(Equal(1))
+				})
+
+				It("checks Close", func() {
+					s3FileEntry := lookUpForSingleEntry()
+					Expect(s3FileEntry.Added).To(BeTemporally("~", time.Now(), 2*time.Second))
+
+					name := s3FileEntry.S3File.LocalName()
+					Expect(name).To(Equal(s3fs.(*filesystem.S3).TempFileName(key1)))
+					Expect(s3FileEntry.S3File.Close()).To(Succeed())
+					opened = false
+
+					By("checking that file was removed at Close call", func() {
+						Expect(isExists(name)).To(BeFalse())
+					})
+				})
+
+				It("checks autoclosing", func() {
+					s3FileEntry := lookUpForSingleEntry()
 					Eventually(func() bool {
 						return isExists(s3FileEntry.S3File.LocalName())
 					}, 3*ttl, ttl/2).Should(BeFalse()) // to give slightly more time to the cleaner goroutine
@@ -254,6 +1039,44 @@ var _ = Describe("S3 FileSystem implementation", func() {
 					Expect(err.Error()).To(ContainSubstring(fs.ErrClosed.Error()))
 				})
 
+				It("checks closing twice", func() {
+					Expect(f.Close()).To(Succeed())
+					opened = false
+					Expect(f.Close()).To(MatchError(fs.ErrClosed))
+
+					By("checking that the second Close does not affect the file opened again", func() {
+						f2, err := s3fs.Open(ctx, key1)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(f.Close()).To(MatchError(fs.ErrClosed))
+						Expect(s3fs.(*filesystem.S3).OpenedFilesList().Len()).To(Equal(1))
+						Expect(f2.Close()).To(Succeed())
+					})
+				})
+
+				It("checks that a stale Close does not affect the file opened concurrently", func() {
+					opened2 := make(chan filesystem.File)
+					go func() {
+						defer GinkgoRecover()
+						f2, err := s3fs.Open(ctx, key1) // waits for f to be closed
+						Expect(err).NotTo(HaveOccurred())
+						opened2 <- f2
+					}()
+					Consistently(opened2, ttl/4).ShouldNot(Receive())
+
+					Expect(f.Close()).To(Succeed())
+					opened = false
+					var f2 filesystem.File
+					Eventually(opened2, ttl).Should(Receive(&f2))
+					Expect(f2).NotTo(BeIdenticalTo(f))
+
+					Expect(f.Close()).To(MatchError(fs.ErrClosed))
+					Expect(s3fs.(*filesystem.S3).OpenedFilesList().Len()).To(Equal(1))
+					b, err := io.ReadAll(f2)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+					Expect(f2.Close()).To(Succeed())
+				})
+
 				It("checks reading from opened file", func() {
 					size, err := f.Seek(0, io.SeekEnd)
 					Expect(err).NotTo(HaveOccurred())
@@ -276,6 +1099,18 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				})
 			})
 
+			Context("opening a directory", func() {
+				It("checks that Open, Create and OpenW fail", func() {
+					for _, open := range []func(context.Context, string) (filesystem.File, error){
+						s3fs.Open, s3fs.Create, s3fs.OpenW,
+					} {
+						f, err := open(ctx, dir1)
+						Expect(err).To(MatchError(filesystem.ErrIsADirectory))
+						Expect(f).To(BeNil())
+					}
+				})
+			})
+
 			Context("operations with invalid (Windows) file names", func() {
 				It("checks that Create works", func() {
 					f1, err := s3fs.Create(ctx, invalidKey)
@@ -435,6 +1270,356 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				})
 			})
 
+			It("checks that instances for different buckets get distinct temporary files", func() {
+				const otherBucketName = "test-bucket-2"
+				otherParams := s3Params
+				otherParams.BucketName = otherBucketName
+				otherFS, err := filesystem.NewS3(ctx, otherParams)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() {
+					Expect(minioClient.RemoveBucketWithOptions(ctx, otherBucketName, minio.RemoveBucketOptions{
+						ForceDelete: true,
+					})).To(Succeed())
+				}()
+				Expect(otherFS.WriteFile(ctx, key1, []byte(content2))).To(Succeed())
+
+				f1, err := s3fs.Open(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(f1.Close()).To(Succeed()) }()
+				f2, err := otherFS.Open(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(f2.Close()).To(Succeed()) }()
+
+				localName1 := f1.(*filesystem.S3OpenedFile).LocalName()
+				localName2 := f2.(*filesystem.S3OpenedFile).LocalName()
+				Expect(localName1).NotTo(Equal(localName2))
+				b, err := io.ReadAll(f1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+				b, err = io.ReadAll(f2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content2))
+			})
+
+			It("checks that instances for the same bucket get distinct temporary files", func() {
+				f1, err := s3fs.Open(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(f1.Close()).To(Succeed()) }()
+
+				otherFS, err := filesystem.NewS3(ctx, s3Params) // its startup cleanup should not remove f1
+				Expect(err).NotTo(HaveOccurred())
+				Expect(otherFS.TempFileName(key1)).NotTo(Equal(s3fs.(*filesystem.S3).TempFileName(key1)))
+				f2, err := otherFS.Open(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(f2.Close()).To(Succeed()) }()
+				Expect(f1.(*filesystem.S3OpenedFile).LocalName()).
+					NotTo(Equal(f2.(*filesystem.S3OpenedFile).LocalName()))
+
+				b, err := io.ReadAll(f1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks that names which may collide get distinct temporary files", func() {
+				const name1, name2 = "/x/y.txt", "/x__y.txt"
+				s3 := s3fs.(*filesystem.S3)
+				Expect(s3.TempFileName(name1)).NotTo(Equal(s3.TempFileName(name2)))
+
+				f1, err := s3fs.Create(ctx, name1)
+				Expect(err).NotTo(HaveOccurred())
+				f2, err := s3fs.Create(ctx, name2) // should not wait for f1 to be closed
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f1.Write([]byte(content1))
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f2.Write([]byte(content2))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f1.(*filesystem.S3OpenedFile).LocalName()).
+					NotTo(Equal(f2.(*filesystem.S3OpenedFile).LocalName()))
+				Expect(f1.Close()).To(Succeed())
+				Expect(f2.Close()).To(Succeed())
+
+				for name, content := range map[string]string{name1: content1, name2: content2} {
+					b, err := s3fs.ReadFile(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content))
+				}
+			})
+
+			It("checks that CloseCtx with a cancelled context returns promptly", func() {
+				const name = "/x/cancelled.txt"
+				f, err := s3fs.Create(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f.Write([]byte(content1))
+				Expect(err).NotTo(HaveOccurred())
+
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+				started := time.Now()
+				Expect(f.(*filesystem.S3OpenedFile).CloseCtx(cancelledCtx)).To(MatchError(context.Canceled))
+				Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+				Expect(s3fs.(*filesystem.S3).OpenedFilesList().Len()).To(BeZero())
+				Expect(errors.Is(f.Close(), fs.ErrClosed)).To(BeTrue())
+
+				exists, err := s3fs.Exists(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+
+				f, err = s3fs.Create(ctx, name) // the entry is not left locked
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Close()).To(Succeed())
+			})
+
+			Context("with a transport denying writes", func() {
+				var transport *deniedPutsTransport
+				BeforeEach(func() {
+					transport = &deniedPutsTransport{}
+					s3Params.Transport = transport
+				})
+
+				It("checks that a failed Close removes the local file and the list entry", func() {
+					const name = "/x/denied.txt"
+					f, err := s3fs.Create(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = f.Write([]byte(content1))
+					Expect(err).NotTo(HaveOccurred())
+					localName := f.(*filesystem.S3OpenedFile).LocalName()
+					_, err = os.Stat(localName)
+					Expect(err).NotTo(HaveOccurred())
+
+					transport.SetDenying(true)
+					Expect(f.Close()).To(HaveOccurred())
+					transport.SetDenying(false)
+
+					_, err = os.Stat(localName)
+					Expect(os.IsNotExist(err)).To(BeTrue())
+					Expect(s3fs.(*filesystem.S3).OpenedFilesList().Len()).To(BeZero())
+
+					f, err = s3fs.Create(ctx, name) // the entry is not left locked
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f.Close()).To(Succeed())
+				})
+			})
+
+			Context("with in-memory open threshold", func() {
+				const threshold = 16
+				BeforeEach(func() {
+					s3Params.InMemoryOpenThreshold = threshold
+				})
+
+				checkOpenReadWrite := func(name, content string, inMemory bool) {
+					Expect(s3fs.WriteFile(ctx, name, []byte(content))).To(Succeed())
+					f, err := s3fs.OpenFile(ctx, name, os.O_RDWR, 0)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = os.Stat(f.(*filesystem.S3OpenedFile).LocalName())
+					Expect(os.IsNotExist(err)).To(Equal(inMemory))
+
+					b, err := io.ReadAll(f)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content))
+					_, err = f.Write([]byte("+"))
+					Expect(err).NotTo(HaveOccurred())
+					fi, err := f.Stat()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fi.Size()).To(BeEquivalentTo(len(content) + 1))
+					Expect(f.Close()).To(Succeed())
+
+					b, err = s3fs.ReadFile(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content + "+"))
+				}
+
+				It("checks that a small object is opened in memory", func() {
+					checkOpenReadWrite("/x/small.txt", strings.Repeat("s", threshold-1), true)
+				})
+
+				It("checks that a large object is opened in a temporary file", func() {
+					checkOpenReadWrite("/x/large.txt", strings.Repeat("l", threshold), false)
+				})
+
+				It("checks that created and truncated objects are opened in temporary files", func() {
+					content := strings.Repeat("c", 4*threshold)
+					for i, open := range []func(name string) (filesystem.File, error){
+						func(name string) (filesystem.File, error) { return s3fs.Create(ctx, name) },
+						func(name string) (filesystem.File, error) { return s3fs.(*filesystem.S3).CreateExcl(ctx, name) },
+						func(name string) (filesystem.File, error) {
+							return s3fs.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE, 0)
+						},
+						func(name string) (filesystem.File, error) {
+							Expect(s3fs.WriteFile(ctx, name, []byte(content1))).To(Succeed())
+							return s3fs.OpenFile(ctx, name, os.O_WRONLY|os.O_TRUNC, 0)
+						},
+					} {
+						name := fmt.Sprintf("/x/created%d.txt", i)
+						f, err := open(name)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = os.Stat(f.(*filesystem.S3OpenedFile).LocalName())
+						Expect(err).NotTo(HaveOccurred())
+						_, err = f.Write([]byte(content))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(f.Close()).To(Succeed())
+
+						b, err := s3fs.ReadFile(ctx, name)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(b).To(BeEquivalentTo(content))
+					}
+				})
+
+				It("checks that an object opened in memory for reading can't be written", func() {
+					f, err := s3fs.Open(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					defer func() { Expect(f.Close()).To(Succeed()) }()
+					_, err = f.Write([]byte(content2))
+					Expect(err).To(HaveOccurred())
+				})
+			})
+
+			It("checks that OpenW semantics are same for S3 and Local", func() {
+				localDir, err := os.MkdirTemp("", "filesystem-s3-test-")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(localDir)
+
+				const content = "123 456"
+				for _, tc := range []struct {
+					fs   filesystem.FileSystem
+					name string
+				}{
+					{fs: s3fs, name: key1},
+					{fs: fsLocal, name: filepath.Join(localDir, "1.txt")},
+				} {
+					Expect(tc.fs.WriteFile(ctx, tc.name, []byte(content1))).To(Succeed())
+					f, err := tc.fs.OpenW(ctx, tc.name)
+					Expect(err).NotTo(HaveOccurred())
+					offset, err := f.Seek(0, io.SeekCurrent)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(offset).To(BeZero(), "should be at the start, name %q", tc.name)
+					_, err = f.Write([]byte(content))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f.Close()).To(Succeed())
+
+					b, err := tc.fs.ReadFile(ctx, tc.name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content+content1[len(content):]),
+						"should be partially overwritten with trailing bytes preserved, name %q", tc.name)
+				}
+			})
+
+			It("checks opening not existing object for writing", func() {
+				const newKey = "/x/new.txt"
+				f, err := s3fs.OpenW(ctx, newKey)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f.Write([]byte(content1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Close()).To(Succeed())
+
+				b, err := s3fs.ReadFile(ctx, newKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			Describe("CreateExcl", func() {
+				const newKey = "/x/new.txt"
+
+				It("checks that an existing object is not created", func() {
+					_, err := s3fs.(*filesystem.S3).CreateExcl(ctx, key1)
+					Expect(errors.Is(err, fs.ErrExist)).To(BeTrue())
+					Expect(s3fs.(*filesystem.S3).OpenedFiles()).To(BeEmpty())
+
+					b, err := s3fs.ReadFile(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+				})
+
+				It("checks that a not existing object is created", func() {
+					f, err := s3fs.(*filesystem.S3).CreateExcl(ctx, newKey)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = f.Write([]byte(content1))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f.Close()).To(Succeed())
+
+					b, err := s3fs.ReadFile(ctx, newKey)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+				})
+
+				It("checks that an object created concurrently is not overwritten on closing", func() {
+					f, err := s3fs.(*filesystem.S3).CreateExcl(ctx, newKey)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = f.Write([]byte(content1))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(s3fs.WriteFile(ctx, newKey, []byte(content2))).To(Succeed())
+					Expect(errors.Is(f.Close(), fs.ErrExist)).To(BeTrue())
+
+					b, err := s3fs.ReadFile(ctx, newKey)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content2))
+				})
+			})
+
+			Context("Opening file with explicit flags", func() {
+				const newKey = "/x/new.txt"
+				writeAndClose := func(f filesystem.File, content string) {
+					_, err := f.Write([]byte(content))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f.Close()).To(Succeed())
+				}
+
+				It("checks that O_EXCL fails on existing object", func() {
+					_, err := s3fs.OpenFile(ctx, key1, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+					Expect(errors.Is(err, fs.ErrExist)).To(BeTrue())
+					Expect(s3fs.(*filesystem.S3).OpenedFiles()).To(BeEmpty())
+				})
+
+				It("checks that O_EXCL creates not existing object", func() {
+					f, err := s3fs.OpenFile(ctx, newKey, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(f.Close()).To(Succeed())
+
+					b, err := s3fs.ReadFile(ctx, newKey)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEmpty())
+				})
+
+				It("checks that O_RDWR preserves existing content", func() {
+					f, err := s3fs.OpenFile(ctx, key1, os.O_RDWR, 0666)
+					Expect(err).NotTo(HaveOccurred())
+					b, err := io.ReadAll(f)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+					_, err = f.Seek(0, io.SeekStart)
+					Expect(err).NotTo(HaveOccurred())
+					writeAndClose(f, "C")
+
+					b, err = s3fs.ReadFile(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo("Content 1"))
+				})
+
+				It("checks that O_RDWR without O_CREATE fails on not existing object", func() {
+					_, err := s3fs.OpenFile(ctx, newKey, os.O_RDWR, 0666)
+					Expect(s3fs.IsNotExist(err)).To(BeTrue())
+				})
+
+				It("checks O_TRUNC", func() {
+					f, err := s3fs.OpenFile(ctx, key1, os.O_WRONLY|os.O_TRUNC, 0666)
+					Expect(err).NotTo(HaveOccurred())
+					writeAndClose(f, "1")
+
+					b, err := s3fs.ReadFile(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo("1"))
+				})
+
+				It("checks O_APPEND", func() {
+					f, err := s3fs.OpenFile(ctx, key1, os.O_WRONLY|os.O_APPEND, 0666)
+					Expect(err).NotTo(HaveOccurred())
+					writeAndClose(f, " appended")
+
+					b, err := s3fs.ReadFile(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1 + " appended"))
+				})
+			})
+
 			Context("concurrent opening file for reading (writing behavior expected to be same)", func() {
 				JustBeforeEach(func() {
 					f, err = s3fs.Open(ctx, key1)
@@ -505,36 +1690,508 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(b).To(BeEquivalentTo(content2))
 			})
-		})
 
-		Describe("Exists", func() {
-			It("checks that Exists returns true for existing object", func() {
-				exists, err := s3fs.Exists(ctx, key2)
+			It("checks copying via io.WriterTo", func() {
+				r, err := s3fs.Reader(ctx, key2)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(exists).To(BeTrue())
-			})
+				defer func() { Expect(r.Close()).To(Succeed()) }()
+				writerTo, ok := r.(io.WriterTo)
+				Expect(ok).To(BeTrue())
 
-			It("checks that Exists returns false for not existing object", func() {
-				exists, err := s3fs.Exists(ctx, noSuchKey)
+				var buf bytes.Buffer
+				n, err := writerTo.WriteTo(&buf)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(exists).To(BeFalse())
+				Expect(n).To(BeEquivalentTo(len(content2)))
+				Expect(buf.String()).To(Equal(content2))
 			})
 
-			It("checks that Exists returns non-nil error for object with invalid name", func() {
-				_, err := s3fs.Exists(ctx, strings.Repeat("1", 1025)) // name too long
-				Expect(err).To(HaveOccurred())
+			It("checks copying a non-existent object via io.WriterTo", func() {
+				r, err := s3fs.Reader(ctx, noSuchKey)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(r.Close()).To(Succeed()) }()
+
+				var buf bytes.Buffer
+				_, err = io.Copy(&buf, r)
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
+				Expect(buf.Len()).To(BeZero())
 			})
 		})
 
-		Describe("MakePathAll, Exists on empty folder", func() {
-			folderPath := "/1/2/3/4"
-			It("checks that MakePathAll creates a stub file to precreate empty folder", func() {
-				Expect(s3fs.MakePathAll(ctx, folderPath)).To(Succeed())
+		Describe("OpenFresh", func() {
+			It("checks that changes of the file already opened are seen promptly", func() {
+				fw, err := s3fs.OpenW(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(fw.Close()).To(Succeed()) }()
+				_, err = fw.Write([]byte(content2))
+				Expect(err).NotTo(HaveOccurred())
 
-				By("checking Exists on empty folder path without trailing '/'", func() {
-					exists, err := s3fs.Exists(ctx, folderPath)
+				type result struct {
+					b   []byte
+					err error
+				}
+				resultC := make(chan result, 1)
+				go func() {
+					defer GinkgoRecover()
+					fr, err := s3fs.(*filesystem.S3).OpenFresh(ctx, key1)
+					if err != nil {
+						resultC <- result{err: err}
+						return
+					}
+					defer func() { Expect(fr.Close()).To(Succeed()) }()
+					b, err := io.ReadAll(fr)
+					resultC <- result{b: b, err: err}
+				}()
+
+				var r result
+				Eventually(resultC, ttl/2).Should(Receive(&r)) // without waiting for autoclosing of fw
+				Expect(r.err).NotTo(HaveOccurred())
+				Expect(r.b).To(BeEquivalentTo(content2))
+
+				b, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content2))
+			})
+
+			It("checks that changes are not written back while the holder writes them", func() {
+				fw, err := s3fs.OpenW(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(fw.Close()).To(Succeed()) }()
+				Expect(fw.Truncate(0)).To(Succeed())
+
+				const chunk, chunks = "0123456789", 100
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					for i := 0; i < chunks; i++ {
+						_, err := fw.Write([]byte(chunk))
+						Expect(err).NotTo(HaveOccurred())
+					}
+				}()
+
+				for finished := false; !finished; {
+					select {
+					case <-done:
+						finished = true
+					default:
+					}
+					fr, err := s3fs.(*filesystem.S3).OpenFresh(ctx, key1)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(exists).To(BeFalse(), "should be recognized as a file")
+					b, err := io.ReadAll(fr)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fr.Close()).To(Succeed())
+					Expect(len(b)%len(chunk)).To(BeZero(), "a half-written chunk is read: %q", b)
+				}
+			})
+
+			It("checks opening a non-existent object", func() {
+				_, err := s3fs.(*filesystem.S3).OpenFresh(ctx, noSuchKey)
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
+				Expect(s3fs.(*filesystem.S3).OpenedFilesList().Len()).To(BeZero())
+			})
+		})
+
+		Describe("WriteFileInfo", func() {
+			It("checks information of the written object", func() {
+				const name = "/x/1.txt"
+				fi, err := s3fs.WriteFileInfo(ctx, name, []byte(content1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.FullName()).To(Equal(name))
+				Expect(fi.Size()).To(BeEquivalentTo(len(content1)))
+				Expect(fi.IsDir()).To(BeFalse())
+				Expect(fi.ModTime()).To(BeTemporally("~", time.Now(), time.Minute))
+				Expect(fi.(filesystem.ETager).ETag()).NotTo(BeEmpty())
+
+				fiStat, err := s3fs.Stat(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.(filesystem.ETager).ETag()).To(Equal(fiStat.(filesystem.ETager).ETag()))
+			})
+		})
+
+		Describe("WriteFilesResult", func() {
+			It("checks that only the file with invalid name is reported as failed", func() {
+				invalidName := "/" + strings.Repeat("x", filesystem.MaxObjectKeyLength+1)
+				files := []filesystem.FileNameData{
+					{Name: "/batch/1.txt", Data: []byte(content1)},
+					{Name: invalidName, Data: []byte(content2)},
+					{Name: "/batch/2.txt", Data: []byte(content2)},
+					{Name: "/batch/3.txt", Data: []byte(content3)},
+				}
+				failed, err := s3fs.(*filesystem.S3).WriteFilesResult(ctx, files)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(failed).To(HaveLen(1))
+				Expect(failed[0].Name).To(Equal(invalidName))
+				Expect(failed[0].Err).To(MatchError(filesystem.ErrNameTooLong))
+
+				for _, file := range files {
+					if file.Name == invalidName {
+						continue
+					}
+					b, err := s3fs.ReadFile(ctx, file.Name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(Equal(file.Data))
+				}
+			})
+		})
+
+		Describe("WriteFilesFrom", func() {
+			It("checks writing objects from readers", func() {
+				files := map[string]string{
+					"/x/1.txt":     "content x1",
+					"/x/y/2.txt":   "content xy2",
+					"/x/y/z/3.txt": "content xyz3",
+				}
+				var f []filesystem.FileNameReader
+				for name, content := range files {
+					f = append(f, filesystem.FileNameReader{
+						Name:   name,
+						Reader: strings.NewReader(content),
+						Size:   int64(len(content)),
+					})
+				}
+				Expect(s3fs.(*filesystem.S3).WriteFilesFrom(ctx, f)).To(Succeed())
+
+				for name, content := range files {
+					b, err := s3fs.ReadFile(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content))
+				}
+				for _, dirName := range []string{"/x/", "/x/y/", "/x/y/z/"} {
+					exists, err := s3fs.Exists(ctx, dirName+filesystem.DirStubFileName)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeTrue(), "checking stub existence, dirname=%q", dirName)
+				}
+			})
+		})
+
+		Context("with max object size", func() {
+			const maxObjectSize = 16
+			var (
+				underLimit = strings.Repeat("1", maxObjectSize)
+				overLimit  = strings.Repeat("1", maxObjectSize+1)
+			)
+			const name = "/x/1.txt"
+			BeforeEach(func() {
+				s3Params.MaxObjectSize = maxObjectSize
+			})
+
+			expectNotExists := func() {
+				exists, err := s3fs.Exists(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+			}
+
+			It("checks WriteFile", func() {
+				Expect(s3fs.WriteFile(ctx, name, []byte(overLimit))).To(Equal(filesystem.ErrObjectTooLarge))
+				expectNotExists()
+				Expect(s3fs.WriteFile(ctx, name, []byte(underLimit))).To(Succeed())
+			})
+
+			It("checks WriteFilesFrom with unknown sizes", func() {
+				err := s3fs.(*filesystem.S3).WriteFilesFrom(ctx, []filesystem.FileNameReader{
+					{Name: name, Reader: strings.NewReader(overLimit), Size: -1},
+				})
+				Expect(errors.Is(err, filesystem.ErrObjectTooLarge)).To(BeTrue())
+				expectNotExists()
+				Expect(s3fs.(*filesystem.S3).WriteFilesFrom(ctx, []filesystem.FileNameReader{
+					{Name: name, Reader: strings.NewReader(underLimit), Size: -1},
+				})).To(Succeed())
+				b, err := s3fs.ReadFile(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(underLimit))
+			})
+
+			It("checks WriteFilesFrom with known sizes", func() {
+				err := s3fs.(*filesystem.S3).WriteFilesFrom(ctx, []filesystem.FileNameReader{
+					{Name: name, Reader: strings.NewReader(overLimit), Size: int64(len(overLimit))},
+				})
+				Expect(errors.Is(err, filesystem.ErrObjectTooLarge)).To(BeTrue())
+				expectNotExists()
+			})
+
+			It("checks CopyWithProgress", func() {
+				const srcName = "/x/src.txt"
+				_, err := minioClient.PutObject(ctx, bucketName, srcName, strings.NewReader(overLimit),
+					int64(len(overLimit)), minio.PutObjectOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s3fs.(*filesystem.S3).CopyWithProgress(ctx, srcName, name, nil)).
+					To(Equal(filesystem.ErrObjectTooLarge))
+				expectNotExists()
+			})
+
+			It("checks closing a file written over the limit", func() {
+				f, err := s3fs.Create(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f.Write([]byte(overLimit))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Close()).To(Equal(filesystem.ErrObjectTooLarge))
+				expectNotExists()
+			})
+
+			It("checks closing a file written under the limit", func() {
+				f, err := s3fs.Create(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f.Write([]byte(underLimit))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Close()).To(Succeed())
+				b, err := s3fs.ReadFile(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(underLimit))
+			})
+		})
+
+		Describe("WriteFileIfNotExists", func() {
+			It("checks that existing object is not overwritten", func() {
+				created, err := s3fs.(*filesystem.S3).WriteFileIfNotExists(ctx, key1, []byte("new content"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(created).To(BeFalse())
+
+				b, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks that exactly one of concurrent writers creates an object", func() {
+				const amount = 2
+				var (
+					wg           sync.WaitGroup
+					createdCount int64
+					winner       int64 = -1
+				)
+				wg.Add(amount)
+				for i := 0; i < amount; i++ {
+					go func(i int) {
+						defer GinkgoRecover()
+						defer wg.Done()
+						created, err := s3fs.(*filesystem.S3).WriteFileIfNotExists(ctx, noSuchKey,
+							[]byte(fmt.Sprintf("content %d", i)))
+						Expect(err).NotTo(HaveOccurred())
+						if created {
+							atomic.AddInt64(&createdCount, 1)
+							atomic.StoreInt64(&winner, int64(i))
+						}
+					}(i)
+				}
+				wg.Wait()
+				Expect(createdCount).To(BeEquivalentTo(1))
+
+				b, err := s3fs.ReadFile(ctx, noSuchKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(b)).To(Equal(fmt.Sprintf("content %d", winner)))
+			})
+		})
+
+		Describe("DownloadTree", func() {
+			It("checks mirroring a directory to local file system", func() {
+				destRoot, err := os.MkdirTemp("", "filesystem-s3-test-")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(destRoot)
+
+				Expect(s3fs.MakePathAll(ctx, dir0+"empty/")).To(Succeed())
+				Expect(filesystem.DownloadTree(ctx, s3fs.(*filesystem.S3), dir0, fsLocal.(*filesystem.Local),
+					destRoot)).To(Succeed())
+
+				for name, content := range map[string]string{
+					"3.txt":                            content3,
+					filepath.Join("b", "c_d", "1.txt"): content1,
+					filepath.Join("b", "c_d", "2.txt"): content2,
+				} {
+					b, err := os.ReadFile(filepath.Join(destRoot, name))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content))
+				}
+				fi, err := os.Stat(filepath.Join(destRoot, "empty"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.IsDir()).To(BeTrue())
+
+				var names []string
+				Expect(filepath.Walk(destRoot, func(name string, _ os.FileInfo, err error) error {
+					names = append(names, name)
+					return err
+				})).To(Succeed())
+				Expect(names).To(HaveLen(7), "root, 3 directories and 3 files expected, stubs should be skipped")
+			})
+		})
+
+		Describe("UploadTree", func() {
+			It("checks uploading a local directory", func() {
+				srcRoot, err := os.MkdirTemp("", "filesystem-s3-test-")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(srcRoot)
+
+				Expect(os.MkdirAll(filepath.Join(srcRoot, "a", "b"), 0777)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(srcRoot, "empty"), 0777)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(srcRoot, "1.txt"), []byte(content1), 0666)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(srcRoot, "a", "b", "2.txt"), []byte(content2), 0666)).To(Succeed())
+
+				const prefix = "/up"
+				Expect(filesystem.UploadTree(ctx, fsLocal.(*filesystem.Local), srcRoot, s3fs.(*filesystem.S3),
+					prefix)).To(Succeed())
+
+				for name, content := range map[string]string{
+					prefix + "/1.txt":     content1,
+					prefix + "/a/b/2.txt": content2,
+				} {
+					b, err := s3fs.ReadFile(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content))
+				}
+				for _, dirName := range []string{"/up/", "/up/a/", "/up/a/b/", "/up/empty/"} {
+					exists, err := s3fs.Exists(ctx, dirName+filesystem.DirStubFileName)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeTrue(), "checking stub existence, dirname=%q", dirName)
+				}
+			})
+		})
+
+		Describe("Exists", func() {
+			It("checks that Exists returns true for existing object", func() {
+				exists, err := s3fs.Exists(ctx, key2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+			})
+
+			It("checks that Exists returns false for not existing object", func() {
+				exists, err := s3fs.Exists(ctx, noSuchKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+			})
+
+			It("checks ExistsAsDir regardless of the trailing slash unlike Exists", func() {
+				dirNoSlash := strings.TrimSuffix(dir2, "/")
+				exists, err := s3fs.Exists(ctx, dirNoSlash)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+				for name, expected := range map[string]bool{dirNoSlash: true, dir2: true, key1: false, "/x": false} {
+					exists, err = s3fs.(*filesystem.S3).ExistsAsDir(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(Equal(expected), name)
+				}
+			})
+
+			It("checks that Exists returns non-nil error for object with invalid name", func() {
+				_, err := s3fs.Exists(ctx, strings.Repeat("1", 1025)) // name too long
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Describe("Rel", func() {
+			It("checks relative names", func() {
+				for _, tc := range []struct{ base, targ, expected string }{
+					{base: dir0, targ: key1, expected: "b/c_d/1.txt"},
+					{base: dir0, targ: dir2, expected: "b/c_d/"},
+					{base: dir2, targ: key3, expected: "../../3.txt"},
+					{base: "/", targ: key3, expected: "a/3.txt"},
+					{base: dir1, targ: dir1, expected: "."},
+					{base: key1, targ: dir2, expected: ".."},
+				} {
+					rel, err := s3fs.Rel(tc.base, tc.targ)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(rel).To(Equal(tc.expected), "base %q, target %q", tc.base, tc.targ)
+				}
+			})
+		})
+
+		Describe("SameName", func() {
+			It("checks names referring to the same object", func() {
+				for _, tc := range []struct {
+					a, b     string
+					expected bool
+				}{
+					{a: `C:\a\b.txt`, b: "/a/b.txt", expected: true},
+					{a: `\a\b.txt`, b: "a/b.txt", expected: true},
+					{a: "/a/./c/../b.txt", b: "/a/b.txt", expected: true},
+					{a: "/a/b/", b: `D:\a\b\`, expected: true},
+					{a: "", b: "/", expected: true},
+					{a: "/a/b/", b: "/a/b", expected: false},
+					{a: "/a/b.txt", b: "/a/c.txt", expected: false},
+				} {
+					Expect(s3fs.SameName(tc.a, tc.b)).To(Equal(tc.expected), "a %q, b %q", tc.a, tc.b)
+				}
+			})
+		})
+
+		Describe("NormalizeName", func() {
+			It("checks Windows path conversion", func() {
+				name, err := s3fs.(*filesystem.S3).NormalizeName(invalidKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(name).To(Equal("/1/2/3.txt"))
+			})
+
+			It("checks already normalized names", func() {
+				for _, key := range []string{key1, dir2, "/"} {
+					name, err := s3fs.(*filesystem.S3).NormalizeName(key)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(name).To(Equal(key))
+				}
+			})
+
+			It("checks names of max length and exceeding it", func() {
+				name, err := s3fs.(*filesystem.S3).NormalizeName(strings.Repeat("1", filesystem.MaxObjectKeyLength))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(name).To(Equal("/" + strings.Repeat("1", filesystem.MaxObjectKeyLength)))
+
+				_, err = s3fs.(*filesystem.S3).NormalizeName(strings.Repeat("1", 1025))
+				Expect(err).To(Equal(filesystem.ErrNameTooLong))
+			})
+
+			It("checks name with control characters", func() {
+				_, err := s3fs.(*filesystem.S3).NormalizeName("/a/1\x00.txt")
+				Expect(err).To(Equal(filesystem.ErrNameContainsControlCharacters))
+			})
+
+			It("checks that operations return ErrInvalidName for a too long name", func() {
+				name := strings.Repeat("1", filesystem.MaxObjectKeyLength+1)
+				_, err := s3fs.Exists(ctx, name)
+				Expect(errors.Is(err, filesystem.ErrInvalidName)).To(BeTrue())
+				_, err = s3fs.Stat(ctx, name)
+				Expect(errors.Is(err, filesystem.ErrInvalidName)).To(BeTrue())
+				_, err = s3fs.ReadFile(ctx, name)
+				Expect(errors.Is(err, filesystem.ErrInvalidName)).To(BeTrue())
+				err = s3fs.WriteFile(ctx, name, []byte(content1))
+				Expect(errors.Is(err, filesystem.ErrInvalidName)).To(BeTrue())
+				Expect(errors.Is(err, filesystem.ErrNameTooLong)).To(BeTrue())
+			})
+
+			It("checks that all operations taking names validate them", func() {
+				s3 := s3fs.(*filesystem.S3)
+				name := "/a/1\x00.txt"
+				for op, call := range map[string]func() error{
+					"ReadFileLimited": func() error { _, err := s3.ReadFileLimited(ctx, name, 1); return err },
+					"ReadFileInto":    func() error { _, err := s3.ReadFileInto(ctx, name, make([]byte, 1)); return err },
+					"Head":            func() error { _, err := s3.Head(ctx, name, 1); return err },
+					"Reader":          func() error { _, err := s3.Reader(ctx, name); return err },
+					"Open":            func() error { _, err := s3.Open(ctx, name); return err },
+					"Create":          func() error { _, err := s3.Create(ctx, name); return err },
+					"ReadDir":         func() error { _, err := s3.ReadDir(ctx, name+"/"); return err },
+					"Remove":          func() error { return s3.Remove(ctx, name) },
+					"RemoveFiles":     func() error { return s3.RemoveFiles(ctx, []string{key1, name}) },
+					"Rename":          func() error { return s3.Rename(ctx, key1, name) },
+					"SetModTime":      func() error { return s3.SetModTime(ctx, name, time.Now()) },
+					"MakePathAll":     func() error { return s3.MakePathAll(ctx, name) },
+					"Chown":           func() error { return s3.Chown(ctx, name, 0, 0) },
+					"WriteFiles": func() error {
+						return s3.WriteFiles(ctx, []filesystem.FileNameData{{Name: name, Data: []byte(content1)}})
+					},
+				} {
+					err := call()
+					Expect(errors.Is(err, filesystem.ErrInvalidName)).To(BeTrue(), op)
+				}
+				exists, err := s3fs.Exists(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+			})
+		})
+
+		Describe("MakePathAll, Exists on empty folder", func() {
+			folderPath := "/1/2/3/4"
+			It("checks that MakePathAll creates a stub file to precreate empty folder", func() {
+				Expect(s3fs.MakePathAll(ctx, folderPath)).To(Succeed())
+
+				By("checking Exists on empty folder path without trailing '/'", func() {
+					exists, err := s3fs.Exists(ctx, folderPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeFalse(), "should be recognized as a file")
 				})
 				By("checking Exists on empty folder path with trailing '/'", func() {
 					exists, err := s3fs.Exists(ctx, folderPath+"/")
@@ -725,6 +2382,31 @@ var _ = Describe("S3 FileSystem implementation", func() {
 			})
 		})
 
+		Describe("RemoveAndPrune", func() {
+			It("checks that parent directories which became empty are removed", func() {
+				Expect(s3fs.Remove(ctx, key2)).To(Succeed())
+				Expect(s3fs.(*filesystem.S3).RemoveAndPrune(ctx, key1)).To(Succeed())
+
+				for name, expected := range map[string]bool{key1: false, dir2: false, dir1: false, dir0: true, key3: true} {
+					exists, err := s3fs.Exists(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(Equal(expected), "name %q", name)
+				}
+				for _, dirName := range []string{dir2, dir1} {
+					exists, err := s3fs.Exists(ctx, dirName+filesystem.DirStubFileName)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeFalse(), "checking stub existence, dirname=%q", dirName)
+				}
+			})
+
+			It("checks that non-empty parent directory is not removed", func() {
+				Expect(s3fs.(*filesystem.S3).RemoveAndPrune(ctx, key1)).To(Succeed())
+				exists, err := s3fs.Exists(ctx, dir2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+			})
+		})
+
 		Describe("RemoveAll, should be applied to folders but not objects", func() {
 			It("checks removing existing object", func() {
 				Expect(s3fs.RemoveAll(ctx, key2)).To(Succeed())
@@ -821,65 +2503,741 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(isEmpty).To(BeTrue())
 			})
-		})
 
-		Describe("Rename", func() {
-			It("checks renaming object to new name which does not exists", func() {
-				Expect(s3fs.Rename(ctx, key1, noSuchKey)).To(Succeed())
-				b, err := s3fs.ReadFile(ctx, noSuchKey)
+			It("checks IsEmptyPathIgnoringStubs on nested empty directories", func() {
+				const dirName = "/x/"
+				Expect(s3fs.MakePathAll(ctx, dirName+"y/z/")).To(Succeed())
+				Expect(s3fs.MakePathAll(ctx, dirName+"w/")).To(Succeed())
+				e, err := s3fs.IsEmptyPath(ctx, dirName)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(b).To(BeEquivalentTo(content1))
+				Expect(e).To(BeFalse())
+				e, err = s3fs.(*filesystem.S3).IsEmptyPathIgnoringStubs(ctx, dirName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(e).To(BeTrue())
 
-				By("check that every subdir have stub file", func() {
-					for dirName := path.Dir(noSuchKey); dirName != "/"; dirName = path.Dir(dirName) {
-						exists, err := s3fs.Exists(ctx, dirName+"/"+filesystem.DirStubFileName)
-						Expect(err).NotTo(HaveOccurred(), "checking stub existence err, dirname=%q", dirName)
-						Expect(exists).To(BeTrue(), "checking stub existence, dirname=%q", dirName)
+				Expect(s3fs.WriteFile(ctx, dirName+"y/z/1.txt", []byte(content1))).To(Succeed())
+				e, err = s3fs.(*filesystem.S3).IsEmptyPathIgnoringStubs(ctx, dirName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(e).To(BeFalse())
+			})
+
+			When("using a counting transport", func() {
+				var transport *countingTransport
+				BeforeEach(func() {
+					transport = &countingTransport{}
+					s3Params.Transport = transport
+				})
+
+				It("checks that a single list request is made", func() {
+					const dir = "/1/2/3/4/"
+					Expect(s3fs.MakePathAll(ctx, dir)).To(Succeed())
+					for _, name := range []string{dir, dir0} {
+						count := transport.Count()
+						_, err := s3fs.IsEmptyPath(ctx, name)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(transport.Count()-count).To(BeEquivalentTo(1), "for %q", name)
 					}
 				})
 			})
+		})
 
-			It("checks renaming object to new name which already exists, should be replaced", func() {
-				Expect(s3fs.Rename(ctx, key1, key3)).To(Succeed())
-				b, err := s3fs.ReadFile(ctx, key3)
+		It("checks FreeSpace", func() {
+			_, err := s3fs.(*filesystem.S3).FreeSpace(ctx, "/")
+			Expect(err).To(MatchError(filesystem.ErrFreeSpaceUnknown))
+		})
+
+		Describe("PresignedPostPolicy", func() {
+			It("checks uploading an object with a presigned POST policy", func() {
+				const name = "/x/uploaded.txt"
+				postURL, formData, err := s3fs.(*filesystem.S3).PresignedPostPolicy(ctx, name, time.Minute, 1024)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(postURL).To(ContainSubstring(bucketName))
+				Expect(formData).To(HaveKeyWithValue("key", strings.TrimPrefix(name, "/")))
+				Expect(formData).To(HaveKey("policy"))
+
+				body := &bytes.Buffer{}
+				w := multipart.NewWriter(body)
+				for key, value := range formData {
+					Expect(w.WriteField(key, value)).To(Succeed())
+				}
+				fw, err := w.CreateFormFile("file", path.Base(name))
+				Expect(err).NotTo(HaveOccurred())
+				_, err = fw.Write([]byte(content1))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(w.Close()).To(Succeed())
+
+				resp, err := http.Post(postURL, w.FormDataContentType(), body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.Body.Close()).To(Succeed())
+				Expect(resp.StatusCode).To(BeNumerically("<", http.StatusMultipleChoices))
+
+				b, err := s3fs.ReadFile(ctx, name)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(b).To(BeEquivalentTo(content1))
 			})
 
-			It("checks renaming object to itself, do nothing", func() {
-				Expect(s3fs.Rename(ctx, key1, key1)).To(Succeed())
-				b, err := s3fs.ReadFile(ctx, key1)
+			It("checks presigning a POST policy for a directory", func() {
+				_, _, err := s3fs.(*filesystem.S3).PresignedPostPolicy(ctx, dir0, time.Minute, 1024)
+				Expect(err).To(MatchError(filesystem.ErrIsADirectory))
+			})
+		})
+
+		Describe("WriteFileWithOptions", func() {
+			const (
+				name               = "/x/1.txt"
+				cacheControl       = "max-age=3600"
+				contentDisposition = `attachment; filename="1.txt"`
+			)
+
+			checkHeaders := func(cacheControl, contentDisposition string) {
+				objectInfo, err := minioClient.StatObject(ctx, bucketName, name, minio.StatObjectOptions{})
 				Expect(err).NotTo(HaveOccurred())
-				Expect(b).To(BeEquivalentTo(content1))
+				Expect(objectInfo.Metadata.Get("Cache-Control")).To(Equal(cacheControl))
+				Expect(objectInfo.Metadata.Get("Content-Disposition")).To(Equal(contentDisposition))
+			}
+
+			It("checks writing with cache control and content disposition", func() {
+				Expect(s3fs.(*filesystem.S3).WriteFileWithOptions(ctx, name, []byte(content1), filesystem.WriteOptions{
+					CacheControl:       cacheControl,
+					ContentDisposition: contentDisposition,
+				})).To(Succeed())
+				checkHeaders(cacheControl, contentDisposition)
 			})
 
-			It("checks renaming not existing object, should fail", func() {
-				Expect(s3fs.Rename(ctx, noSuchKey, key1)).NotTo(Succeed())
-				b, err := s3fs.ReadFile(ctx, key1)
+			It("checks writing with expiration", func() {
+				const expireAfter = time.Hour
+				Expect(s3fs.(*filesystem.S3).WriteFileWithOptions(ctx, name, []byte(content1), filesystem.WriteOptions{
+					ExpireAfter: expireAfter,
+				})).To(Succeed())
+				objectTags, err := minioClient.GetObjectTagging(ctx, bucketName, name, minio.GetObjectTaggingOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				tagsMap := objectTags.ToMap()
+				Expect(tagsMap).To(HaveKey(filesystem.ExpireTagKey))
+				expiresAt, err := time.Parse(time.RFC3339, tagsMap[filesystem.ExpireTagKey])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(expiresAt).To(BeTemporally("~", time.Now().Add(expireAfter), time.Minute))
+			})
+
+			It("checks writing without expiration", func() {
+				Expect(s3fs.WriteFile(ctx, name, []byte(content1))).To(Succeed())
+				objectTags, err := minioClient.GetObjectTagging(ctx, bucketName, name, minio.GetObjectTaggingOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(objectTags.ToMap()).NotTo(HaveKey(filesystem.ExpireTagKey))
+			})
+
+			It("checks writing with content MD5", func() {
+				Expect(s3fs.(*filesystem.S3).WriteFileWithOptions(ctx, name, []byte(content1), filesystem.WriteOptions{
+					EnableContentMD5: true,
+				})).To(Succeed())
+				b, err := s3fs.ReadFile(ctx, name)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(b).To(BeEquivalentTo(content1))
 			})
 
-			Context("renaming directory", func() {
-				const (
-					existingDir    = "/a/"
-					notExistingDir = "/d/"
-				)
-				It("checks renaming existing directory into object, should fail", func() {
-					Expect(s3fs.Rename(ctx, existingDir, key1)).To(Equal(filesystem.ErrDestinationPathIsNotDirectory))
+			It("checks that content MD5 is sent only if enabled", func() {
+				s3 := s3fs.(*filesystem.S3)
+				Expect(filesystem.PutObjectOptions(s3, "text/plain", filesystem.WriteOptions{
+					EnableContentMD5: true,
+				}).SendContentMd5).To(BeTrue())
+				Expect(filesystem.PutObjectOptions(s3, "text/plain", filesystem.WriteOptions{}).SendContentMd5).To(BeFalse())
+			})
+
+			Context("with content MD5 enabled by default", func() {
+				var transport *headersRecordingTransport
+				BeforeEach(func() {
+					transport = &headersRecordingTransport{header: "Content-Md5"}
+					s3Params.Transport = transport
+					s3Params.EnableContentMD5 = true
 				})
 
-				It("checks renaming existing directory into another directory", func() {
-					Expect(s3fs.Rename(ctx, existingDir, notExistingDir)).To(Succeed())
+				It("checks that content MD5 is sent by WriteFile", func() {
+					Expect(filesystem.PutObjectOptions(s3fs.(*filesystem.S3), "text/plain",
+						filesystem.WriteOptions{}).SendContentMd5).To(BeTrue())
+					Expect(s3fs.WriteFile(ctx, name, []byte(content1))).To(Succeed())
+					sum := md5.Sum([]byte(content1))
+					Expect(transport.Values()).To(ContainElement(base64.StdEncoding.EncodeToString(sum[:])))
+				})
+			})
 
-					By("checking presence of new directory", func() {
-						exists, err := s3fs.Exists(ctx, notExistingDir)
-						Expect(err).NotTo(HaveOccurred())
-						Expect(exists).To(BeTrue())
-					})
-					By("checking absence of moved directory", func() {
-						exists, err := s3fs.Exists(ctx, existingDir)
-						Expect(err).NotTo(HaveOccurred())
+			Context("with defaults", func() {
+				const defaultCacheControl = "no-cache"
+				BeforeEach(func() {
+					s3Params.CacheControl = defaultCacheControl
+					s3Params.ContentDisposition = "inline"
+				})
+
+				It("checks that defaults are used by WriteFile", func() {
+					Expect(s3fs.WriteFile(ctx, name, []byte(content1))).To(Succeed())
+					checkHeaders(defaultCacheControl, "inline")
+				})
+
+				It("checks that defaults are overridden by the options", func() {
+					Expect(s3fs.(*filesystem.S3).WriteFileWithOptions(ctx, name, []byte(content1),
+						filesystem.WriteOptions{ContentDisposition: contentDisposition})).To(Succeed())
+					checkHeaders(defaultCacheControl, contentDisposition)
+				})
+			})
+		})
+
+		Describe("UserMetadata", func() {
+			It("checks that Stat exposes user metadata set at upload", func() {
+				_, err := minioClient.PutObject(ctx, bucketName, key1, strings.NewReader(content1),
+					int64(len(content1)), minio.PutObjectOptions{UserMetadata: map[string]string{"Owner": "someone"}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s3fs.SetModTime(ctx, key1, time.Now())).To(Succeed())
+
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.(filesystem.MetadataProvider).UserMetadata()).To(Equal(map[string]string{"Owner": "someone"}))
+			})
+
+			It("checks user metadata of a directory", func() {
+				fi, err := s3fs.Stat(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.(filesystem.MetadataProvider).UserMetadata()).To(BeEmpty())
+			})
+		})
+
+		Describe("StorageClass", func() {
+			const reducedRedundancy = "REDUCED_REDUNDANCY"
+
+			It("checks storage class of an object written with it", func() {
+				_, err := minioClient.PutObject(ctx, bucketName, key1, strings.NewReader(content1),
+					int64(len(content1)), minio.PutObjectOptions{StorageClass: reducedRedundancy})
+				Expect(err).NotTo(HaveOccurred())
+				storageClass, err := s3fs.(*filesystem.S3).StorageClass(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(storageClass).To(Equal(reducedRedundancy))
+
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.(filesystem.StorageClasser).StorageClass()).To(Equal(reducedRedundancy))
+			})
+
+			It("checks storage class of an object written without it", func() {
+				storageClass, err := s3fs.(*filesystem.S3).StorageClass(ctx, key3)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(storageClass).To(Equal(filesystem.StandardStorageClass))
+			})
+
+			It("checks storage class of a directory", func() {
+				storageClass, err := s3fs.(*filesystem.S3).StorageClass(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(storageClass).To(BeEmpty())
+			})
+
+			It("checks storage class of a non-existent object", func() {
+				_, err := s3fs.(*filesystem.S3).StorageClass(ctx, noSuchKey)
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Describe("Prefixed", func() {
+			const scope = "/scope"
+			var prefixedFS filesystem.FileSystem
+
+			JustBeforeEach(func() {
+				prefixedFS = filesystem.NewPrefixed(s3fs, scope)
+				Expect(prefixedFS.WriteFile(ctx, "/x/1.txt", []byte(content1))).To(Succeed())
+			})
+
+			It("checks that objects are written and read inside the prefix", func() {
+				b, err := s3fs.ReadFile(ctx, scope+"/x/1.txt")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+
+				b, err = prefixedFS.ReadFile(ctx, "x/1.txt")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+
+				fi, err := prefixedFS.Stat(ctx, "/x/1.txt")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.FullName()).To(Equal("/x/1.txt"))
+
+				fsi, err := prefixedFS.ReadDir(ctx, "/x/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi.FullNames()).To(Equal([]string{"/x/1.txt"}))
+			})
+
+			It("checks that walking is confined to the prefix and names are relative to it", func() {
+				var entriesWalked []walkDirEntry
+				Expect(prefixedFS.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					Expect(de.FullName()).To(Equal(name))
+					entriesWalked = append(entriesWalked, walkDirEntry{name: name, isDir: de.IsDir()})
+					return nil
+				})).To(Succeed())
+				Expect(entriesWalked).To(ConsistOf([]walkDirEntry{
+					{name: "/", isDir: true},
+					{name: "/x/", isDir: true},
+					{name: "/x/1.txt", isDir: false},
+				}))
+			})
+
+			It("checks that names escaping the prefix are rejected", func() {
+				for _, name := range []string{".." + key1, "/.." + key1, "/x/../.." + key1} {
+					_, err := prefixedFS.ReadFile(ctx, name)
+					Expect(err).To(MatchError(filesystem.ErrNameEscapesPrefix), "name %q", name)
+				}
+			})
+		})
+
+		Describe("PurgeAllVersions", func() {
+			It("checks purging all versions of an overwritten and removed object", func() {
+				Expect(minioClient.EnableVersioning(ctx, bucketName)).To(Succeed())
+				const name = "/x/1.txt"
+				for _, content := range []string{content1, content2, content3} {
+					Expect(s3fs.WriteFile(ctx, name, []byte(content))).To(Succeed())
+				}
+				Expect(s3fs.Remove(ctx, name)).To(Succeed())
+
+				countVersions := func(prefix string) (count int) {
+					for objectInfo := range minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+						Prefix:       prefix,
+						Recursive:    true,
+						WithVersions: true,
+					}) {
+						Expect(objectInfo.Err).NotTo(HaveOccurred())
+						count++
+					}
+					return
+				}
+				Expect(countVersions("x/1.txt")).To(Equal(4)) // three versions and a delete marker
+				versionsToPurge := countVersions("x/")        // also versions of the stub if empty dirs are emulated
+				versionsOutside := countVersions(dir0)
+
+				purged, err := s3fs.(*filesystem.S3).PurgeAllVersions(ctx, "/x/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(purged).To(Equal(versionsToPurge))
+				Expect(countVersions("x/")).To(BeZero())
+				Expect(countVersions(dir0)).To(Equal(versionsOutside))
+			})
+		})
+
+		Describe("incomplete uploads", func() {
+			const uploadKey = "/x/uploading.bin"
+
+			It("checks listing and aborting of an incomplete upload", func() {
+				uploadID, err := minio.Core{Client: minioClient}.NewMultipartUpload(ctx, bucketName, uploadKey,
+					minio.PutObjectOptions{})
+				Expect(err).NotTo(HaveOccurred())
+
+				uploads, err := s3fs.(*filesystem.S3).ListIncompleteUploads(ctx, "/x/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uploads).To(HaveLen(1))
+				Expect(uploads[0].Name).To(Equal(uploadKey))
+				Expect(uploads[0].UploadID).To(Equal(uploadID))
+
+				uploads, err = s3fs.(*filesystem.S3).ListIncompleteUploads(ctx, "/a/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uploads).To(BeEmpty())
+
+				aborted, err := s3fs.(*filesystem.S3).AbortIncompleteUploads(ctx, "/x/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(aborted).To(Equal(1))
+
+				uploads, err = s3fs.(*filesystem.S3).ListIncompleteUploads(ctx, "/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uploads).To(BeEmpty())
+				Expect(s3fs.Exists(ctx, uploadKey)).To(BeFalse())
+			})
+		})
+
+		Describe("CopyWithProgress", func() {
+			const dstKey = "/x/copied.txt"
+			var copied, total []int64
+			progress := func(c, t int64) {
+				copied, total = append(copied, c), append(total, t)
+			}
+
+			BeforeEach(func() {
+				copied, total = nil, nil
+			})
+
+			checkCopied := func() {
+				b, err := s3fs.ReadFile(ctx, dstKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+				Expect(copied).NotTo(BeEmpty())
+				Expect(copied[len(copied)-1]).To(BeEquivalentTo(len(content1)))
+				Expect(total[len(total)-1]).To(BeEquivalentTo(len(content1)))
+			}
+
+			Context("with an object above the threshold", func() {
+				BeforeEach(func() {
+					s3Params.CopyProgressThreshold = 1
+				})
+
+				It("checks copying with progress reported", func() {
+					modTime := time.Now().Add(-time.Hour).UTC()
+					Expect(s3fs.SetModTime(ctx, key1, modTime)).To(Succeed())
+					Expect(s3fs.(*filesystem.S3).CopyWithProgress(ctx, key1, dstKey, progress)).To(Succeed())
+					checkCopied()
+					fi, err := s3fs.Stat(ctx, dstKey)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fi.ModTime()).To(BeTemporally("~", modTime, time.Second))
+				})
+
+				It("checks that the default write options are applied to the copy", func() {
+					const defaultCacheControl = "no-cache"
+					s3Params.CacheControl = defaultCacheControl
+					copyingFS, err := filesystem.NewS3(ctx, s3Params)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(copyingFS.CopyWithProgress(ctx, key1, dstKey, progress)).To(Succeed())
+					checkCopied()
+					objectInfo, err := minioClient.StatObject(ctx, bucketName, dstKey, minio.StatObjectOptions{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(objectInfo.Metadata.Get("Cache-Control")).To(Equal(defaultCacheControl))
+				})
+			})
+
+			It("checks server-side copying of an object below the threshold", func() {
+				Expect(s3fs.(*filesystem.S3).CopyWithProgress(ctx, key1, dstKey, progress)).To(Succeed())
+				checkCopied()
+				Expect(copied).To(HaveLen(1))
+			})
+
+			It("checks copying a non-existent object", func() {
+				Expect(s3fs.(*filesystem.S3).CopyWithProgress(ctx, noSuchKey, dstKey, progress)).NotTo(Succeed())
+				Expect(copied).To(BeEmpty())
+			})
+
+			It("checks copying without progress", func() {
+				for _, threshold := range []int64{0, int64(len(content1))} {
+					s3Params.CopyProgressThreshold = threshold
+					copyingFS, err := filesystem.NewS3(ctx, s3Params)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(copyingFS.CopyWithProgress(ctx, key1, dstKey, nil)).To(Succeed())
+					b, err := s3fs.ReadFile(ctx, dstKey)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+					Expect(s3fs.Remove(ctx, dstKey)).To(Succeed())
+				}
+			})
+
+			It("checks server-side copying of an object larger than the max size of a single copy", func() {
+				transport := &headersRecordingTransport{header: "X-Amz-Copy-Source-Range"}
+				s3Params.Transport = transport
+				copyingFS, err := filesystem.NewS3(ctx, s3Params)
+				Expect(err).NotTo(HaveOccurred())
+				filesystem.SetMaxSingleCopySize(copyingFS, 1)
+				Expect(copyingFS.CopyWithProgress(ctx, key1, dstKey, progress)).To(Succeed())
+				checkCopied()
+				Expect(transport.Values()).To(ContainElement(Not(BeEmpty())), "copied by parts")
+			})
+		})
+
+		Describe("SyncObject", func() {
+			const dstKey = "/x/synced.txt"
+
+			sync := func(expected bool) {
+				copied, err := s3fs.(*filesystem.S3).SyncObject(ctx, key1, dstKey)
+				ExpectWithOffset(1, err).NotTo(HaveOccurred())
+				ExpectWithOffset(1, copied).To(Equal(expected))
+			}
+
+			expectSynced := func(content string) {
+				b, err := s3fs.ReadFile(ctx, dstKey)
+				ExpectWithOffset(1, err).NotTo(HaveOccurred())
+				ExpectWithOffset(1, b).To(BeEquivalentTo(content))
+			}
+
+			It("checks that an object is copied only if it differs", func() {
+				By("copying to a missing destination", func() {
+					sync(true)
+					expectSynced(content1)
+				})
+
+				By("syncing the same object again", func() {
+					sync(false)
+					expectSynced(content1)
+				})
+
+				By("syncing after the source is changed", func() {
+					Expect(s3fs.WriteFile(ctx, key1, []byte(content2))).To(Succeed())
+					sync(true)
+					expectSynced(content2)
+					sync(false)
+				})
+			})
+
+			It("checks syncing a directory", func() {
+				_, err := s3fs.(*filesystem.S3).SyncObject(ctx, dir0, dstKey)
+				Expect(err).To(MatchError(filesystem.ErrCantCopyS3Directory))
+			})
+
+			It("checks syncing a non-existent object", func() {
+				_, err := s3fs.(*filesystem.S3).SyncObject(ctx, noSuchKey, dstKey)
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Describe("CopyToBucket", func() {
+			const dstBucketName = "test-bucket-2"
+			var dstFS filesystem.FileSystem
+
+			BeforeEach(func() {
+				dstParams := s3Params
+				dstParams.BucketName = dstBucketName
+				dstFS, err = filesystem.NewS3(ctx, dstParams)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(minioClient.RemoveBucketWithOptions(ctx, dstBucketName, minio.RemoveBucketOptions{
+					ForceDelete: true,
+				})).To(Succeed())
+			})
+
+			It("checks copying an object to another bucket", func() {
+				const dstKey = "/x/copied.txt"
+				Expect(s3fs.(*filesystem.S3).CopyToBucket(ctx, key1, dstBucketName, dstKey)).To(Succeed())
+				b, err := dstFS.ReadFile(ctx, dstKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+
+				b, err = s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks copying to a non-existent bucket", func() {
+				Expect(s3fs.(*filesystem.S3).CopyToBucket(ctx, key1, noSuchBucket, key1)).
+					To(MatchError(filesystem.ErrBucketNotExists))
+			})
+
+			It("checks copying a directory", func() {
+				Expect(s3fs.(*filesystem.S3).CopyToBucket(ctx, dir0, dstBucketName, dir0)).
+					To(MatchError(filesystem.ErrCantCopyS3Directory))
+			})
+
+			It("checks copying a non-existent object", func() {
+				Expect(s3fs.(*filesystem.S3).CopyToBucket(ctx, noSuchKey, dstBucketName, key1)).NotTo(Succeed())
+			})
+		})
+
+		Describe("Rename", func() {
+			It("checks renaming object to new name which does not exists", func() {
+				Expect(s3fs.Rename(ctx, key1, noSuchKey)).To(Succeed())
+				b, err := s3fs.ReadFile(ctx, noSuchKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+
+				By("check that every subdir have stub file", func() {
+					for dirName := path.Dir(noSuchKey); dirName != "/"; dirName = path.Dir(dirName) {
+						exists, err := s3fs.Exists(ctx, dirName+"/"+filesystem.DirStubFileName)
+						Expect(err).NotTo(HaveOccurred(), "checking stub existence err, dirname=%q", dirName)
+						Expect(exists).To(BeTrue(), "checking stub existence, dirname=%q", dirName)
+					}
+				})
+			})
+
+			It("checks that destination stubs are put once per directory renaming a directory", func() {
+				const filesCount = 10
+				for i := 0; i < filesCount; i++ {
+					Expect(s3fs.WriteFile(ctx, fmt.Sprintf("/r/sub/%d.txt", i), []byte(content1))).To(Succeed())
+				}
+				transport := &putsRecordingTransport{}
+				s3Params.Transport = transport
+				recordingFS, err := filesystem.NewS3(ctx, s3Params)
+				Expect(err).NotTo(HaveOccurred())
+				putsBefore := len(transport.Paths())
+
+				Expect(recordingFS.Rename(ctx, "/r/", "/t/u/")).To(Succeed())
+				stubPuts := make(map[string]int)
+				for _, p := range transport.Paths()[putsBefore:] {
+					key := strings.TrimLeft(strings.TrimPrefix(p, "/"+bucketName), "/")
+					if strings.HasSuffix(key, "/"+filesystem.DirStubFileName) {
+						stubPuts[key]++
+					}
+				}
+				if s3Params.EmulateEmptyDirs {
+					Expect(stubPuts).To(Equal(map[string]int{"t/.dir": 1, "t/u/.dir": 1, "t/u/sub/.dir": 1}))
+				} else {
+					Expect(stubPuts).To(BeEmpty())
+				}
+
+				fsi, err := s3fs.ReadDir(ctx, "/t/u/sub/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi).To(HaveLen(filesCount))
+			})
+
+			It("checks renaming object to new name which already exists, should be replaced", func() {
+				Expect(s3fs.Rename(ctx, key1, key3)).To(Succeed())
+				b, err := s3fs.ReadFile(ctx, key3)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks renaming object to itself, do nothing", func() {
+				Expect(s3fs.Rename(ctx, key1, key1)).To(Succeed())
+				b, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks renaming not existing object, should fail", func() {
+				Expect(s3fs.Rename(ctx, noSuchKey, key1)).NotTo(Succeed())
+				b, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks renaming a directory containing files and an empty subdirectory", func() {
+				const emptyDir = dir1 + "empty/"
+				Expect(s3fs.MakePathAll(ctx, emptyDir)).To(Succeed())
+				const newDir0 = "/z/"
+				Expect(s3fs.Rename(ctx, dir0, newDir0)).To(Succeed())
+
+				for _, name := range []string{newDir0, "/z/b/", "/z/b/c_d/", "/z/b/empty/"} {
+					fi, err := s3fs.Stat(ctx, name)
+					Expect(err).NotTo(HaveOccurred(), "name %q", name)
+					Expect(fi.IsDir()).To(BeTrue(), "name %q", name)
+				}
+				fsi, err := s3fs.ReadDir(ctx, "/z/b/empty/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi).To(BeEmpty())
+				fsi, err = s3fs.ReadDir(ctx, "/z/b/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi.FullNames()).To(ConsistOf("/z/b/c_d/", "/z/b/empty/"))
+
+				b, err := s3fs.ReadFile(ctx, "/z/b/c_d/1.txt")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+
+				exists, err := s3fs.Exists(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+			})
+
+			Describe("RenameNoOverwrite", func() {
+				It("checks renaming object to new name which does not exists", func() {
+					Expect(s3fs.(*filesystem.S3).RenameNoOverwrite(ctx, key1, noSuchKey)).To(Succeed())
+					b, err := s3fs.ReadFile(ctx, noSuchKey)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+
+					exists, err := s3fs.Exists(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeFalse())
+				})
+
+				It("checks renaming object to new name which already exists, should fail", func() {
+					Expect(s3fs.(*filesystem.S3).RenameNoOverwrite(ctx, key1, key3)).To(Equal(filesystem.ErrDestinationExists))
+					for _, key := range []string{key1, key3} {
+						b, err := s3fs.ReadFile(ctx, key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(b).To(Equal(keyToContent[key]))
+					}
+				})
+
+				It("checks renaming directory into existing directory, should fail", func() {
+					Expect(s3fs.(*filesystem.S3).RenameNoOverwrite(ctx, dir2, dir0)).To(Equal(filesystem.ErrDestinationExists))
+					b, err := s3fs.ReadFile(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+				})
+			})
+
+			It("checks renaming objects larger than the max size of a single copy", func() {
+				filesystem.SetMaxSingleCopySize(s3fs.(*filesystem.S3), 1)
+				const renamedKey, renamedDir = "/renamed.txt", "/renamed/"
+				Expect(s3fs.Rename(ctx, key3, renamedKey)).To(Succeed())
+				Expect(s3fs.Rename(ctx, dir2, renamedDir)).To(Succeed())
+
+				for key, content := range map[string]string{
+					renamedKey:           content3,
+					renamedDir + "1.txt": content1,
+					renamedDir + "2.txt": content2,
+				} {
+					b, err := s3fs.ReadFile(ctx, key)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content))
+				}
+				for _, key := range []string{key1, key2, key3} {
+					exists, err := s3fs.Exists(ctx, key)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(BeFalse())
+				}
+			})
+
+			Describe("Swap", func() {
+				It("checks swapping objects", func() {
+					_, err := minioClient.CopyObject(ctx,
+						minio.CopyDestOptions{Bucket: bucketName, Object: key1, ReplaceMetadata: true,
+							UserMetadata: map[string]string{"Owner": "someone"}},
+						minio.CopySrcOptions{Bucket: bucketName, Object: key1})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(s3fs.Swap(ctx, key1, key3)).To(Succeed())
+					for key, content := range map[string]string{key1: content3, key3: content1} {
+						b, err := s3fs.ReadFile(ctx, key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(b).To(BeEquivalentTo(content))
+					}
+					fi, err := s3fs.Stat(ctx, key3)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fi.(filesystem.MetadataProvider).UserMetadata()).To(HaveKeyWithValue("Owner", "someone"))
+
+					names, err := s3fs.ReadDir(ctx, dir2)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(names.FullNames()).To(ConsistOf(key1, key2))
+				})
+
+				It("checks swapping with a non-existent object, should fail", func() {
+					err := s3fs.Swap(ctx, key1, noSuchKey)
+					Expect(s3fs.IsNotExist(err)).To(BeTrue())
+					for _, key := range []string{key1, noSuchKey} {
+						exists, err := s3fs.Exists(ctx, key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(exists).To(Equal(key == key1))
+					}
+					b, err := s3fs.ReadFile(ctx, key1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(BeEquivalentTo(content1))
+				})
+
+				It("checks swapping a directory, should fail", func() {
+					Expect(s3fs.Swap(ctx, dir2, key3)).To(Equal(filesystem.ErrIsADirectory))
+				})
+
+				It("checks swapping objects larger than the max size of a single copy", func() {
+					transport := &headersRecordingTransport{header: "X-Amz-Copy-Source-Range"}
+					s3Params.Transport = transport
+					swappingFS, err := filesystem.NewS3(ctx, s3Params)
+					Expect(err).NotTo(HaveOccurred())
+					filesystem.SetMaxSingleCopySize(swappingFS, 1)
+
+					Expect(swappingFS.Swap(ctx, key1, key3)).To(Succeed())
+					for key, content := range map[string]string{key1: content3, key3: content1} {
+						b, err := s3fs.ReadFile(ctx, key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(b).To(BeEquivalentTo(content))
+					}
+					Expect(transport.Values()).To(ContainElement(Not(BeEmpty())), "copied by parts")
+				})
+			})
+
+			Context("renaming directory", func() {
+				const (
+					existingDir    = "/a/"
+					notExistingDir = "/d/"
+				)
+				It("checks renaming existing directory into object, should fail", func() {
+					Expect(s3fs.Rename(ctx, existingDir, key1)).To(Equal(filesystem.ErrDestinationPathIsNotDirectory))
+				})
+
+				It("checks renaming existing directory into another directory", func() {
+					Expect(s3fs.Rename(ctx, existingDir, notExistingDir)).To(Succeed())
+
+					By("checking presence of new directory", func() {
+						exists, err := s3fs.Exists(ctx, notExistingDir)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(exists).To(BeTrue())
+					})
+					By("checking absence of moved directory", func() {
+						exists, err := s3fs.Exists(ctx, existingDir)
+						Expect(err).NotTo(HaveOccurred())
 						Expect(exists).To(BeFalse())
 					})
 
@@ -993,9 +3351,163 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				Expect(fi.Size()).To(BeZero())
 			})
 
-			It("checks for not existing directory", func() {
-				_, err := s3fs.Stat(ctx, "/4/5/6/7/")
-				Expect(err).To(HaveOccurred())
+			It("checks for not existing directory", func() {
+				_, err := s3fs.Stat(ctx, "/4/5/6/7/")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Describe("FS", func() {
+			It("checks Stat round-trip through the FileSystem of FileInfo", func() {
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.FS()).To(BeIdenticalTo(s3fs))
+				fi2, err := fi.FS().Stat(ctx, fi.FullName())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi2.FullName()).To(Equal(fi.FullName()))
+				Expect(fi2.Size()).To(Equal(fi.Size()))
+			})
+		})
+
+		Describe("ContentType", func() {
+			It("checks that Stat exposes content type of the object", func() {
+				const contentType = "application/json"
+				const name = "/x/1.json"
+				_, err := minioClient.PutObject(ctx, bucketName, name, strings.NewReader("{}"), 2,
+					minio.PutObjectOptions{ContentType: contentType})
+				Expect(err).NotTo(HaveOccurred())
+
+				fi, err := s3fs.Stat(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				contentTyper, ok := fi.(filesystem.ContentTyper)
+				Expect(ok).To(BeTrue())
+				Expect(contentTyper.ContentType()).To(Equal(contentType))
+			})
+		})
+
+		Describe("ETag", func() {
+			It("checks that Stat exposes entity tag of the object", func() {
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				eTager, ok := fi.(filesystem.ETager)
+				Expect(ok).To(BeTrue())
+				Expect(eTager.ETag()).NotTo(BeEmpty())
+
+				objectInfo, err := minioClient.StatObject(ctx, bucketName, key1, minio.StatObjectOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(eTager.ETag()).To(Equal(objectInfo.ETag))
+			})
+
+			It("checks that entity tag of a directory is empty", func() {
+				fi, err := s3fs.Stat(ctx, dir1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.(filesystem.ETager).ETag()).To(BeEmpty())
+			})
+		})
+
+		Describe("SetModTime", func() {
+			modTime := time.Date(2001, 2, 3, 4, 5, 6, 7, time.UTC)
+
+			It("checks setting modification time of an object", func() {
+				Expect(s3fs.SetModTime(ctx, key1, modTime)).To(Succeed())
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.ModTime()).To(BeTemporally("==", modTime))
+
+				b, err := s3fs.ReadFile(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(b).To(BeEquivalentTo(content1))
+			})
+
+			It("checks setting modification time of a directory", func() {
+				Expect(s3fs.SetModTime(ctx, dir2, modTime)).To(Succeed())
+				fi, err := s3fs.Stat(ctx, dir2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.ModTime()).To(BeTemporally("==", modTime))
+			})
+
+			It("checks setting modification time of not existing object", func() {
+				Expect(s3fs.IsNotExist(s3fs.SetModTime(ctx, noSuchKey, modTime))).To(BeTrue())
+			})
+
+			It("checks that system metadata are kept", func() {
+				const cacheControl, contentDisposition = "max-age=3600", `attachment; filename="1.txt"`
+				Expect(s3fs.(*filesystem.S3).WriteFileWithOptions(ctx, key1, []byte(content1), filesystem.WriteOptions{
+					CacheControl:       cacheControl,
+					ContentDisposition: contentDisposition,
+				})).To(Succeed())
+				Expect(s3fs.SetModTime(ctx, key1, modTime)).To(Succeed())
+
+				objectInfo, err := minioClient.StatObject(ctx, bucketName, key1, minio.StatObjectOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(objectInfo.Metadata.Get("Cache-Control")).To(Equal(cacheControl))
+				Expect(objectInfo.Metadata.Get("Content-Disposition")).To(Equal(contentDisposition))
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.ModTime()).To(BeTemporally("==", modTime))
+			})
+		})
+
+		Describe("Stat cache", func() {
+			var transport *countingTransport
+			BeforeEach(func() {
+				transport = &countingTransport{}
+				s3Params.Transport = transport
+				s3Params.StatCacheSize = 10
+				s3Params.StatCacheTTL = time.Minute
+			})
+
+			It("checks that a cache hit avoids a request", func() {
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.Size()).To(BeEquivalentTo(len(content1)))
+				count := transport.Count()
+
+				fi, err = s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.Size()).To(BeEquivalentTo(len(content1)))
+				exists, err := s3fs.Exists(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+				Expect(transport.Count()).To(Equal(count))
+			})
+
+			It("checks that ReadDir does not replace the cached information of the object", func() {
+				name := dir2 + "3.txt"
+				modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+				Expect(s3fs.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+				Expect(s3fs.SetModTime(ctx, name, modTime)).To(Succeed())
+				_, err := s3fs.ReadDir(ctx, dir2)
+				Expect(err).NotTo(HaveOccurred())
+
+				fi, err := s3fs.Stat(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.ModTime()).To(BeTemporally("==", modTime))
+				Expect(fi.(filesystem.ContentTyper).ContentType()).To(Equal(http.DetectContentType([]byte("content"))))
+			})
+
+			It("checks that WriteFile invalidates the cache entry", func() {
+				_, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+
+				newContent := []byte("new content 1")
+				Expect(s3fs.WriteFile(ctx, key1, newContent)).To(Succeed())
+				count := transport.Count()
+
+				fi, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.Size()).To(BeEquivalentTo(len(newContent)))
+				Expect(transport.Count()).To(BeNumerically(">", count))
+			})
+
+			It("checks that Remove invalidates the cache entry", func() {
+				_, err := s3fs.Stat(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s3fs.Remove(ctx, key1)).To(Succeed())
+
+				exists, err := s3fs.Exists(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
 			})
 		})
 
@@ -1092,6 +3604,86 @@ var _ = Describe("S3 FileSystem implementation", func() {
 						Expect(fsi).To(HaveLen(amount))
 					})
 				})
+
+				It("checks reading large amount of objects by pages", func() {
+					const (
+						amount   = 1500
+						pageSize = 500
+						largeDir = "/manyfiles/"
+					)
+					nameFunc := func(i int) string { return fmt.Sprintf("%sitem %d", largeDir, i) }
+					By("creating directory and objects", func() {
+						files := make([]filesystem.FileNameData, amount)
+						for i := 0; i < amount; i++ {
+							files[i] = filesystem.FileNameData{Name: nameFunc(i), Data: []byte(fmt.Sprintf("content %d", i))}
+						}
+						Expect(s3fs.WriteFiles(ctx, files)).To(Succeed())
+					})
+
+					seen := make(map[string]int, amount)
+					By("reading directory by pages", func() {
+						var token string
+						for pages := 1; ; pages++ {
+							fsi, nextToken, err := s3fs.(*filesystem.S3).ReadDirPage(ctx, largeDir, token, pageSize)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(len(fsi)).To(BeNumerically("<=", pageSize))
+							for _, name := range fsi.FullNames() {
+								seen[name]++
+							}
+							if token = nextToken; len(token) == 0 {
+								Expect(pages).To(Equal(amount / pageSize))
+								break
+							}
+							Expect(fsi).To(HaveLen(pageSize))
+						}
+					})
+
+					Expect(seen).To(HaveLen(amount))
+					for i := 0; i < amount; i++ {
+						Expect(seen[nameFunc(i)]).To(Equal(1), nameFunc(i))
+					}
+				})
+
+				It("checks counting large amount of objects", func() {
+					const (
+						amount   = 1500
+						largeDir = "/manyfiles/"
+					)
+					By("creating directory and objects", func() {
+						files := make([]filesystem.FileNameData, amount)
+						for i := 0; i < amount; i++ {
+							files[i] = filesystem.FileNameData{Name: fmt.Sprintf("%sitem %d", largeDir, i), Data: []byte("content")}
+						}
+						Expect(s3fs.WriteFiles(ctx, files)).To(Succeed())
+					})
+
+					var stubs int64
+					if s3Params.EmulateEmptyDirs {
+						stubs = 1
+					}
+					c, err := s3fs.CountObjects(ctx, largeDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c).To(Equal(amount + stubs))
+					c, err = s3fs.(*filesystem.S3).CountExcludingStubs(ctx, largeDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c).To(BeEquivalentTo(amount))
+
+					c, err = s3fs.(*filesystem.S3).CountExcludingStubs(ctx, "/")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c).To(BeEquivalentTo(amount + len(keyToContent)))
+
+					ctxCanceled, cancel := context.WithCancel(ctx)
+					cancel()
+					_, err = s3fs.CountObjects(ctxCanceled, "/")
+					Expect(err).To(HaveOccurred())
+				})
+
+				It("checks reading a page with invalid token or limit", func() {
+					_, _, err := s3fs.(*filesystem.S3).ReadDirPage(ctx, dir0, "?", 10)
+					Expect(err).To(Equal(filesystem.ErrInvalidPageToken))
+					_, _, err = s3fs.(*filesystem.S3).ReadDirPage(ctx, dir0, "", 0)
+					Expect(err).To(Equal(filesystem.ErrInvalidPageLimit))
+				})
 			})
 
 			When("ListDirectoryEntries is true", func() {
@@ -1107,6 +3699,21 @@ var _ = Describe("S3 FileSystem implementation", func() {
 					Expect(names).To(ConsistOf([]string{dir1, key3}))
 				})
 
+				It("checks reading dir with subdirs and objects by pages of one entry", func() {
+					var names []string
+					var token string
+					for {
+						fi, nextToken, err := s3fs.(*filesystem.S3).ReadDirPage(ctx, dir0, token, 1)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(fi).To(HaveLen(1))
+						names = append(names, fi.FullNames()...)
+						if token = nextToken; len(token) == 0 {
+							break
+						}
+					}
+					Expect(names).To(ConsistOf([]string{dir1, key3}))
+				})
+
 				It("checks reading existing empty dir", func() {
 					By("removing everything inside dir0", func() {
 						Expect(s3fs.Remove(ctx, key3)).To(Succeed())
@@ -1120,6 +3727,112 @@ var _ = Describe("S3 FileSystem implementation", func() {
 					Expect(names).To(BeEmpty())
 				})
 			})
+
+			It("checks toggling ListDirectoryEntries concurrently with ReadDir", func() {
+				const readers, reads = 4, 5
+				var wg sync.WaitGroup
+				errs := make(chan error, readers*reads)
+				for i := 0; i < readers; i++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						for j := 0; j < reads; j++ {
+							fi, err := s3fs.ReadDir(ctx, dir0)
+							if err == nil && len(fi) != 1 && len(fi) != 2 {
+								err = fmt.Errorf("unexpected entries: %v", fi.FullNames())
+							}
+							errs <- err
+						}
+					}()
+				}
+				for i := 0; i < readers*reads; i++ {
+					s3fs.(*filesystem.S3).SetListDirectoryEntries(i%2 == 0)
+				}
+				wg.Wait()
+				close(errs)
+				for err := range errs {
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+		})
+
+		Describe("Siblings", func() {
+			It("checks siblings of an object", func() {
+				fi, err := s3fs.Siblings(ctx, key1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.FullNames()).To(Equal([]string{key2}))
+			})
+
+			It("checks siblings of a directory", func() {
+				Expect(s3fs.WriteFile(ctx, "/a/b/4.txt", []byte("content"))).To(Succeed())
+				fi, err := s3fs.Siblings(ctx, dir2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.FullNames()).To(Equal([]string{"/a/b/4.txt"}))
+			})
+
+			It("checks siblings of an object alone in its directory", func() {
+				const name = "/x/1.txt"
+				Expect(s3fs.WriteFile(ctx, name, []byte("content"))).To(Succeed())
+				fi, err := s3fs.Siblings(ctx, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi).NotTo(BeNil())
+				Expect(fi).To(BeEmpty())
+			})
+		})
+
+		Describe("OpenDir", func() {
+			It("checks reading directory entries in batches", func() {
+				df, err := s3fs.(*filesystem.S3).OpenDir(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(df.Close()).To(Succeed()) }()
+
+				var dirFile fs.ReadDirFile = df
+				fi, err := dirFile.Stat()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.IsDir()).To(BeTrue())
+
+				By("reading the first batch", func() {
+					entries, err := dirFile.ReadDir(1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(entries).To(HaveLen(1))
+					Expect(entries[0].Name()).To(Equal(path.Base(key3)))
+					Expect(entries[0].IsDir()).To(BeFalse())
+				})
+
+				By("reading the second batch with fewer entries than requested", func() {
+					entries, err := dirFile.ReadDir(5)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(entries).To(HaveLen(1))
+					Expect(entries[0].Name()).To(Equal(path.Base(dir1)))
+					Expect(entries[0].IsDir()).To(BeTrue())
+				})
+
+				By("reading after all entries were read", func() {
+					entries, err := dirFile.ReadDir(5)
+					Expect(err).To(Equal(io.EOF))
+					Expect(entries).To(BeEmpty())
+
+					entries, err = dirFile.ReadDir(0)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(entries).To(BeEmpty())
+				})
+			})
+
+			It("checks reading all directory entries at once", func() {
+				df, err := s3fs.(*filesystem.S3).OpenDir(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(df.Close()).To(Succeed()) }()
+
+				entries, err := df.ReadDir(-1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(2))
+			})
+
+			It("checks opening not existing directory", func() {
+				_, err := s3fs.(*filesystem.S3).OpenDir(ctx, noSuchKey)
+				Expect(err).To(HaveOccurred())
+			})
 		})
 
 		Describe("WalkDir", func() {
@@ -1172,12 +3885,14 @@ var _ = Describe("S3 FileSystem implementation", func() {
 
 			It("checks for not-existing directory", func() {
 				var entriesWalked []walkDirEntry
-				Expect(s3fs.IsNotExist(s3fs.WalkDir(ctx, "/4/5/6/7/", func(name string, de filesystem.DirEntry, e error) error {
+				err := s3fs.WalkDir(ctx, "/4/5/6/7/", func(name string, de filesystem.DirEntry, e error) error {
 					if de != nil {
 						entriesWalked = append(entriesWalked, walkDirEntry{name: de.FullName(), isDir: de.IsDir()})
 					}
 					return nil
-				}))).To(BeTrue())
+				})
+				Expect(err).To(Equal(filesystem.ErrDirectoryNotExists))
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
 				Expect(entriesWalked).To(BeEmpty())
 			})
 
@@ -1191,6 +3906,273 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				}))).To(BeTrue())
 				Expect(entriesWalked).To(BeEmpty())
 			})
+
+			It("checks stopping the walk after the first file", func() {
+				var entriesWalked []walkDirEntry
+				Expect(s3fs.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					entriesWalked = append(entriesWalked, walkDirEntry{name: de.FullName(), isDir: de.IsDir()})
+					if !de.IsDir() {
+						return filesystem.ErrStopWalk
+					}
+					return nil
+				})).To(Succeed())
+				Expect(entriesWalked).To(Equal([]walkDirEntry{
+					{name: "/", isDir: true},
+					{name: "/a/", isDir: true},
+					{name: "/a/3.txt", isDir: false},
+				}))
+			})
+
+			Context("with max walk depth", func() {
+				const deepKey = "/1/2/3/4/5/6/7/8.txt"
+				BeforeEach(func() {
+					s3Params.MaxWalkDepth = 5
+				})
+
+				It("checks walking a deeply nested structure", func() {
+					Expect(s3fs.WriteFile(ctx, deepKey, []byte(content1))).To(Succeed())
+					var names []string
+					Expect(s3fs.WalkDir(ctx, "/1/", func(name string, de filesystem.DirEntry, e error) error {
+						names = append(names, name)
+						return e
+					})).To(Equal(filesystem.ErrMaxDepthExceeded))
+					Expect(names).To(Equal([]string{"/1/", "/1/2/", "/1/2/3/", "/1/2/3/4/", "/1/2/3/4/5/", "/1/2/3/4/5/6/"}))
+				})
+
+				It("checks walking a structure within the limit", func() {
+					Expect(s3fs.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+						return e
+					})).To(Succeed())
+				})
+			})
+
+			It("checks walking with stats", func() {
+				var visited int64
+				stats, err := s3fs.(*filesystem.S3).WalkDirWithStats(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+					visited++
+					return e
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats).To(Equal(filesystem.WalkStats{
+					Files: 3,
+					Dirs:  4, // "/", dir0, dir1, dir2
+					Bytes: int64(len(content1) + len(content2) + len(content3)),
+				}))
+				Expect(visited).To(Equal(stats.Files + stats.Dirs))
+			})
+
+			It("checks that directory entries have modification time", func() {
+				Expect(s3fs.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					if de.IsDir() {
+						fi, err := de.Info()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(fi.ModTime()).To(BeTemporally("~", time.Now(), time.Minute), "name %q", name)
+					}
+					return nil
+				})).To(Succeed())
+			})
+
+			It("checks that files and directory entries are listed with a single listing request", func() {
+				transport := &methodsCountingTransport{}
+				s3Params.Transport = transport
+				countingFS, err := filesystem.NewS3(ctx, s3Params)
+				Expect(err).NotTo(HaveOccurred())
+				listingsBefore, statsBefore := transport.Count(http.MethodGet), transport.Count(http.MethodHead)
+				fsi, err := countingFS.ReadDir(ctx, dir0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi.FullNames()).To(ConsistOf(key3, dir1))
+				Expect(transport.Count(http.MethodGet)-listingsBefore).To(Equal(1), "files and directories listing")
+				Expect(transport.Count(http.MethodHead)-statsBefore).To(Equal(1), "directory stub stat")
+
+				By("checking that ModTime makes no requests", func() {
+					requestsBefore := transport.Count(http.MethodGet) + transport.Count(http.MethodHead)
+					for _, fi := range fsi {
+						Expect(fi.ModTime()).To(BeTemporally("~", time.Now(), time.Minute), "name %q", fi.FullName())
+					}
+					Expect(transport.Count(http.MethodGet) + transport.Count(http.MethodHead)).To(Equal(requestsBefore))
+				})
+			})
+
+			It("checks that a failed directory stub stat fails reading the directory", func() {
+				s3Params.Transport = &deniedStatTransport{suffix: dir1 + filesystem.DirStubFileName}
+				failingFS, err := filesystem.NewS3(ctx, s3Params)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = failingFS.ReadDir(ctx, dir0)
+				Expect(err).To(HaveOccurred())
+				Expect(failingFS.IsNotExist(err)).To(BeFalse())
+				_, _, err = failingFS.ReadDirPage(ctx, dir0, "", 10)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("checks reading a directory including stubs", func() {
+				const emptyDir = "/empty/"
+				Expect(s3fs.MakePathAll(ctx, emptyDir)).To(Succeed())
+				fsi, err := s3fs.(*filesystem.S3).ReadDirWithOptions(ctx, emptyDir,
+					filesystem.ReadDirOptions{IncludeStubs: true})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi).To(HaveLen(1))
+				Expect(fsi[0].FullName()).To(Equal(emptyDir + filesystem.DirStubFileName))
+				Expect(fsi[0].IsDir()).To(BeFalse())
+
+				By("checking that stubs are hidden by default", func() {
+					fsi, err := s3fs.ReadDir(ctx, emptyDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fsi).To(BeEmpty())
+				})
+			})
+
+			It("checks reading a directory with deep subtrees", func() {
+				const deepFilesCount = 30
+				for i := 0; i < deepFilesCount; i++ {
+					Expect(s3fs.WriteFile(ctx, fmt.Sprintf("/deep/a/b/c/d/%d.txt", i), []byte(content1))).To(Succeed())
+				}
+				Expect(s3fs.WriteFile(ctx, "/deep/x/y/z/1.txt", []byte(content1))).To(Succeed())
+				Expect(s3fs.WriteFile(ctx, "/deep/1.txt", []byte(content1))).To(Succeed())
+
+				transport := &listedKeysCountingTransport{}
+				s3Params.Transport = transport
+				countingFS, err := filesystem.NewS3(ctx, s3Params)
+				Expect(err).NotTo(HaveOccurred())
+				keysBefore := transport.Count()
+				fsi, err := countingFS.ReadDir(ctx, "/deep/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi.FullNames()).To(ConsistOf("/deep/1.txt", "/deep/a/", "/deep/x/"))
+				Expect(transport.Count() - keysBefore).To(BeNumerically("<=", 2))
+
+				fsi, err = countingFS.ReadDirs(ctx, "/deep/")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fsi.FullNames()).To(ConsistOf("/deep/a/", "/deep/x/"))
+				for _, fi := range fsi {
+					Expect(fi.IsDir()).To(BeTrue())
+				}
+			})
+
+			It("checks WalkFiles, sizes of files should be populated", func() {
+				sizes := make(map[string]int64)
+				Expect(s3fs.WalkFiles(ctx, "/", func(fi filesystem.FileInfo, e error) error {
+					Expect(e).NotTo(HaveOccurred())
+					if !fi.IsDir() {
+						sizes[fi.FullName()] = fi.Size()
+					}
+					return nil
+				})).To(Succeed())
+				Expect(sizes).To(Equal(map[string]int64{
+					key1: int64(len(content1)),
+					key2: int64(len(content2)),
+					key3: int64(len(content3)),
+				}))
+			})
+
+			It("checks ContinueOnError, siblings of a failed directory should be visited", func() {
+				const key4 = "/a/e/4.txt"
+				Expect(s3fs.WriteFile(ctx, key4, []byte("content 4"))).To(Succeed())
+				s3Params.Transport = &deniedListingTransport{prefix: dir1}
+				failingFS, err := filesystem.NewS3(ctx, s3Params) // ReadDir of dir1 fails
+				Expect(err).NotTo(HaveOccurred())
+
+				var (
+					entriesWalked []walkDirEntry
+					failedNames   []string
+				)
+				walk := func(opts filesystem.WalkDirOptions) error {
+					entriesWalked, failedNames = nil, nil
+					return failingFS.WalkDirWithOptions(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+						if e != nil {
+							failedNames = append(failedNames, name)
+							return e
+						}
+						entriesWalked = append(entriesWalked, walkDirEntry{name: de.FullName(), isDir: de.IsDir()})
+						return nil
+					}, opts)
+				}
+				Expect(walk(filesystem.WalkDirOptions{})).NotTo(Succeed())
+				Expect(entriesWalked).NotTo(ContainElement(walkDirEntry{name: "/a/e/4.txt", isDir: false}))
+
+				Expect(walk(filesystem.WalkDirOptions{ContinueOnError: true})).To(Succeed())
+				Expect(failedNames).To(Equal([]string{dir1}))
+				Expect(entriesWalked).To(ConsistOf([]walkDirEntry{
+					{name: "/", isDir: true},
+					{name: "/a/", isDir: true},
+					{name: "/a/3.txt", isDir: false},
+					{name: "/a/b/", isDir: true},
+					{name: "/a/e/", isDir: true},
+					{name: "/a/e/4.txt", isDir: false},
+				}))
+			})
+
+			It("checks ModifiedAfter and ModifiedBefore, directories should be descended anyway", func() {
+				const key4 = "/a/e/4.txt"
+				walk := func(opts filesystem.WalkDirOptions) (entriesWalked []walkDirEntry, lastModTime time.Time) {
+					Expect(s3fs.WalkDirWithOptions(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+						Expect(e).NotTo(HaveOccurred())
+						entriesWalked = append(entriesWalked, walkDirEntry{name: de.FullName(), isDir: de.IsDir()})
+						if !de.IsDir() {
+							fi, err := de.Info()
+							Expect(err).NotTo(HaveOccurred())
+							if fi.ModTime().After(lastModTime) {
+								lastModTime = fi.ModTime()
+							}
+						}
+						return nil
+					}, opts)).To(Succeed())
+					return
+				}
+
+				_, cutoff := walk(filesystem.WalkDirOptions{})
+				time.Sleep(1100 * time.Millisecond) // object modification times may have a second precision
+				Expect(s3fs.WriteFile(ctx, key4, []byte("content 4"))).To(Succeed())
+
+				entriesWalked, lastModTime := walk(filesystem.WalkDirOptions{ModifiedAfter: cutoff})
+				Expect(entriesWalked).To(ConsistOf([]walkDirEntry{
+					{name: "/", isDir: true},
+					{name: "/a/", isDir: true},
+					{name: "/a/b/", isDir: true},
+					{name: "/a/b/c_d/", isDir: true},
+					{name: "/a/e/", isDir: true},
+					{name: "/a/e/4.txt", isDir: false},
+				}))
+
+				entriesWalked, _ = walk(filesystem.WalkDirOptions{ModifiedBefore: lastModTime})
+				Expect(entriesWalked).To(ConsistOf([]walkDirEntry{
+					{name: "/", isDir: true},
+					{name: "/a/", isDir: true},
+					{name: "/a/3.txt", isDir: false},
+					{name: "/a/b/", isDir: true},
+					{name: "/a/b/c_d/", isDir: true},
+					{name: "/a/b/c_d/1.txt", isDir: false},
+					{name: "/a/b/c_d/2.txt", isDir: false},
+					{name: "/a/e/", isDir: true},
+				}))
+			})
+
+			It("checks Limit, entries of skipped directories should not be counted", func() {
+				walk := func(limit int, skipDir string) (namesWalked []string, err error) {
+					err = s3fs.WalkDirWithOptions(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+						Expect(e).NotTo(HaveOccurred())
+						namesWalked = append(namesWalked, de.FullName())
+						if de.FullName() == skipDir {
+							return filesystem.ErrSkipDir
+						}
+						return nil
+					}, filesystem.WalkDirOptions{Limit: limit})
+					return
+				}
+
+				namesWalked, err := walk(3, "")
+				Expect(err).To(Equal(filesystem.ErrWalkTruncated))
+				Expect(namesWalked).To(HaveLen(3))
+
+				namesWalked, err = walk(7, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(namesWalked).To(HaveLen(7))
+
+				namesWalked, err = walk(4, dir1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(namesWalked).To(ConsistOf("/", dir0, key3, dir1))
+			})
 		})
 	})
 
@@ -1200,6 +4182,100 @@ var _ = Describe("S3 FileSystem implementation", func() {
 			prepareSpec(s3Params)
 		})
 
+		Context("with counting transport", func() {
+			var transport *countingTransport
+			BeforeEach(func() {
+				transport = &countingTransport{}
+				s3Params.Transport = transport
+			})
+
+			It("checks that Create makes no requests before closing", func() {
+				count := transport.Count()
+				f, err := s3fs.Create(ctx, "/x/y/z/1.txt")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(transport.Count() - count).To(BeZero())
+				Expect(f.Close()).To(Succeed())
+			})
+		})
+
+		Context("with listed keys counting transport", func() {
+			var transport *listedKeysCountingTransport
+			BeforeEach(func() {
+				transport = &listedKeysCountingTransport{}
+				s3Params.Transport = transport
+			})
+
+			It("checks that Stat of a large directory lists a single key", func() {
+				const (
+					amount   = 1100
+					largeDir = "/manyfiles/"
+				)
+				files := make([]filesystem.FileNameData, amount)
+				for i := range files {
+					files[i] = filesystem.FileNameData{Name: fmt.Sprintf("%sitem %d", largeDir, i), Data: []byte("content")}
+				}
+				Expect(s3fs.WriteFiles(ctx, files)).To(Succeed())
+
+				count := transport.Count()
+				fi, err := s3fs.Stat(ctx, largeDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fi.IsDir()).To(BeTrue())
+				Expect(fi.FullName()).To(Equal(largeDir))
+				Expect(fi.ModTime().IsZero()).To(BeTrue())
+				// the listing goroutine may request the next one-key page before the listing is cancelled
+				Expect(transport.Count() - count).To(BeNumerically("<=", 2))
+
+				_, err = s3fs.Stat(ctx, "/nosuchdir/")
+				Expect(err).To(MatchError(filesystem.ErrDirectoryNotExists))
+			})
+		})
+
+		It("checks walking an empty bucket", func() {
+			emptyFS, removeBucket := newEmptyBucketFS()
+			defer removeBucket()
+
+			var entriesWalked []walkDirEntry
+			Expect(emptyFS.WalkDir(ctx, "/", func(name string, de filesystem.DirEntry, e error) error {
+				Expect(e).NotTo(HaveOccurred())
+				entriesWalked = append(entriesWalked, walkDirEntry{name: name, isDir: de.IsDir()})
+				return nil
+			})).To(Succeed())
+			Expect(entriesWalked).To(Equal([]walkDirEntry{{name: "/", isDir: true}}))
+		})
+
+		It("checks Stat on root directory of an empty bucket", func() {
+			emptyFS, removeBucket := newEmptyBucketFS()
+			defer removeBucket()
+
+			fi, err := emptyFS.Stat(ctx, "/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fi.IsDir()).To(BeTrue())
+			Expect(fi.FullName()).To(Equal("/"))
+			Expect(fi.Size()).To(BeZero())
+		})
+
+		Describe("WriteFiles", func() {
+			It("checks that the feeder goroutine exits on context cancellation", func() {
+				const amount = 1000
+				files := make([]filesystem.FileNameData, amount)
+				for i := range files {
+					files[i] = filesystem.FileNameData{
+						Name: fmt.Sprintf("/manyfiles/item %d", i),
+						Data: []byte(fmt.Sprintf("content %d", i)),
+					}
+				}
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+				Expect(s3fs.WriteFiles(cancelledCtx, files)).To(MatchError(context.Canceled))
+
+				feedersRunning := func() int {
+					buf := make([]byte, 1<<20)
+					return strings.Count(string(buf[:runtime.Stack(buf, true)]), "filesystem.(*S3).WriteFiles.func")
+				}
+				Eventually(feedersRunning, ttl).Should(BeZero())
+			})
+		})
+
 		Describe("Exists", func() {
 			It("checks that Exists returns true for existing object", func() {
 				exists, err := s3fs.Exists(ctx, key2)
@@ -1213,6 +4289,18 @@ var _ = Describe("S3 FileSystem implementation", func() {
 				Expect(exists).To(BeFalse())
 			})
 
+			It("checks ExistsAsDir regardless of the trailing slash unlike Exists", func() {
+				dirNoSlash := strings.TrimSuffix(dir2, "/")
+				exists, err := s3fs.Exists(ctx, dirNoSlash)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+				for name, expected := range map[string]bool{dirNoSlash: true, dir2: true, key1: false, "/x": false} {
+					exists, err = s3fs.(*filesystem.S3).ExistsAsDir(ctx, name)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(exists).To(Equal(expected), name)
+				}
+			})
+
 			It("checks that Exists returns non-nil error for object with invalid name", func() {
 				_, err := s3fs.Exists(ctx, strings.Repeat("1", 1025)) // name too long
 				Expect(err).To(HaveOccurred())
@@ -1560,12 +4648,14 @@ var _ = Describe("S3 FileSystem implementation", func() {
 
 			It("checks for not-existing directory", func() {
 				var entriesWalked []walkDirEntry
-				Expect(s3fs.WalkDir(ctx, "/4/5/6/7/", func(name string, de filesystem.DirEntry, e error) error {
+				err := s3fs.WalkDir(ctx, "/4/5/6/7/", func(name string, de filesystem.DirEntry, e error) error {
 					if de != nil {
 						entriesWalked = append(entriesWalked, walkDirEntry{name: de.FullName(), isDir: de.IsDir()})
 					}
 					return nil
-				})).To(Equal(filesystem.ErrDirectoryNotExists))
+				})
+				Expect(err).To(Equal(filesystem.ErrDirectoryNotExists))
+				Expect(s3fs.IsNotExist(err)).To(BeTrue())
 				Expect(entriesWalked).To(BeEmpty())
 			})
 		})
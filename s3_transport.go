@@ -0,0 +1,30 @@
+package filesystem
+
+import (
+	"context"
+	"net/http"
+)
+
+// s3HeadersContextKey is a context key for additional HTTP headers of S3 requests
+type s3HeadersContextKey struct{}
+
+// withS3Headers returns a copy of ctx carrying additional HTTP headers to be sent with S3 requests
+func withS3Headers(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, s3HeadersContextKey{}, h)
+}
+
+// s3Transport wraps an HTTP transport to add the headers carried by a request context
+type s3Transport struct{ underlying http.RoundTripper }
+
+// RoundTrip makes s3Transport to implement http.RoundTripper
+func (t *s3Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	h, _ := r.Context().Value(s3HeadersContextKey{}).(http.Header)
+	if len(h) == 0 {
+		return t.underlying.RoundTrip(r)
+	}
+	r = r.Clone(r.Context())
+	for key, values := range h {
+		r.Header[key] = values
+	}
+	return t.underlying.RoundTrip(r)
+}
@@ -0,0 +1,290 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TeeOptions are options for Tee FileSystem
+type TeeOptions struct {
+	// FailOnSecondaryError makes operations to return errors of the secondary FileSystem,
+	// otherwise they are only logged
+	FailOnSecondaryError bool
+	Logger               logrus.FieldLogger // logrus standard logger by default
+}
+
+// Tee implements FileSystem performing operations changing files on both the primary and the secondary
+// FileSystems, e.g. to replicate files while migrating between them. The operations are performed on the secondary
+// FileSystem only if they succeed on the primary one, results of the primary FileSystem are returned.
+// Other operations are passed to the primary FileSystem only.
+// Files opened for writing are copied from the primary FileSystem to the secondary one on closing
+type Tee struct {
+	FileSystem // primary
+
+	secondary FileSystem
+	opts      TeeOptions
+}
+
+// NewTee returns a new FileSystem writing to both primary and secondary and reading from primary.
+// Errors of the secondary FileSystem are logged
+func NewTee(primary, secondary FileSystem) FileSystem {
+	return NewTeeWithOptions(primary, secondary, TeeOptions{})
+}
+
+// NewTeeWithOptions returns a new FileSystem like NewTee does with the given options
+func NewTeeWithOptions(primary, secondary FileSystem, opts TeeOptions) FileSystem {
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	return &Tee{FileSystem: primary, secondary: secondary, opts: opts}
+}
+
+// Secondary returns the secondary FileSystem
+func (t *Tee) Secondary() FileSystem { return t.secondary }
+
+// secondaryResult returns the error of the operation op on the secondary FileSystem if it should fail the operation,
+// otherwise it logs the error
+func (t *Tee) secondaryResult(op string, err error) error {
+	if err == nil || t.opts.FailOnSecondaryError {
+		return err
+	}
+	t.opts.Logger.WithFields(logrus.Fields{"op": op}).WithError(err).
+		Error("failed to perform operation on the secondary filesystem")
+	return nil
+}
+
+// replicate copies the file by name from the primary FileSystem to the secondary one
+func (t *Tee) replicate(ctx context.Context, name string) (err error) {
+	var r io.ReadCloser
+	if r, err = t.FileSystem.Reader(ctx, name); err != nil {
+		return
+	}
+	defer func() { _ = r.Close() }()
+	var f File
+	if f, err = t.secondary.Create(ctx, name); err != nil {
+		return
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return
+	}
+	return f.Close()
+}
+
+// WriteFile makes Tee to implement FileSystem
+func (t *Tee) WriteFile(ctx context.Context, name string, b []byte) error {
+	if err := t.FileSystem.WriteFile(ctx, name, b); err != nil {
+		return err
+	}
+	return t.secondaryResult("WriteFile", t.secondary.WriteFile(ctx, name, b))
+}
+
+// WriteFileInfo makes Tee to implement FileSystem
+func (t *Tee) WriteFileInfo(ctx context.Context, name string, b []byte) (FileInfo, error) {
+	fi, err := t.FileSystem.WriteFileInfo(ctx, name, b)
+	if err != nil {
+		return nil, err
+	}
+	return fi, t.secondaryResult("WriteFileInfo", t.secondary.WriteFile(ctx, name, b))
+}
+
+// WriteFiles makes Tee to implement FileSystem
+func (t *Tee) WriteFiles(ctx context.Context, files []FileNameData) error {
+	if err := t.FileSystem.WriteFiles(ctx, files); err != nil {
+		return err
+	}
+	return t.secondaryResult("WriteFiles", t.secondary.WriteFiles(ctx, files))
+}
+
+// WriteFilesResult makes Tee to implement FilesResultWriter. Only the files written to the primary FileSystem
+// are written to the secondary one
+func (t *Tee) WriteFilesResult(ctx context.Context, files []FileNameData) ([]FileNameError, error) {
+	failed, err := writeFilesResultOf(ctx, t.FileSystem, files)
+	if err != nil {
+		return failed, err
+	}
+	failedNames := make(map[string]struct{}, len(failed))
+	for _, f := range failed {
+		failedNames[f.Name] = struct{}{}
+	}
+	written := make([]FileNameData, 0, len(files))
+	for _, file := range files {
+		if _, ok := failedNames[file.Name]; !ok {
+			written = append(written, file)
+		}
+	}
+	return failed, t.secondaryResult("WriteFilesResult", t.secondary.WriteFiles(ctx, written))
+}
+
+// WriteFilesFrom makes Tee to implement FilesFromWriter. The readers are consumed by the primary FileSystem,
+// so the written files are copied from it to the secondary one
+func (t *Tee) WriteFilesFrom(ctx context.Context, files []FileNameReader) error {
+	if err := writeFilesFromOf(ctx, t.FileSystem, files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := t.secondaryResult("WriteFilesFrom", t.replicate(ctx, file.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create makes Tee to implement FileSystem. The file is copied to the secondary FileSystem on closing
+func (t *Tee) Create(ctx context.Context, name string) (File, error) {
+	return t.replicatingFile(ctx, name, t.FileSystem.Create)
+}
+
+// CreateExcl makes Tee to implement ExclusiveCreator. The file is copied to the secondary FileSystem on closing,
+// overwriting it there if it exists
+func (t *Tee) CreateExcl(ctx context.Context, name string) (File, error) {
+	return t.replicatingFile(ctx, name, func(ctx context.Context, name string) (File, error) {
+		return createExclOf(ctx, t.FileSystem, name)
+	})
+}
+
+// OpenW makes Tee to implement FileSystem. The file is copied to the secondary FileSystem on closing
+func (t *Tee) OpenW(ctx context.Context, name string) (File, error) {
+	return t.replicatingFile(ctx, name, t.FileSystem.OpenW)
+}
+
+// OpenFile makes Tee to implement FileSystem.
+// If the file is opened for writing, it is copied to the secondary FileSystem on closing
+func (t *Tee) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC) == 0 {
+		return t.FileSystem.OpenFile(ctx, name, flag, perm)
+	}
+	return t.replicatingFile(ctx, name, func(ctx context.Context, name string) (File, error) {
+		return t.FileSystem.OpenFile(ctx, name, flag, perm)
+	})
+}
+
+// replicatingFile opens the file by name for writing with open, it is replicated on closing
+func (t *Tee) replicatingFile(ctx context.Context, name string,
+	open func(context.Context, string) (File, error)) (File, error) {
+	f, err := open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return replicatingFile{File: f, replicate: func() error {
+		return t.secondaryResult("Close", t.replicate(ctx, name))
+	}}, nil
+}
+
+// MakePathAll makes Tee to implement FileSystem
+func (t *Tee) MakePathAll(ctx context.Context, name string) error {
+	if err := t.FileSystem.MakePathAll(ctx, name); err != nil {
+		return err
+	}
+	return t.secondaryResult("MakePathAll", t.secondary.MakePathAll(ctx, name))
+}
+
+// PreparePath makes Tee to implement FileSystem
+func (t *Tee) PreparePath(ctx context.Context, name string) (string, error) {
+	prepared, err := t.FileSystem.PreparePath(ctx, name)
+	if err != nil {
+		return prepared, err
+	}
+	_, err = t.secondary.PreparePath(ctx, name)
+	return prepared, t.secondaryResult("PreparePath", err)
+}
+
+// Remove makes Tee to implement FileSystem
+func (t *Tee) Remove(ctx context.Context, name string) error {
+	if err := t.FileSystem.Remove(ctx, name); err != nil {
+		return err
+	}
+	return t.secondaryResult("Remove", t.secondary.Remove(ctx, name))
+}
+
+// RemoveFiles makes Tee to implement FileSystem
+func (t *Tee) RemoveFiles(ctx context.Context, names []string) error {
+	if err := t.FileSystem.RemoveFiles(ctx, names); err != nil {
+		return err
+	}
+	return t.secondaryResult("RemoveFiles", t.secondary.RemoveFiles(ctx, names))
+}
+
+// RemoveAll makes Tee to implement FileSystem
+func (t *Tee) RemoveAll(ctx context.Context, name string) error {
+	if err := t.FileSystem.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+	return t.secondaryResult("RemoveAll", t.secondary.RemoveAll(ctx, name))
+}
+
+// Rename makes Tee to implement FileSystem
+func (t *Tee) Rename(ctx context.Context, from, to string) error {
+	if err := t.FileSystem.Rename(ctx, from, to); err != nil {
+		return err
+	}
+	return t.secondaryResult("Rename", t.secondary.Rename(ctx, from, to))
+}
+
+// RenameNoOverwrite makes Tee to implement NoOverwriteRenamer
+func (t *Tee) RenameNoOverwrite(ctx context.Context, from, to string) error {
+	if err := renameNoOverwriteOf(ctx, t.FileSystem, from, to); err != nil {
+		return err
+	}
+	return t.secondaryResult("RenameNoOverwrite", renameNoOverwriteOf(ctx, t.secondary, from, to))
+}
+
+// Swap makes Tee to implement FileSystem
+func (t *Tee) Swap(ctx context.Context, a, b string) error {
+	if err := t.FileSystem.Swap(ctx, a, b); err != nil {
+		return err
+	}
+	return t.secondaryResult("Swap", t.secondary.Swap(ctx, a, b))
+}
+
+// SetModTime makes Tee to implement FileSystem
+func (t *Tee) SetModTime(ctx context.Context, name string, mt time.Time) error {
+	if err := t.FileSystem.SetModTime(ctx, name, mt); err != nil {
+		return err
+	}
+	return t.secondaryResult("SetModTime", t.secondary.SetModTime(ctx, name, mt))
+}
+
+// ReadFileLimited makes Tee to implement LimitedFileReader, the file is read from the primary FileSystem
+func (t *Tee) ReadFileLimited(ctx context.Context, name string, maxBytes int64) ([]byte, error) {
+	return readFileLimitedOf(ctx, t.FileSystem, name, maxBytes)
+}
+
+// FreeSpace makes Tee to implement FreeSpacer, the space of the primary FileSystem is reported
+func (t *Tee) FreeSpace(ctx context.Context, name string) (uint64, error) {
+	return freeSpaceOf(ctx, t.FileSystem, name)
+}
+
+// WalkDirWithStats makes Tee to implement StatsWalker, the primary FileSystem is walked
+func (t *Tee) WalkDirWithStats(ctx context.Context, name string, walkDirFunc WalkDirFunc) (WalkStats, error) {
+	return walkDirWithStatsOf(ctx, t.FileSystem, name, walkDirFunc)
+}
+
+// Ping makes Tee to implement Pinger, the primary FileSystem is checked
+func (t *Tee) Ping(ctx context.Context) error { return pingOf(ctx, t.FileSystem) }
+
+// Chown makes Tee to implement Chowner
+func (t *Tee) Chown(ctx context.Context, name string, uid, gid int) error {
+	if err := chownOf(ctx, t.FileSystem, name, uid, gid); err != nil {
+		return err
+	}
+	return t.secondaryResult("Chown", chownOf(ctx, t.secondary, name, uid, gid))
+}
+
+// replicatingFile is a File replicated to the secondary FileSystem on closing
+type replicatingFile struct {
+	File
+	replicate func() error
+}
+
+// Close makes replicatingFile to implement File
+func (f replicatingFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return f.replicate()
+}
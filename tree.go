@@ -0,0 +1,140 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"path"
+	"path/filepath"
+)
+
+// DownloadTree mirrors S3 directory with the given prefix into local directory destRoot.
+// Directories are created as needed, directory stub objects are skipped. Objects are streamed
+func DownloadTree(ctx context.Context, s3 *S3, prefix string, local *Local, destRoot string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	prefix = s3.nameToDir(s3.normalizeName(prefix))
+	return s3.WalkDir(ctx, prefix, func(name string, d DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := s3.Rel(prefix, name)
+		if err != nil {
+			return err
+		}
+		localName := filepath.Join(destRoot, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return local.MakePathAll(ctx, localName)
+		}
+		return downloadFile(ctx, s3, name, local, localName)
+	})
+}
+
+// downloadFile streams S3 object into local file
+func downloadFile(ctx context.Context, s3 *S3, name string, local *Local, localName string) (err error) {
+	var r io.ReadCloser
+	if r, err = s3.Reader(ctx, name); err != nil {
+		return
+	}
+	defer r.Close()
+
+	var f File
+	if f, err = local.Create(ctx, localName); err != nil {
+		return
+	}
+	defer func() {
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+	}()
+	_, err = io.Copy(f, r)
+	return
+}
+
+// UploadTree uploads local directory srcRoot into S3 directory with the given prefix.
+// If empty dirs are emulated, directory stubs are created for all directories including empty ones.
+// Files are streamed, each one is opened only while it is being uploaded
+func UploadTree(ctx context.Context, local *Local, srcRoot string, s3 *S3, prefix string) (err error) {
+	if ctx, err = invokeBeforeOperationCB(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if errcb := invokeAfterOperationCB(ctx, err); err == nil {
+			err = errcb
+		} // else drop callback error
+	}()
+
+	prefix = s3.nameToDir(s3.normalizeName(prefix))
+	var files []FileNameReader
+	defer func() { // files not read to the end are left opened on error
+		for _, f := range files {
+			_ = f.Reader.(*lazyFileReader).Close()
+		}
+	}()
+	if err = local.WalkFiles(ctx, srcRoot, func(fi FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := local.Rel(srcRoot, fi.FullName())
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if fi.IsDir() {
+			return s3.MakePathAll(ctx, name)
+		}
+		files = append(files, FileNameReader{
+			Name:   name,
+			Reader: &lazyFileReader{ctx: ctx, local: local, name: fi.FullName()},
+			Size:   fi.Size(),
+		})
+		return nil
+	}); err != nil {
+		return
+	}
+	return s3.WriteFilesFrom(ctx, files)
+}
+
+// lazyFileReader opens the local file on the first read and closes it on reaching EOF
+type lazyFileReader struct {
+	ctx   context.Context
+	local *Local
+	name  string
+	r     io.ReadCloser
+	done  bool
+}
+
+// Read makes lazyFileReader to implement io.Reader
+func (lr *lazyFileReader) Read(p []byte) (n int, err error) {
+	if lr.done {
+		return 0, io.EOF
+	}
+	if lr.r == nil {
+		if lr.r, err = lr.local.Reader(lr.ctx, lr.name); err != nil {
+			return
+		}
+	}
+	if n, err = lr.r.Read(p); err == io.EOF {
+		err = lr.Close()
+		lr.done = true
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	return
+}
+
+// Close closes the local file if it is opened
+func (lr *lazyFileReader) Close() (err error) {
+	if lr.r != nil {
+		err = lr.r.Close()
+		lr.r = nil
+	}
+	return
+}
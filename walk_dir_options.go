@@ -0,0 +1,59 @@
+package filesystem
+
+import "time"
+
+// WalkDirOptions are options for walking the directory tree
+type WalkDirOptions struct {
+	// ContinueOnError makes errors returned by WalkDirFunc on reports of failed entries, e.g. directories
+	// failed to be read, to skip only those entries instead of aborting the entire walk.
+	// ErrStopWalk still stops the walk
+	ContinueOnError bool
+	// ModifiedAfter, if not zero, makes WalkDirFunc to be invoked only for files modified after it.
+	// Directories are descended regardless of their modification time
+	ModifiedAfter time.Time
+	// ModifiedBefore, if not zero, makes WalkDirFunc to be invoked only for files modified before it.
+	// Directories are descended regardless of their modification time
+	ModifiedBefore time.Time
+	// Limit, if positive, is the max amount of entries passed to WalkDirFunc. If there are more entries to visit,
+	// the walk stops and ErrWalkTruncated is returned. Entries of skipped directories are not counted
+	Limit int
+	// FollowSymlinks makes Local to descend into symlinked directories, which are otherwise reported as files.
+	// A symlinked directory already visited during the walk is reported as a file to avoid cycles.
+	// S3 has no symlinks, so it is not applied there
+	FollowSymlinks bool
+}
+
+// limited returns walkDirFunc stopping the walk with ErrWalkTruncated after the options limit of entries is visited.
+// Reports of directory reading errors are not counted
+func (o WalkDirOptions) limited(walkDirFunc WalkDirFunc) WalkDirFunc {
+	if o.Limit <= 0 {
+		return walkDirFunc
+	}
+	visited := 0
+	return func(name string, d DirEntry, err error) error {
+		if err == nil {
+			if visited == o.Limit {
+				return ErrWalkTruncated
+			}
+			visited++
+		}
+		return walkDirFunc(name, d, err)
+	}
+}
+
+// continued returns the error err returned by WalkDirFunc on a report of a failed entry
+// or nil if the walk should be continued past the entry
+func (o WalkDirOptions) continued(err error) error {
+	if o.ContinueOnError && err != ErrStopWalk {
+		return nil
+	}
+	return err
+}
+
+// modTimeMatches returns true if the given file modification time is within the options time window
+func (o WalkDirOptions) modTimeMatches(modTime time.Time) bool {
+	if !o.ModifiedAfter.IsZero() && !modTime.After(o.ModifiedAfter) {
+		return false
+	}
+	return o.ModifiedBefore.IsZero() || modTime.Before(o.ModifiedBefore)
+}
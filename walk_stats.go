@@ -0,0 +1,32 @@
+package filesystem
+
+import "context"
+
+// WalkStats holds running totals of a directory tree walk
+type WalkStats struct {
+	Files int64 // number of files visited
+	Dirs  int64 // number of directories visited, including the root
+	Bytes int64 // total size of files visited
+}
+
+// walkDirWithStats calls walkDir wrapping walkDirFunc so every visited entry is tallied into the returned stats.
+// Entries reported with an error are not tallied
+func walkDirWithStats(ctx context.Context, walkDir func(context.Context, string, WalkDirFunc) error, root string,
+	walkDirFunc WalkDirFunc) (stats WalkStats, err error) {
+	err = walkDir(ctx, root, func(name string, de DirEntry, err error) error {
+		if err == nil && de != nil {
+			if de.IsDir() {
+				stats.Dirs++
+			} else {
+				stats.Files++
+				info, errInfo := de.Info()
+				if errInfo != nil {
+					return walkDirFunc(name, de, errInfo)
+				}
+				stats.Bytes += info.Size()
+			}
+		}
+		return walkDirFunc(name, de, err)
+	})
+	return
+}
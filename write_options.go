@@ -0,0 +1,18 @@
+package filesystem
+
+import "time"
+
+// ExpireTagKey is a key of the object tag holding the object expiration time in RFC 3339 format
+const ExpireTagKey = "autoexpire"
+
+// WriteOptions are options for writing S3 objects. Empty CacheControl and ContentDisposition are taken from S3Params
+type WriteOptions struct {
+	CacheControl       string // Cache-Control header of the object
+	ContentDisposition string // Content-Disposition header of the object, e.g. `attachment; filename="1.txt"`
+	// ExpireAfter, if positive, makes the object to be tagged with ExpireTagKey with the time it expires at.
+	// The object is actually removed only by the bucket lifecycle rule configured to expire tagged objects
+	ExpireAfter time.Duration
+	// EnableContentMD5 makes the MD5 of the object contents to be sent in the Content-MD5 header,
+	// so the server rejects the object corrupted in transit. It is also enabled by S3Params.EnableContentMD5
+	EnableContentMD5 bool
+}